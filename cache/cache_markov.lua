@@ -2,13 +2,48 @@
 ---@meta
 ---@diagnostic disable: undefined-global
 
+-- ---------------------------------------------------------------------------
+-- Library version
+-- LIBRARY_API changes whenever the key layout or a function's keys, arguments
+-- or reply change incompatibly; the bot refuses to run against another API.
+-- LIBRARY_VERSION is bumped on every change to this file, so a stale library
+-- is detected and replaced at startup (see repositories.EnsureLibrary).
+-- ---------------------------------------------------------------------------
+local LIBRARY_API     = 4
+local LIBRARY_VERSION = 15
+
+-- library_version  (no keys)  ->  {api, version}
+local function library_version(_keys, _args)
+  return { LIBRARY_API, LIBRARY_VERSION }
+end
+
 -- ---------------------------------------------------------------------------
 -- Key helpers
+-- Every function receives guild ids hash-tagged ("{<guild_id>}", see
+-- repositories.ChainKey), so all keys of a guild and of its sub-chains share
+-- one cluster slot and are declared through KEYS[1].
 -- ---------------------------------------------------------------------------
 local STATE_MARKER = ":state:"
 local function state_key(guild_id, prefix) return "markov:" .. guild_id .. ":state:" .. prefix end
 local function state_keys_match(guild_id) return "markov:" .. guild_id .. ":state:*" end
 local function legacy_prefixes_set_key(guild_id) return "markov:" .. guild_id .. ":prefixes" end
+local function start_index_key(guild_id) return "markov:" .. guild_id .. ":starts" end
+local function start_classes_key(guild_id) return "markov:" .. guild_id .. ":starts_classes" end
+local function start_class_key(guild_id, class) return "markov:" .. guild_id .. ":starts:" .. class end
+local function age_index_key(guild_id) return "markov:" .. guild_id .. ":ages" end
+-- Sub-chains reuse every Markov function under a derived guild_id:
+-- "{<guild_id>}/<channel_id>" for channels, "{<guild_id>}@<user_id>" for
+-- authors and "{<guild_id>}#<lang>" for languages. No separator is ':', so
+-- their keys never match the parent guild's "markov:{<guild_id>}:" patterns.
+local CHANNEL_SEP  = "/"
+local AUTHOR_SEP   = "@"
+local LANGUAGE_SEP = "#"
+local function sub_chain_keys_matches(guild_id, sep)
+  return { "markov:" .. guild_id .. sep .. "*", "stats:" .. guild_id .. sep .. "*" }
+end
+local function rstate_key(guild_id, suffix) return "markov:" .. guild_id .. ":rstate:" .. suffix end
+-- Matches both forward (state) and reverse (rstate) transition hashes.
+local function all_state_keys_match(guild_id) return "markov:" .. guild_id .. ":*state:*" end
 local function prefix_from_state_key(key)
   local p = string.find(key, STATE_MARKER, 1, true)
   if not p then return "" end
@@ -17,16 +52,225 @@ end
 local function stats_prefix_key(guild_id) return "stats:" .. guild_id .. ":unique_prefixes" end
 local function stats_msg_key(guild_id) return "stats:" .. guild_id .. ":message_count" end
 local function stats_bytes_key(guild_id) return "stats:" .. guild_id .. ":estimated_bytes" end
+local function stats_evicted_key(guild_id) return "stats:" .. guild_id .. ":evicted" end
 local function media_key(guild_id, kind) return "media:" .. guild_id .. ":" .. kind end
 local function config_key(guild_id) return "config:" .. guild_id end
 local function fetching_key(guild_id) return "fetching:" .. guild_id end
+local function novelty_key(guild_id) return "novelty:" .. guild_id end
+local function rhyme_key(guild_id, key) return "rhyme:" .. guild_id .. ":" .. key end
+local function keyword_key(guild_id) return "keywords:" .. guild_id end
+local function keyword_docs_key(guild_id) return "keywords:" .. guild_id .. ":docs" end
+-- Conversations are kept per channel, under the channel sub-chain's id.
+local function conversation_key(chain_id) return "conversation:" .. chain_id end
+local function conversation_turns_key(chain_id) return "conversation:" .. chain_id .. ":turns" end
+local function analysis_key(guild_id) return "analysis:" .. guild_id end
+local function analysis_tokens_key(guild_id) return "analysis:" .. guild_id .. ":tokens" end
+
+-- ---------------------------------------------------------------------------
+-- Byte accounting  (counter at stats:<chain_id>:estimated_bytes)
+-- A guild's channel sub-chains also add up at stats:<guild_id>/:estimated_bytes,
+-- its language sub-chains at stats:<guild_id>#:estimated_bytes and its author
+-- sub-chains at stats:<guild_id>@:estimated_bytes. These group counters are what train_batch checks against the budget each group
+-- shares. A group counter is computed on first use (see group_bytes), and
+-- every change to a chain's counter goes through add_bytes so it follows.
+-- ---------------------------------------------------------------------------
+local function get_bytes(key)
+  return tonumber(redis.call('GET', key) or "0") or 0
+end
+
+-- Returns the group counter key of a sub-chain and the pattern matching its
+-- members' counters, or nil for chains outside any group.
+local function group_bytes_key(chain_id)
+  local parent, sep = string.match(chain_id, "^({[^}]*})([/#@])")
+  if not parent then return nil end
+  return stats_bytes_key(parent .. sep), stats_bytes_key(parent .. sep .. "*")
+end
+
+local function group_bytes(chain_id)
+  local gk, matchpat = group_bytes_key(chain_id)
+  if not gk then return 0 end
+  local total = tonumber(redis.call('GET', gk))
+  if total then return total end
+  total = 0
+  local cursor = "0"
+  repeat
+    local res = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', 200)
+    cursor = res[1]
+    for _, k in ipairs(res[2]) do
+      if k ~= gk then total = total + get_bytes(k) end
+    end
+  until cursor == "0"
+  redis.call('SET', gk, total)
+  return total
+end
+
+-- Adds delta to the chain's byte counter, clamped at 0. Returns the new value.
+local function add_bytes(chain_id, delta)
+  local bk  = stats_bytes_key(chain_id)
+  local cur = get_bytes(bk)
+  local new = math.max(0, cur + delta)
+  if new == cur then return cur end
+  redis.call('SET', bk, new)
+  local gk = group_bytes_key(chain_id)
+  if gk and redis.call('EXISTS', gk) == 1 then
+    redis.call('SET', gk, math.max(0, get_bytes(gk) + new - cur))
+  end
+  return new
+end
+
+-- Reports whether the chain, or the group it belongs to, reached its budget
+-- (0 = unlimited). Returns 0 when the chain is full, -1 when the group is and
+-- nil when training may go on.
+local function size_limit_hit(chain_id, max_size_bytes, group_max_bytes)
+  if max_size_bytes > 0 and get_bytes(stats_bytes_key(chain_id)) >= max_size_bytes then
+    return 0
+  end
+  if group_max_bytes > 0 and group_bytes(chain_id) >= group_max_bytes then
+    return -1
+  end
+  return nil
+end
+
+-- ---------------------------------------------------------------------------
+-- Sentence markers (must match tokenBOS / tokenEOS in cache.repository.go)
+-- BOS opens every trained message, EOS closes it. Both are control characters
+-- so they survive %S+ splitting and never collide with real tokens.
+-- ---------------------------------------------------------------------------
+local BOS = "\2"
+local EOS = "\3"
+local function is_marker(token) return token == BOS or token == EOS end
+local function is_start_prefix(prefix) return string.sub(prefix, 1, 1) == BOS end
+local function start_state_keys_match(guild_id) return "markov:" .. guild_id .. ":state:" .. BOS .. "*" end
+
+-- ---------------------------------------------------------------------------
+-- Start-prefix index  (hash at markov:<guild_id>:starts)
+-- field = a prefix opening with BOS, value = total outgoing weight of that
+-- state, i.e. how many trained messages start with it. Lets find_prefix pick
+-- a weighted opening without SCANning the whole keyspace.
+--
+-- For O(1) weighted draws the openings are also bucketed by weight class:
+-- class c holds the openings weighing [2^c, 2^(c+1)) in the set
+-- markov:<guild_id>:starts:<c>, and markov:<guild_id>:starts_classes maps
+-- each class to its summed weight (plus a "built" marker field). A draw
+-- picks a class in proportion to its weight, then a member of it by
+-- rejection sampling (see pick_indexed_start). The classes are built on
+-- first use (see start_classes) and only kept up to date once they exist.
+--
+-- index_start_add / index_start_sub return the byte delta so callers can
+-- fold it into estimated_bytes.
+-- ---------------------------------------------------------------------------
+local START_CLASSES_BUILT = "built"
+
+-- floor(log2(weight)) for weight >= 1.
+local function weight_class(weight)
+  local class = 0
+  while weight >= 2 do
+    weight = math.floor(weight / 2)
+    class  = class + 1
+  end
+  return class
+end
+
+-- Moves prefix between weight classes after its weight went from old_w to
+-- new_w (0 = not indexed). No-op until the classes are built.
+local function start_class_update(guild_id, prefix, old_w, new_w)
+  local ck = start_classes_key(guild_id)
+  if old_w == new_w or redis.call('EXISTS', ck) == 0 then return end
+  local old_c = old_w > 0 and weight_class(old_w) or nil
+  local new_c = new_w > 0 and weight_class(new_w) or nil
+  if old_c and old_c ~= new_c then
+    redis.call('SREM', start_class_key(guild_id, old_c), prefix)
+  end
+  if new_c and new_c ~= old_c then
+    redis.call('SADD', start_class_key(guild_id, new_c), prefix)
+  end
+  if old_c then
+    if redis.call('HINCRBY', ck, old_c, -old_w) <= 0 then
+      redis.call('HDEL', ck, old_c)
+    end
+  end
+  if new_c then
+    redis.call('HINCRBY', ck, new_c, new_w)
+  end
+end
+
+local function index_start_add(guild_id, prefix, weight)
+  local ik  = start_index_key(guild_id)
+  local old = tonumber(redis.call('HGET', ik, prefix)) or 0
+  start_class_update(guild_id, prefix, old, redis.call('HINCRBY', ik, prefix, weight))
+  if old == 0 then return #prefix + 16 end
+  return 0
+end
+
+local function index_start_sub(guild_id, prefix, weight)
+  local ik  = start_index_key(guild_id)
+  local old = tonumber(redis.call('HGET', ik, prefix))
+  if not old then return 0 end
+  local left = redis.call('HINCRBY', ik, prefix, -weight)
+  if left <= 0 then
+    redis.call('HDEL', ik, prefix)
+    start_class_update(guild_id, prefix, old, 0)
+    return #prefix + 16
+  end
+  start_class_update(guild_id, prefix, old, left)
+  return 0
+end
+
+-- Drops the weight classes (not the index itself).
+local function drop_start_classes(guild_id)
+  local ck = start_classes_key(guild_id)
+  for _, class in ipairs(redis.call('HKEYS', ck)) do
+    if class ~= START_CLASSES_BUILT then
+      redis.call('DEL', start_class_key(guild_id, class))
+    end
+  end
+  redis.call('DEL', ck)
+end
+
+-- Returns the non-empty weight classes as {class, weight} rows and their
+-- summed weight, building the classes from the index when missing.
+local function start_classes(guild_id)
+  local ck = start_classes_key(guild_id)
+  if redis.call('EXISTS', ck) == 0 then
+    local ik     = start_index_key(guild_id)
+    local cursor = "0"
+    repeat
+      local res  = redis.call('HSCAN', ik, cursor, 'COUNT', 200)
+      local flat = res[2]
+      cursor = res[1]
+      for i = 1, #flat, 2 do
+        local w = tonumber(flat[i + 1]) or 0
+        if w > 0 then
+          local class = weight_class(w)
+          redis.call('SADD', start_class_key(guild_id, class), flat[i])
+          redis.call('HINCRBY', ck, class, w)
+        end
+      end
+    until cursor == "0"
+    redis.call('HSET', ck, START_CLASSES_BUILT, 1)
+  end
+
+  local flat    = redis.call('HGETALL', ck)
+  local classes = {}
+  local total   = 0
+  for i = 1, #flat, 2 do
+    local w = tonumber(flat[i + 1]) or 0
+    if flat[i] ~= START_CLASSES_BUILT and w > 0 then
+      classes[#classes + 1] = { tonumber(flat[i]), w }
+      total = total + w
+    end
+  end
+  return classes, total
+end
 
 -- Keep at most max_f distinct next-token fields per state hash (by highest counts).
 -- Drops lowest-count edges first. max_f <= 0 disables pruning.
+-- Returns the summed weight of the dropped edges and the dropped edges
+-- themselves as {weight, field} rows.
 local function prune_transition_hash(sk, max_f)
-  if max_f <= 0 then return end
+  if max_f <= 0 then return 0, {} end
   local n = redis.call('HLEN', sk)
-  if n <= max_f then return end
+  if n <= max_f then return 0, {} end
   local flat = redis.call('HGETALL', sk)
   local rows = {}
   for i = 1, #flat, 2 do
@@ -36,10 +280,118 @@ local function prune_transition_hash(sk, max_f)
     if a[1] ~= b[1] then return a[1] < b[1] end
     return a[2] < b[2]
   end)
-  local drop = n - max_f
+  local drop    = n - max_f
+  local dropped = 0
+  local edges   = {}
   for i = 1, drop do
     redis.call('HDEL', sk, rows[i][2])
+    dropped = dropped + rows[i][1]
+    edges[i] = rows[i]
+  end
+  return dropped, edges
+end
+
+-- Bytes estimated_bytes counted for the edges returned by prune_transition_hash.
+local function edges_bytes(edges)
+  local bytes = 0
+  for _, e in ipairs(edges) do
+    bytes = bytes + (#e[2] + 16) * e[1]
+  end
+  return bytes
+end
+
+-- ---------------------------------------------------------------------------
+-- Reverse transitions  (hash at markov:<guild_id>:rstate:<suffix>)
+-- Mirror of the forward table: for every trained n-gram the last n-1 tokens
+-- map to the token that preceded them. generate_around walks these back
+-- from a seed to BOS. Returns the byte delta for estimated_bytes.
+-- ---------------------------------------------------------------------------
+local function reverse_pair(prefix, next_word)
+  local sp = string.find(prefix, " ", 1, true)
+  if not sp then return next_word, prefix end
+  return string.sub(prefix, sp + 1) .. " " .. next_word, string.sub(prefix, 1, sp - 1)
+end
+
+-- Inverse of reverse_pair: the forward transition a reverse one mirrors.
+local function forward_pair(suffix, prev_word)
+  local sp = string.find(suffix, " [^ ]*$")
+  if not sp then return prev_word, suffix end
+  return prev_word .. " " .. string.sub(suffix, 1, sp - 1), string.sub(suffix, sp + 1)
+end
+
+local function add_reverse(guild_id, prefix, next_word, max_branching, weight)
+  local suffix, prev_word = reverse_pair(prefix, next_word)
+  local rk     = rstate_key(guild_id, suffix)
+  local is_new = redis.call('EXISTS', rk) == 0
+
+  redis.call('HINCRBY', rk, prev_word, weight)
+  local _, pruned = prune_transition_hash(rk, max_branching)
+
+  local added = (#prev_word + 16) * weight - edges_bytes(pruned)
+  if is_new then added = added + #rk + 64 end
+  return added
+end
+
+local function remove_reverse(guild_id, prefix, next_word, weight)
+  local suffix, prev_word = reverse_pair(prefix, next_word)
+  local rk      = rstate_key(guild_id, suffix)
+  local current = tonumber(redis.call('HGET', rk, prev_word) or "0") or 0
+  if current <= 0 then return 0 end
+
+  local removed = math.min(weight or 1, current)
+  local freed   = (#prev_word + 16) * removed
+  if redis.call('HINCRBY', rk, prev_word, -removed) <= 0 then
+    redis.call('HDEL', rk, prev_word)
+    if redis.call('HLEN', rk) == 0 then
+      redis.call('DEL', rk)
+      freed = freed + #rk + 64
+    end
+  end
+  return freed
+end
+
+-- Caps the forward state of prefix at max_f successors. The reverse twins of
+-- the dropped edges and their weight in the start index go with them.
+-- Returns the bytes freed.
+local function prune_forward(guild_id, prefix, max_f)
+  local dropped, edges = prune_transition_hash(state_key(guild_id, prefix), max_f)
+  if dropped <= 0 then return 0 end
+  local freed = edges_bytes(edges)
+  for _, e in ipairs(edges) do
+    freed = freed + remove_reverse(guild_id, prefix, e[2], e[1])
+  end
+  if is_start_prefix(prefix) then
+    freed = freed + index_start_sub(guild_id, prefix, dropped)
   end
+  return freed
+end
+
+-- ---------------------------------------------------------------------------
+-- Age index  (sorted set at markov:<guild_id>:ages)
+-- member = a forward prefix, score = unix time it was last trained. Only kept
+-- for chains evicting with the "oldest" policy (see evict_batch). Returns the
+-- byte delta for estimated_bytes, like the helpers above.
+-- ---------------------------------------------------------------------------
+local function age_index_remove(guild_id, prefix)
+  if redis.call('ZREM', age_index_key(guild_id), prefix) == 1 then return #prefix + 24 end
+  return 0
+end
+
+-- Deletes a whole age index, sizing it 1000 members at a time.
+local function age_index_drop(guild_id)
+  local ak    = age_index_key(guild_id)
+  local freed = 0
+  local start = 0
+  local members
+  repeat
+    members = redis.call('ZRANGE', ak, start, start + 999)
+    for _, prefix in ipairs(members) do
+      freed = freed + #prefix + 24
+    end
+    start = start + 1000
+  until #members < 1000
+  redis.call('DEL', ak)
+  return freed
 end
 
 -- ---------------------------------------------------------------------------
@@ -53,52 +405,104 @@ local function split_tokens(str)
   return tokens
 end
 
+-- join_output concatenates generated tokens, dropping sentence markers.
+local function join_output(tokens)
+  local out = {}
+  for _, token in ipairs(tokens) do
+    if not is_marker(token) then
+      table.insert(out, token)
+    end
+  end
+  return table.concat(out, " ")
+end
+
 -- ---------------------------------------------------------------------------
 -- train_batch  KEYS[1]=guild_id
 --              ARGV[1]=max_size_bytes  (0 = unlimited)
 --              ARGV[2]=max_branching    (0 = unlimited distinct next-tokens per prefix)
 --              ARGV[3]=message_count   (number of messages in this batch)
---              ARGV[4..N] = pairs packed as "prefix\0next_word"
+--              ARGV[4]=track_ages      ("1" records the trained prefixes in the age index)
+--              ARGV[5]=group_max_bytes (budget of the chain's sub-chain group, 0 = unlimited)
+--              ARGV[6..N] = pairs packed as "prefix\0next_word", optionally
+--                           weighted as "prefix\0next_word\0count" (chain import)
 --
--- Ingests an entire pre-tokenised batch in a single FCall.
--- Returns 1=written, 0=size limit already reached (nothing written).
+-- Ingests an entire pre-tokenised batch in a single FCall. An age index left
+-- over from an earlier "oldest" policy is dropped by the first batch trained
+-- without track_ages.
+-- The size limit is also checked before each pair, so a batch never runs
+-- past it by more than one pair.
+-- Returns 1=written, 2=written up to the size limit (the remaining pairs were
+-- dropped), 0=size limit already reached, -1=group budget already used up
+-- (nothing written in either case).
 -- ---------------------------------------------------------------------------
 local function train_batch(keys, args)
   local guild_id       = keys[1]
   local max_size_bytes = tonumber(args[1]) or 0
   local max_branching  = tonumber(args[2]) or 0
   local message_count  = tonumber(args[3]) or 0
+  local track_ages     = args[4] == "1"
+  local group_max      = tonumber(args[5]) or 0
 
-  -- Fast size-limit pre-check via the cheap counter
-  if max_size_bytes > 0 then
-    local current = tonumber(redis.call('GET', stats_bytes_key(guild_id)) or "0") or 0
-    if current >= max_size_bytes then
-      return 0
-    end
-  end
+  -- Fast size-limit pre-check via the cheap counters
+  local full = size_limit_hit(guild_id, max_size_bytes, group_max)
+  if full then return full end
 
   local added_bytes  = 0
   local new_prefixes = 0
+  local trained      = {}
+  local current      = get_bytes(stats_bytes_key(guild_id))
+  local result       = 1
+
+  if not track_ages and redis.call('EXISTS', age_index_key(guild_id)) == 1 then
+    added_bytes = added_bytes - age_index_drop(guild_id)
+  end
 
-  for i = 4, #args do
-    local pair = args[i]
-    local sep  = string.find(pair, "\0", 1, true)
+  for i = 6, #args do
+    if max_size_bytes > 0 and current + added_bytes >= max_size_bytes then
+      result = 2
+      break
+    end
+    local pair      = args[i]
+    local sep       = string.find(pair, "\0", 1, true)
+    local prefix    = sep and string.sub(pair, 1, sep - 1)
+    local next_word = sep and string.sub(pair, sep + 1)
+    local weight    = 1
 
-    -- Replace 'goto continue' with a standard if check
     if sep then
-      local prefix    = string.sub(pair, 1, sep - 1)
-      local next_word = string.sub(pair, sep + 1)
+      local wsep = string.find(next_word, "\0", 1, true)
+      if wsep then
+        weight    = tonumber(string.sub(next_word, wsep + 1)) or 0
+        next_word = string.sub(next_word, 1, wsep - 1)
+      end
+    end
+
+    if sep and weight > 0 then
       local sk        = state_key(guild_id, prefix)
       local is_new    = redis.call('EXISTS', sk) == 0
 
-      redis.call('HINCRBY', sk, next_word, 1)
-      prune_transition_hash(sk, max_branching)
+      redis.call('HINCRBY', sk, next_word, weight)
+      if is_start_prefix(prefix) then
+        added_bytes = added_bytes + index_start_add(guild_id, prefix, weight)
+      end
 
       if is_new then
         new_prefixes = new_prefixes + 1
         added_bytes = added_bytes + #sk + 64      -- key name + Redis key overhead
       end
-      added_bytes = added_bytes + #next_word + 16 -- hash field + integer value
+      added_bytes = added_bytes + (#next_word + 16) * weight -- hash field + integer value
+      added_bytes = added_bytes + add_reverse(guild_id, prefix, next_word, max_branching, weight)
+      added_bytes = added_bytes - prune_forward(guild_id, prefix, max_branching)
+      trained[prefix] = true
+    end
+  end
+
+  if track_ages then
+    local ak  = age_index_key(guild_id)
+    local now = tonumber(redis.call('TIME')[1])
+    for prefix in pairs(trained) do
+      if redis.call('ZADD', ak, now, prefix) == 1 then
+        added_bytes = added_bytes + #prefix + 24
+      end
     end
   end
 
@@ -109,19 +513,18 @@ local function train_batch(keys, args)
   if message_count > 0 then
     redis.call('INCRBY', stats_msg_key(guild_id), message_count)
   end
-  if added_bytes > 0 then
-    redis.call('INCRBY', stats_bytes_key(guild_id), added_bytes)
-  end
+  add_bytes(guild_id, added_bytes)
 
-  return 1
+  return result
 end
 
 -- ---------------------------------------------------------------------------
 -- train_markov  KEYS[1]=guild_id  ARGV[1]=prefix  ARGV[2]=next_word
 --               ARGV[3]=max_size_bytes  ARGV[4]=max_branching (0 = unlimited)
+--               ARGV[5]=group_max_bytes (optional, see train_batch)
 --
 -- Single-pair write for real-time ingestion of one message.
--- Returns 1=written, 0=size limit hit.
+-- Returns 1=written, 0=size limit hit, -1=group budget used up.
 -- ---------------------------------------------------------------------------
 local function train_markov(keys, args)
   local guild_id       = keys[1]
@@ -130,25 +533,24 @@ local function train_markov(keys, args)
   local max_size_bytes = tonumber(args[3]) or 0
   local max_branching  = tonumber(args[4]) or 0
 
-  if max_size_bytes > 0 then
-    local current = tonumber(redis.call('GET', stats_bytes_key(guild_id)) or "0") or 0
-    if current >= max_size_bytes then
-      return 0
-    end
-  end
+  local full = size_limit_hit(guild_id, max_size_bytes, tonumber(args[5]) or 0)
+  if full then return full end
 
   local sk     = state_key(guild_id, prefix)
   local is_new = redis.call('EXISTS', sk) == 0
 
   redis.call('HINCRBY', sk, next_word, 1)
-  prune_transition_hash(sk, max_branching)
 
-  local added = #next_word + 16
+  local added = #next_word + 16 + add_reverse(guild_id, prefix, next_word, max_branching, 1)
+  if is_start_prefix(prefix) then
+    added = added + index_start_add(guild_id, prefix, 1)
+  end
+  added = added - prune_forward(guild_id, prefix, max_branching)
   if is_new then
     redis.call('INCR', stats_prefix_key(guild_id))
     added = added + #sk + 64
   end
-  redis.call('INCRBY', stats_bytes_key(guild_id), added)
+  add_bytes(guild_id, added)
 
   return 1
 end
@@ -161,226 +563,532 @@ local function count_message(keys, _args)
   return 1
 end
 
--- ---------------------------------------------------------------------------
--- find_prefix  KEYS[1]=guild_id  ARGV[1]=seed
--- ---------------------------------------------------------------------------
-local function find_prefix(keys, args)
-  local guild_id = keys[1]
-  local seed     = args[1] or ""
-  local matchpat = state_keys_match(guild_id)
-
-  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
-
-  if seed ~= "" then
-    if redis.call('EXISTS', state_key(guild_id, seed)) == 1 then
-      return seed
-    end
-
-    local cursor   = "0"
-    local matching = {}
-    repeat
-      local res = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', 100)
-      cursor = res[1]
-      for _, key in ipairs(res[2]) do
-        local pref = prefix_from_state_key(key)
-        if pref ~= "" and string.find(pref, seed, 1, true) then
-          table.insert(matching, pref)
-          if #matching >= 200 then
-            cursor = "0"
-            break
-          end
-        end
-      end
-    until cursor == "0"
-
-    if #matching > 0 then
-      return matching[math.random(1, #matching)]
-    end
-  end
-
+-- Reservoir-samples one state key matching matchpat among the first
+-- max_pages SCAN pages. Returns nil when none of them match.
+local START_FALLBACK_PAGES = 8
+local function sample_state_key(matchpat, max_pages)
   local cursor     = "0"
   local chosen_key = nil
   local n          = 0
+  local pages      = 0
   repeat
     local res = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', 200)
     cursor = res[1]
+    pages  = pages + 1
     for _, key in ipairs(res[2]) do
       n = n + 1
       if math.random(n) == 1 then
         chosen_key = key
       end
     end
+  until cursor == "0" or pages >= max_pages
+  return chosen_key
+end
+
+-- Weighted pick from the start-prefix index, exactly in proportion to how
+-- many messages start with each opening. A class is drawn by its summed
+-- weight, then a uniform member of it is accepted with probability
+-- weight / 2^(class+1). Members of a class weigh at least half that bound,
+-- so a try succeeds at least half the time and a draw costs O(1) expected
+-- calls whatever the number of openings. Returns nil when the index is empty.
+local START_PICK_TRIES = 64
+local function pick_indexed_start(guild_id)
+  local classes, total = start_classes(guild_id)
+  if total <= 0 then return nil end
+
+  local ik = start_index_key(guild_id)
+  for _ = 1, START_PICK_TRIES do
+    local target = math.random(1, total)
+    local class  = classes[#classes][1]
+    for _, row in ipairs(classes) do
+      target = target - row[2]
+      if target <= 0 then
+        class = row[1]
+        break
+      end
+    end
+    local prefix = redis.call('SRANDMEMBER', start_class_key(guild_id, class))
+    if prefix then
+      local w = tonumber(redis.call('HGET', ik, prefix)) or 0
+      if w > 0 and math.random() * 2 ^ (class + 1) < w then
+        return prefix
+      end
+    end
+  end
+
+  -- Only reachable with classes out of step with the index (odds of 2^-64
+  -- otherwise): rebuild them and settle for a uniform opening this time.
+  drop_start_classes(guild_id)
+  local any = redis.call('HRANDFIELD', ik)
+  if any then return any end
+  return nil
+end
+
+-- Picks a random forward prefix containing seed, preferring an exact match.
+-- Returns nil when no state mentions it. Caller is responsible for seeding math.random.
+local function find_seeded_prefix(guild_id, seed)
+  if redis.call('EXISTS', state_key(guild_id, seed)) == 1 then
+    return seed
+  end
+
+  local cursor   = "0"
+  local matching = {}
+  repeat
+    local res = redis.call('SCAN', cursor, 'MATCH', state_keys_match(guild_id), 'COUNT', 100)
+    cursor = res[1]
+    for _, key in ipairs(res[2]) do
+      local pref = prefix_from_state_key(key)
+      if pref ~= "" and string.find(pref, seed, 1, true) then
+        table.insert(matching, pref)
+        if #matching >= 200 then
+          cursor = "0"
+          break
+        end
+      end
+    end
   until cursor == "0"
 
-  return chosen_key and prefix_from_state_key(chosen_key) or ""
+  if #matching > 0 then
+    return matching[math.random(1, #matching)]
+  end
+  return nil
 end
 
 -- ---------------------------------------------------------------------------
--- do_generate_tokens (internal helper, shared by generate_markov + generate_rhyme)
--- Returns (tokens_table, window) where window = n_gram_size - 1.
--- Caller is responsible for seeding math.random.
+-- find_prefix  KEYS[1]=guild_id  ARGV[1]=seed
 -- ---------------------------------------------------------------------------
-local function do_generate_tokens(guild_id, start_prefix, max_length)
-  if start_prefix == "" then return {}, 1 end
+local function find_prefix(keys, args)
+  local guild_id = keys[1]
+  local seed     = args[1] or ""
+  local matchpat = state_keys_match(guild_id)
 
-  local generated      = split_tokens(start_prefix)
-  local configured_n   = tonumber(redis.call('HGET', config_key(guild_id), 'n_gram_size') or "0") or 0
-  local inferred_n     = #generated + 1
-  local n_gram_size    = configured_n > 0 and configured_n or inferred_n
-  local window         = math.max(1, n_gram_size - 1)
-  local current_prefix = start_prefix
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
 
-  for _ = 1, max_length do
-    local backoff    = split_tokens(current_prefix)
-    local next_words = {}
-    local found      = false
+  if seed ~= "" then
+    local seeded = find_seeded_prefix(guild_id, seed)
+    if seeded then return seeded end
+  end
 
-    while #backoff > 0 do
-      local bk     = table.concat(backoff, " ")
-      local result = redis.call('HGETALL', state_key(guild_id, bk))
-      if #result > 0 then
-        next_words = result
-        found      = true
-        break
-      end
-      table.remove(backoff, 1)
-    end
+  -- Prefer prefixes that open a message so output reads like a real one.
+  local indexed = pick_indexed_start(guild_id)
+  if indexed then return indexed end
+
+  -- Index not built yet (run backfill_start_index): settle for a state from
+  -- the first few SCAN pages rather than walking the whole keyspace.
+  local chosen_key = sample_state_key(matchpat, START_FALLBACK_PAGES)
+  return chosen_key and prefix_from_state_key(chosen_key) or ""
+end
+
+-- ---------------------------------------------------------------------------
+-- Sampling controls (shared by generate_markov + generate_rhyme)
+--   temperature  1 = raw counts, < 1 sharper (more coherent), > 1 flatter
+--   top_k        keep only the k heaviest successors (0 = unlimited)
+--   top_p        keep the smallest head whose mass reaches p (1 = disabled)
+--   smoothing    discount interpolating the n-gram orders, in [0, 1)
+--                (0 = hard backoff, see next_distribution)
+-- ---------------------------------------------------------------------------
+local function parse_sampling(args, first)
+  local temperature = tonumber(args[first]) or 1
+  local top_k       = math.floor(tonumber(args[first + 1]) or 0)
+  local top_p       = tonumber(args[first + 2]) or 1
+  local smoothing   = tonumber(args[first + 3]) or 0
+  if temperature <= 0 then temperature = 1 end
+  if temperature < 0.05 then temperature = 0.05 end
+  if top_k < 0 then top_k = 0 end
+  if top_p <= 0 or top_p > 1 then top_p = 1 end
+  if smoothing < 0 or smoothing >= 1 then smoothing = 0 end
+  return { temperature = temperature, top_k = top_k, top_p = top_p, smoothing = smoothing }
+end
 
-    if not found then break end
+local function is_raw_sampling(sampling)
+  return sampling == nil or
+      (sampling.temperature == 1 and sampling.top_k == 0 and sampling.top_p >= 1)
+end
 
+-- pick_next draws one successor from a flat HGETALL reply {word, count, ...}.
+-- Returns nil when the reply carries no weight.
+local function pick_next(next_words, sampling)
+  if is_raw_sampling(sampling) then
     local total_weight = 0
     for j = 2, #next_words, 2 do
       total_weight = total_weight + tonumber(next_words[j])
     end
-    if total_weight == 0 then break end
+    if total_weight == 0 then return nil end
 
     local target     = math.random(1, total_weight)
     local cumulative = 0
-    local chosen     = nil
     for j = 1, #next_words, 2 do
       cumulative = cumulative + tonumber(next_words[j + 1])
       if target <= cumulative then
-        chosen = next_words[j]
-        break
+        return next_words[j]
       end
     end
+    return nil
+  end
 
-    if not chosen then break end
-
-    table.insert(generated, chosen)
+  local rows = {}
+  for j = 1, #next_words, 2 do
+    local count = tonumber(next_words[j + 1]) or 0
+    if count > 0 then
+      rows[#rows + 1] = { next_words[j], count }
+    end
+  end
+  if #rows == 0 then return nil end
 
-    local new_prefix = {}
-    local start_idx  = math.max(1, #generated - window + 1)
-    for k = start_idx, #generated do
-      table.insert(new_prefix, generated[k])
+  table.sort(rows, function(a, b)
+    if a[2] ~= b[2] then return a[2] > b[2] end
+    return a[1] < b[1]
+  end)
+  if sampling.top_k > 0 and #rows > sampling.top_k then
+    for i = #rows, sampling.top_k + 1, -1 do
+      rows[i] = nil
     end
-    current_prefix = table.concat(new_prefix, " ")
   end
 
-  return generated, window
-end
+  local inv_t = 1 / sampling.temperature
+  local total = 0
+  for _, row in ipairs(rows) do
+    row[2] = row[2] ^ inv_t
+    total  = total + row[2]
+  end
 
--- ---------------------------------------------------------------------------
--- generate_markov  KEYS[1]=guild_id
---                  ARGV[1]=start_prefix  ARGV[2]=max_length
--- ---------------------------------------------------------------------------
-local function generate_markov(keys, args)
-  local guild_id     = keys[1]
-  local start_prefix = args[1] or ""
-  local max_length   = tonumber(args[2]) or 20
+  if sampling.top_p < 1 then
+    local keep_mass  = total * sampling.top_p
+    local cumulative = 0
+    for i, row in ipairs(rows) do
+      cumulative = cumulative + row[2]
+      if cumulative >= keep_mass then
+        for k = #rows, i + 1, -1 do
+          rows[k] = nil
+        end
+        total = cumulative
+        break
+      end
+    end
+  end
 
-  if start_prefix == "" then return "" end
+  local target     = math.random() * total
+  local cumulative = 0
+  for _, row in ipairs(rows) do
+    cumulative = cumulative + row[2]
+    if target < cumulative then
+      return row[1]
+    end
+  end
+  return rows[#rows][1]
+end
 
-  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+-- pick_next_weighted draws one word from a list of {word, weight} pairs in
+-- proportion to weight. Returns nil when the list carries no weight.
+local function pick_next_weighted(options)
+  local weight_sum = 0
+  for _, option in ipairs(options) do
+    weight_sum = weight_sum + option[2]
+  end
+  if weight_sum <= 0 then return nil end
+  local target     = math.random(1, weight_sum)
+  local cumulative = 0
+  for _, option in ipairs(options) do
+    cumulative = cumulative + option[2]
+    if target <= cumulative then
+      return option[1]
+    end
+  end
+  return nil
+end
 
-  local generated = do_generate_tokens(guild_id, start_prefix, max_length)
-  return table.concat(generated, " ")
+-- configured_n_gram_size returns the n_gram_size stored in a chain's config,
+-- or 0 when there is none. Sub-chains have no config of their own and use
+-- their guild's.
+local function configured_n_gram_size(guild_id)
+  local n = tonumber(redis.call('HGET', config_key(guild_id), 'n_gram_size') or "0") or 0
+  if n == 0 then
+    local guild = string.match(guild_id, "^{[^}]*}")
+    if guild and guild ~= guild_id then
+      n = tonumber(redis.call('HGET', config_key(guild), 'n_gram_size') or "0") or 0
+    end
+  end
+  return n
 end
 
 -- ---------------------------------------------------------------------------
--- generate_rhyme  KEYS[1]=guild_id
---                 ARGV[1]=start_prefix  ARGV[2]=max_length  ARGV[3]=suffix
---
--- Single-pass rhyme generator. Forward-generates exactly once, tracking
--- per-step rhyming successors observed in each HGETALL. At the end, walks
--- recorded positions backward from the tail and accepts the latest position
--- at or above max_length/2, swapping in a weighted rhyming pick and truncating.
--- Falls back to the plain generated text if no rhyme is reachable.
+-- next_distribution (internal helper, shared by the forward generators)
+-- Training stores every order from bigrams up to n_gram_size, so each suffix
+-- of the current window has a state of its own. With smoothing 0 the longest
+-- known suffix is used alone (hard backoff). Otherwise the known suffixes are
+-- interpolated with absolute discounting, from the shortest up:
+--   P(w | s) = max(c(w) - d, 0) / C + d * T / C * P(w | shorter s)
+-- where C is the total weight of state s and T its number of successors; the
+-- shortest known suffix keeps its raw distribution. A chain trained before
+-- lower orders were stored only has its top order and samples as before.
+-- Returns a flat HGETALL-like list {word, weight, ...}, empty when no suffix
+-- is known. cache, when given, memoises the HGETALLs by prefix.
 -- ---------------------------------------------------------------------------
-local function generate_rhyme(keys, args)
-  local guild_id     = keys[1]
-  local start_prefix = args[1] or ""
-  local max_length   = tonumber(args[2]) or 20
-  local suffix       = args[3] or ""
-
-  if start_prefix == "" then return "" end
+local INTERPOLATION_SCALE = 1000000
+local function next_distribution(guild_id, context, smoothing, cache)
+  local function lookup(prefix)
+    local result = cache and cache[prefix]
+    if result == nil then
+      result = redis.call('HGETALL', state_key(guild_id, prefix))
+      if cache then cache[prefix] = result end
+    end
+    return result
+  end
 
-  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+  local backoff = {}
+  for k = 1, #context do backoff[k] = context[k] end
 
-  if suffix == "" then
-    local toks = do_generate_tokens(guild_id, start_prefix, max_length)
-    return table.concat(toks, " ")
+  if not smoothing or smoothing <= 0 then
+    while #backoff > 0 do
+      local result = lookup(table.concat(backoff, " "))
+      if #result > 0 then return result end
+      table.remove(backoff, 1)
+    end
+    return {}
   end
 
-  local suf_len = #suffix
-  local function ends_with(tok)
-    if #tok < suf_len then return false end
-    return string.lower(string.sub(tok, -suf_len)) == suffix
+  -- levels[i] = {reply, total weight, successors}, longest suffix first.
+  local levels = {}
+  while #backoff > 0 do
+    local result = lookup(table.concat(backoff, " "))
+    local total, successors = 0, 0
+    for j = 2, #result, 2 do
+      local count = tonumber(result[j]) or 0
+      if count > 0 then
+        total      = total + count
+        successors = successors + 1
+      end
+    end
+    if total > 0 then table.insert(levels, { result, total, successors }) end
+    table.remove(backoff, 1)
   end
-
-  local generated      = split_tokens(start_prefix)
-  local configured_n   = tonumber(redis.call('HGET', config_key(guild_id), 'n_gram_size') or "0") or 0
+  if #levels == 0 then return {} end
+  if #levels == 1 then return levels[1][1] end
+
+  local probs, order = {}, {}
+  for i = #levels, 1, -1 do
+    local result, total = levels[i][1], levels[i][2]
+    local discount = i == #levels and 0 or smoothing
+    local lower    = discount * levels[i][3] / total
+    for _, word in ipairs(order) do
+      probs[word] = probs[word] * lower
+    end
+    for j = 1, #result, 2 do
+      local count = tonumber(result[j + 1]) or 0
+      if count > 0 then
+        local word = result[j]
+        if not probs[word] then
+          table.insert(order, word)
+          probs[word] = 0
+        end
+        probs[word] = probs[word] + math.max(count - discount, 0) / total
+      end
+    end
+  end
+
+  -- pick_next expects integer counts.
+  local next_words = {}
+  for _, word in ipairs(order) do
+    table.insert(next_words, word)
+    table.insert(next_words, tostring(math.max(1, math.floor(probs[word] * INTERPOLATION_SCALE))))
+  end
+  return next_words
+end
+
+-- ---------------------------------------------------------------------------
+-- do_generate_tokens (internal helper, shared by generate_markov + generate_rhyme)
+-- Returns (tokens_table, window) where window = n_gram_size - 1.
+-- Generation stops early when EOS is sampled; tokens may still contain BOS,
+-- so callers render them with join_output.
+-- Caller is responsible for seeding math.random.
+-- ---------------------------------------------------------------------------
+local function do_generate_tokens(guild_id, start_prefix, max_length, sampling)
+  if start_prefix == "" then return {}, 1 end
+
+  local generated      = split_tokens(start_prefix)
+  local configured_n   = configured_n_gram_size(guild_id)
   local inferred_n     = #generated + 1
   local n_gram_size    = configured_n > 0 and configured_n or inferred_n
   local window         = math.max(1, n_gram_size - 1)
   local current_prefix = start_prefix
-
-  -- candidates[pos] = list of {word, weight} rhyming successors observed
-  -- in the HGETALL that produced generated[pos].
-  local candidates = {}
+  local smoothing      = sampling and sampling.smoothing or 0
 
   for _ = 1, max_length do
-    local backoff    = split_tokens(current_prefix)
-    local next_words = {}
-    local found      = false
+    local next_words = next_distribution(guild_id, split_tokens(current_prefix), smoothing)
+    if #next_words == 0 then break end
+
+    local chosen = pick_next(next_words, sampling)
+
+    if not chosen or chosen == EOS then break end
+
+    table.insert(generated, chosen)
+
+    local new_prefix = {}
+    local start_idx  = math.max(1, #generated - window + 1)
+    for k = start_idx, #generated do
+      table.insert(new_prefix, generated[k])
+    end
+    current_prefix = table.concat(new_prefix, " ")
+  end
+
+  return generated, window
+end
+
+-- ---------------------------------------------------------------------------
+-- generate_markov  KEYS[1]=guild_id
+--                  ARGV[1]=start_prefix  ARGV[2]=max_length
+--                  ARGV[3]=temperature  ARGV[4]=top_k  ARGV[5]=top_p  ARGV[6]=smoothing  (optional)
+-- ---------------------------------------------------------------------------
+local function generate_markov(keys, args)
+  local guild_id     = keys[1]
+  local start_prefix = args[1] or ""
+  local max_length   = tonumber(args[2]) or 20
+
+  if start_prefix == "" then return "" end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  local generated = do_generate_tokens(guild_id, start_prefix, max_length, parse_sampling(args, 3))
+  return join_output(generated)
+end
+
+-- ---------------------------------------------------------------------------
+-- generate_around  KEYS[1]=guild_id
+--                  ARGV[1]=seed  ARGV[2]=max_length
+--                  ARGV[3]=temperature  ARGV[4]=top_k  ARGV[5]=top_p  ARGV[6]=smoothing  (optional)
+--
+-- Seeded generation where the seed can land anywhere in the sentence: picks a
+-- state containing the seed, walks the reverse table back towards BOS, then
+-- generates forward towards EOS. At most half of max_length is spent walking
+-- back. Chains trained before reverse transitions existed simply generate
+-- forward from the seed. Returns "" when no state contains the seed.
+-- ---------------------------------------------------------------------------
+local function generate_around(keys, args)
+  local guild_id   = keys[1]
+  local seed       = args[1] or ""
+  local max_length = tonumber(args[2]) or 20
+  local sampling   = parse_sampling(args, 3)
 
+  if seed == "" then return "" end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  local anchor = find_seeded_prefix(guild_id, seed)
+  if not anchor then return "" end
+
+  local left         = split_tokens(anchor)
+  local configured_n = configured_n_gram_size(guild_id)
+  local window       = math.max(1, (configured_n > 0 and configured_n or #left + 1) - 1)
+
+  local walked = 0
+  for _ = 1, math.floor(max_length / 2) do
+    local backoff = {}
+    for k = 1, math.min(window, #left) do
+      backoff[k] = left[k]
+    end
+
+    local prev_words = {}
     while #backoff > 0 do
-      local bk     = table.concat(backoff, " ")
-      local result = redis.call('HGETALL', state_key(guild_id, bk))
+      local result = redis.call('HGETALL', rstate_key(guild_id, table.concat(backoff, " ")))
       if #result > 0 then
-        next_words = result
-        found      = true
+        prev_words = result
         break
       end
-      table.remove(backoff, 1)
+      table.remove(backoff)
     end
 
-    if not found then break end
+    if #prev_words == 0 then break end
 
-    local total_weight = 0
-    for j = 2, #next_words, 2 do
-      total_weight = total_weight + tonumber(next_words[j])
-    end
-    if total_weight == 0 then break end
+    local chosen = pick_next(prev_words, sampling)
+    if not chosen or chosen == BOS then break end
 
-    local target     = math.random(1, total_weight)
-    local cumulative = 0
-    local chosen     = nil
-    for j = 1, #next_words, 2 do
-      cumulative = cumulative + tonumber(next_words[j + 1])
-      if target <= cumulative then
-        chosen = next_words[j]
-        break
+    table.insert(left, 1, chosen)
+    walked = walked + 1
+  end
+
+  local tail = {}
+  for k = math.max(1, #left - window + 1), #left do
+    table.insert(tail, left[k])
+  end
+
+  local forward = do_generate_tokens(guild_id, table.concat(tail, " "), max_length - walked, sampling)
+  for k = #tail + 1, #forward do
+    table.insert(left, forward[k])
+  end
+  return join_output(left)
+end
+
+-- ---------------------------------------------------------------------------
+-- generate_rhyme  KEYS[1]=guild_id
+--                 ARGV[1]=start_prefix  ARGV[2]=max_length
+--                 ARGV[3]=rhyme_key  ARGV[4]=rhyme_word (lower-cased)
+--                 ARGV[5]=temperature  ARGV[6]=top_k  ARGV[7]=top_p  ARGV[8]=smoothing  (optional)
+--
+-- Single-pass rhyme generator. Rhyming tokens are the ones listed in the
+-- rhyme index under rhyme_key, minus rhyme_word itself. Forward-generates
+-- exactly once, tracking per-step rhyming successors observed in each
+-- HGETALL. At the end, walks recorded positions backward from the tail and
+-- accepts the latest position at or above max_length/2, swapping in a
+-- weighted rhyming pick and truncating. When no successor rhymes, a weighted
+-- pick from the index is appended instead; with an empty index the plain
+-- generated text is returned.
+-- ---------------------------------------------------------------------------
+local function generate_rhyme(keys, args)
+  local guild_id     = keys[1]
+  local start_prefix = args[1] or ""
+  local max_length   = tonumber(args[2]) or 20
+  local key          = args[3] or ""
+  local rhyme_word   = args[4] or ""
+  local sampling     = parse_sampling(args, 5)
+
+  if start_prefix == "" then return "" end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  -- rhymes[token] = how often the token was trained.
+  local rhymes = {}
+  local found_rhyme = false
+  if key ~= "" then
+    local row = redis.call('HGETALL', rhyme_key(guild_id, key))
+    for j = 1, #row, 2 do
+      local w = tonumber(row[j + 1]) or 0
+      if w > 0 and string.lower(row[j]) ~= rhyme_word then
+        rhymes[row[j]] = w
+        found_rhyme    = true
       end
     end
-    if not chosen then break end
+  end
+
+  if not found_rhyme then
+    local toks = do_generate_tokens(guild_id, start_prefix, max_length, sampling)
+    return join_output(toks)
+  end
+
+  local generated      = split_tokens(start_prefix)
+  local configured_n   = configured_n_gram_size(guild_id)
+  local inferred_n     = #generated + 1
+  local n_gram_size    = configured_n > 0 and configured_n or inferred_n
+  local window         = math.max(1, n_gram_size - 1)
+  local current_prefix = start_prefix
+  local smoothing      = sampling and sampling.smoothing or 0
+
+  -- candidates[pos] = list of {word, weight} rhyming successors observed
+  -- in the HGETALL that produced generated[pos].
+  local candidates = {}
+
+  for _ = 1, max_length do
+    local next_words = next_distribution(guild_id, split_tokens(current_prefix), smoothing)
+    if #next_words == 0 then break end
+
+    local chosen = pick_next(next_words, sampling)
+    if not chosen or chosen == EOS then break end
 
     table.insert(generated, chosen)
     local pos = #generated
 
     local rhyming = nil
     for j = 1, #next_words, 2 do
-      if ends_with(next_words[j]) then
+      if rhymes[next_words[j]] then
         local w = tonumber(next_words[j + 1]) or 0
         if w > 0 then
           rhyming = rhyming or {}
@@ -402,38 +1110,297 @@ local function generate_rhyme(keys, args)
   for swap_pos = #generated, min_swap_pos, -1 do
     local rhyming_options = candidates[swap_pos]
     if rhyming_options then
-      local weight_sum = 0
-      for _, option in ipairs(rhyming_options) do
-        weight_sum = weight_sum + option[2]
-      end
-      if weight_sum > 0 then
-        local pick_target = math.random(1, weight_sum)
-        local pick_cum    = 0
-        for _, option in ipairs(rhyming_options) do
-          pick_cum = pick_cum + option[2]
-          if pick_target <= pick_cum then
-            local rhyme_word = option[1]
-            if ends_with(rhyme_word) then
-              generated[swap_pos] = rhyme_word
-              local truncated = {}
-              for i = 1, swap_pos do
-                table.insert(truncated, generated[i])
-              end
-              return table.concat(truncated, " ")
+      local pick = pick_next_weighted(rhyming_options)
+      if pick then
+        generated[swap_pos] = pick
+        local truncated = {}
+        for i = 1, swap_pos do
+          table.insert(truncated, generated[i])
+        end
+        return join_output(truncated)
+      end
+    end
+  end
+
+  -- Fallback: no rhyming successor found anywhere. Close the line with a
+  -- rhyming token from the index so the output still ends on the rhyme.
+  local last = generated[#generated]
+  if last and not rhymes[last] then
+    local options = {}
+    for word, w in pairs(rhymes) do
+      table.insert(options, { word, w })
+    end
+    table.sort(options, function(a, b) return a[1] < b[1] end)
+    local pick = pick_next_weighted(options)
+    if pick then
+      if is_marker(last) then
+        generated[#generated] = pick
+      else
+        table.insert(generated, pick)
+      end
+    end
+  end
+  return join_output(generated)
+end
+
+-- ---------------------------------------------------------------------------
+-- generate_crossover  KEYS=guild_ids (2 or more)
+--                     ARGV[1]=start_prefix  ARGV[2]=max_length
+--                     ARGV[3..2+#KEYS]=per-chain weights
+--                     then temperature, top_k, top_p, smoothing  (optional)
+--
+-- Generates from a blend of several chains. At every step each chain looks
+-- up the current prefix on its own (see next_distribution); the successor
+-- distributions found are normalised per chain, scaled by the
+-- chain's weight and summed before sampling. Generation stops when no chain
+-- knows any suffix. The window is the largest configured n-gram size.
+-- ---------------------------------------------------------------------------
+local CROSSOVER_SCALE = 1000000
+local function generate_crossover(keys, args)
+  local start_prefix = args[1] or ""
+  local max_length   = tonumber(args[2]) or 20
+  local weights      = {}
+  for i = 1, #keys do
+    weights[i] = math.max(0, tonumber(args[2 + i]) or 0)
+  end
+  local sampling = parse_sampling(args, 3 + #keys)
+
+  if start_prefix == "" then return "" end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  local generated = split_tokens(start_prefix)
+  local n_gram_size = #generated + 1
+  for _, guild_id in ipairs(keys) do
+    local configured_n = configured_n_gram_size(guild_id)
+    if configured_n > n_gram_size then n_gram_size = configured_n end
+  end
+  local window         = math.max(1, n_gram_size - 1)
+  local current_prefix = start_prefix
+  local smoothing      = sampling and sampling.smoothing or 0
+
+  for _ = 1, max_length do
+    local mixed = {}
+    local order = {}
+    for i, guild_id in ipairs(keys) do
+      if weights[i] > 0 then
+        local result = next_distribution(guild_id, split_tokens(current_prefix), smoothing)
+        local total  = 0
+        for j = 2, #result, 2 do
+          total = total + (tonumber(result[j]) or 0)
+        end
+        if total > 0 then
+          for j = 1, #result, 2 do
+            local share = (tonumber(result[j + 1]) or 0) / total * weights[i]
+            if share > 0 then
+              if not mixed[result[j]] then table.insert(order, result[j]) end
+              mixed[result[j]] = (mixed[result[j]] or 0) + share
             end
-            break
           end
         end
       end
     end
+    if #order == 0 then break end
+
+    -- pick_next expects integer counts.
+    local next_words = {}
+    for _, word in ipairs(order) do
+      table.insert(next_words, word)
+      table.insert(next_words, tostring(math.max(1, math.floor(mixed[word] * CROSSOVER_SCALE))))
+    end
+    local chosen = pick_next(next_words, sampling)
+    if not chosen or chosen == EOS then break end
+
+    table.insert(generated, chosen)
+    local new_prefix = {}
+    for k = math.max(1, #generated - window + 1), #generated do
+      table.insert(new_prefix, generated[k])
+    end
+    current_prefix = table.concat(new_prefix, " ")
+  end
+
+  return join_output(generated)
+end
+
+-- ---------------------------------------------------------------------------
+-- generate_constrained  KEYS[1]=guild_id
+--                       ARGV[1]=start_prefix
+--                       ARGV[2]=min_words  ARGV[3]=max_words  ARGV[4]=max_chars  (0 = unbounded)
+--                       ARGV[5]=end_on_sentence (1 = must stop on a sampled EOS)
+--                       ARGV[6]=temperature  ARGV[7]=top_k  ARGV[8]=top_p  ARGV[9]=smoothing
+--                       ARGV[10]=required_count
+--                       ARGV[11..10+required_count]=required tokens, then banned tokens
+--
+-- Generation with constraints enforced at every step rather than by clipping
+-- afterwards: successors that are banned, or would overrun the word or
+-- character budget, are never sampled, and EOS is only allowed once the
+-- minimum length is reached and every required token appeared. A missing
+-- required token is taken as soon as the chain offers it. On a dead end the
+-- last token is undone and excluded at that position (depth-first
+-- backtracking), within CONSTRAINED_STEP_BUDGET lookups. Words are tokens
+-- holding a letter or digit; characters are counted on the space-joined
+-- output. Returns "" when the start prefix already breaks a constraint or no
+-- satisfying text was found.
+-- ---------------------------------------------------------------------------
+local CONSTRAINED_STEP_BUDGET = 400
+local CONSTRAINED_MAX_TOKENS  = 200
+
+local function is_word_token(token)
+  return string.find(token, "[%w\128-\255]") ~= nil
+end
+
+local function utf8_len(s)
+  return (string.len(string.gsub(s, "[\128-\191]", "")))
+end
+
+local function generate_constrained(keys, args)
+  local guild_id        = keys[1]
+  local start_prefix    = args[1] or ""
+  local min_words       = math.max(0, tonumber(args[2]) or 0)
+  local max_words       = math.max(0, tonumber(args[3]) or 0)
+  local max_chars       = math.max(0, tonumber(args[4]) or 0)
+  local end_on_sentence = args[5] == "1"
+  local sampling        = parse_sampling(args, 6)
+  local required_count  = tonumber(args[10]) or 0
+
+  if start_prefix == "" then return "" end
+
+  local required, missing = {}, 0
+  for i = 11, 10 + required_count do
+    if args[i] and not required[args[i]] then
+      required[args[i]] = 0
+      missing = missing + 1
+    end
+  end
+  local banned = {}
+  for i = 11 + required_count, #args do
+    banned[args[i]] = true
+  end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  local generated = {}
+  local words, chars = 0, 0
+
+  local function push(token)
+    table.insert(generated, token)
+    if is_marker(token) then return end
+    if is_word_token(token) then words = words + 1 end
+    if chars > 0 then chars = chars + 1 end
+    chars = chars + utf8_len(token)
+    if required[token] then
+      if required[token] == 0 then missing = missing - 1 end
+      required[token] = required[token] + 1
+    end
+  end
+
+  local function pop()
+    local token = table.remove(generated)
+    if is_marker(token) then return token end
+    if is_word_token(token) then words = words - 1 end
+    chars = chars - utf8_len(token)
+    if chars > 0 then chars = chars - 1 end
+    if required[token] then
+      required[token] = required[token] - 1
+      if required[token] == 0 then missing = missing + 1 end
+    end
+    return token
+  end
+
+  for _, token in ipairs(split_tokens(start_prefix)) do
+    if banned[token] then return "" end
+    push(token)
+  end
+  if (max_words > 0 and words > max_words) or (max_chars > 0 and chars > max_chars) then
+    return ""
+  end
+
+  local base           = #generated
+  local configured_n   = configured_n_gram_size(guild_id)
+  local window         = math.max(1, (configured_n > 0 and configured_n or base + 1) - 1)
+
+  local successors_cache = {}
+  local function successors()
+    local context = {}
+    for k = math.max(1, #generated - window + 1), #generated do
+      table.insert(context, generated[k])
+    end
+    local result = next_distribution(guild_id, context, sampling.smoothing, successors_cache)
+    if #result > 0 then return result end
+    return nil
+  end
+
+  local function can_end()
+    return words >= min_words and missing == 0
+  end
+
+  local function fits(token)
+    if is_word_token(token) and max_words > 0 and words + 1 > max_words then
+      return false
+    end
+    if max_chars > 0 and chars + (chars > 0 and 1 or 0) + utf8_len(token) > max_chars then
+      return false
+    end
+    return true
   end
 
-  -- Fallback: no rhyming successor found anywhere. Stitch the suffix directly
-  -- onto the last token so the output at least ends with the rhyme syllable.
-  if #generated > 0 and not ends_with(generated[#generated]) then
-    generated[#generated] = generated[#generated] .. suffix
+  -- excluded[d] holds the tokens already tried and undone at depth d.
+  local excluded = {}
+
+  for _ = 1, CONSTRAINED_STEP_BUDGET do
+    local depth = #generated - base + 1
+    excluded[depth] = excluded[depth] or {}
+
+    local chosen
+    local next_words = successors()
+    if not next_words then
+      -- The chain ends here, as a sentence would.
+      if can_end() then return join_output(generated) end
+    elseif depth <= CONSTRAINED_MAX_TOKENS then
+      local candidates = {}
+      for j = 1, #next_words, 2 do
+        local word = next_words[j]
+        if not excluded[depth][word] then
+          local allowed
+          if word == EOS then
+            allowed = can_end()
+          else
+            allowed = not is_marker(word) and not banned[word] and fits(word)
+          end
+          if allowed then
+            if required[word] == 0 then
+              chosen = word
+              break
+            end
+            table.insert(candidates, word)
+            table.insert(candidates, next_words[j + 1])
+          end
+        end
+      end
+      if not chosen and #candidates > 0 then
+        chosen = pick_next(candidates, sampling)
+      end
+      if not chosen and not end_on_sentence and can_end() then
+        -- Out of budget with everything satisfied: a clean cut.
+        return join_output(generated)
+      end
+    elseif not end_on_sentence and can_end() then
+      return join_output(generated)
+    end
+
+    if chosen == EOS then
+      return join_output(generated)
+    elseif chosen then
+      push(chosen)
+    else
+      if #generated == base then return "" end
+      excluded[depth] = nil
+      local undone = pop()
+      excluded[depth - 1][undone] = true
+    end
   end
-  return table.concat(generated, " ")
+
+  return ""
 end
 
 -- ---------------------------------------------------------------------------
@@ -452,26 +1419,27 @@ local function delete_markov(keys, args)
 
   local new_val = redis.call('HINCRBY', sk, next_word, -1)
 
-  local freed = #next_word + 16
+  local freed = #next_word + 16 + remove_reverse(guild_id, prefix, next_word)
+  if is_start_prefix(prefix) then
+    freed = freed + index_start_sub(guild_id, prefix, 1)
+  end
   if new_val <= 0 then
     redis.call('HDEL', sk, next_word)
     if redis.call('HLEN', sk) == 0 then
       redis.call('DEL', sk)
       redis.call('DECR', stats_prefix_key(guild_id))
-      freed = freed + #sk + 64
+      freed = freed + #sk + 64 + age_index_remove(guild_id, prefix)
     end
   end
 
-  -- Clamp byte counter to 0
-  local cur_bytes = tonumber(redis.call('GET', stats_bytes_key(guild_id)) or "0") or 0
-  redis.call('SET', stats_bytes_key(guild_id), math.max(0, cur_bytes - freed))
+  add_bytes(guild_id, -freed)
 
   return 1
 end
 
 -- ---------------------------------------------------------------------------
 -- get_stats_markov  KEYS[1]=guild_id
--- Returns {unique_prefixes, message_count, estimated_bytes}
+-- Returns {unique_prefixes, message_count, estimated_bytes, evicted_states}
 -- ---------------------------------------------------------------------------
 local function get_stats_markov(keys, _args)
   local guild_id = keys[1]
@@ -479,6 +1447,7 @@ local function get_stats_markov(keys, _args)
     tonumber(redis.call('GET', stats_prefix_key(guild_id)) or "0") or 0,
     tonumber(redis.call('GET', stats_msg_key(guild_id)) or "0") or 0,
     tonumber(redis.call('GET', stats_bytes_key(guild_id)) or "0") or 0,
+    tonumber(redis.call('GET', stats_evicted_key(guild_id)) or "0") or 0,
   }
 end
 
@@ -503,13 +1472,13 @@ local function reconcile_bytes_batch(keys, args)
   -- COMMIT phase: caller passes cursor="COMMIT" and ARGV[3]=<accumulated_total>
   if cursor == "COMMIT" then
     local total = tonumber(args[3]) or 0
-    redis.call('SET', stats_bytes_key(guild_id), total)
+    add_bytes(guild_id, total - get_bytes(stats_bytes_key(guild_id)))
     -- Also clean up legacy prefixes set if it exists
     redis.call('DEL', legacy_prefixes_set_key(guild_id))
     return { "0", total }
   end
 
-  local matchpat = state_keys_match(guild_id)
+  local matchpat = all_state_keys_match(guild_id)
   local partial  = 0
 
   local res      = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', batch_size)
@@ -529,6 +1498,12 @@ local function reconcile_bytes_batch(keys, args)
     add(stats_prefix_key(guild_id))
     add(stats_msg_key(guild_id))
     add(stats_bytes_key(guild_id))
+    add(start_index_key(guild_id))
+    add(start_classes_key(guild_id))
+    for _, class in ipairs(redis.call('HKEYS', start_classes_key(guild_id))) do
+      if class ~= START_CLASSES_BUILT then add(start_class_key(guild_id, class)) end
+    end
+    add(age_index_key(guild_id))
     add(media_key(guild_id, "gif"))
     add(media_key(guild_id, "image"))
     add(media_key(guild_id, "video"))
@@ -544,7 +1519,9 @@ end
 --                      ARGV[2]=cursor ("0" to start)
 --                      ARGV[3]=batch_size (keys per call, e.g. 200)
 --
--- Paginated replacement for the old blocking cap_branching.
+-- Paginated replacement for the old blocking cap_branching. Dropped forward
+-- edges take their reverse twins with them, and the bytes of every dropped
+-- edge leave estimated_bytes.
 -- Returns {next_cursor, removed_this_batch}.
 -- Keep calling until next_cursor == "0".
 -- ---------------------------------------------------------------------------
@@ -557,45 +1534,762 @@ local function cap_branching_batch(keys, args)
   if max_f <= 0 then return { "0", 0 } end
 
   local removed  = 0
-  local matchpat = state_keys_match(guild_id)
+  local matchpat = all_state_keys_match(guild_id)
+  local forward  = state_key(guild_id, "")
 
   local res      = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', batch_size)
   local next_c   = res[1]
+  local freed    = 0
   for _, sk in ipairs(res[2]) do
     local before = redis.call('HLEN', sk)
-    prune_transition_hash(sk, max_f)
+    if string.sub(sk, 1, #forward) == forward then
+      freed = freed + prune_forward(guild_id, string.sub(sk, #forward + 1), max_f)
+    else
+      local _, pruned = prune_transition_hash(sk, max_f)
+      freed = freed + edges_bytes(pruned)
+    end
     removed = removed + (before - redis.call('HLEN', sk))
   end
 
+  add_bytes(guild_id, -freed)
+
   return { next_c, removed }
 end
 
 -- ---------------------------------------------------------------------------
--- clear_guild  KEYS[1]=guild_id
+-- decay_batch  KEYS[1]=guild_id
+--              ARGV[1]=factor (weight multiplier, 0 <= factor < 1)
+--              ARGV[2]=cursor ("0" to start)
+--              ARGV[3]=batch_size (keys per call, e.g. 200)
+--
+-- Scales every forward transition weight by factor. Weights are integers, so
+-- each is rounded stochastically (floor(w * factor + rand)): the expected
+-- weight stays exact and rare transitions fade out over several passes
+-- instead of all vanishing on the first one. Transitions reaching 0 are
+-- removed; the start index, prefix and byte counters follow. Reverse
+-- transitions lose exactly what their forward twin lost and go with it, and
+-- reverse transitions left without a forward twin are dropped.
+-- Returns {next_cursor, removed_this_batch}. Keep calling until next_cursor == "0".
 -- ---------------------------------------------------------------------------
-local function clear_guild(keys, _args)
-  local guild_id = keys[1]
-  redis.call('DEL', legacy_prefixes_set_key(guild_id))
+local function decay_batch(keys, args)
+  local guild_id   = keys[1]
+  local factor     = tonumber(args[1]) or 1
+  local cursor     = args[2] or "0"
+  local batch_size = tonumber(args[3]) or 200
 
-  local cursor   = "0"
-  local matchpat = state_keys_match(guild_id)
+  if factor < 0 or factor >= 1 then return { "0", 0 } end
+
+  math.randomseed(tonumber(redis.call('TIME')[1]) + tonumber(redis.call('TIME')[2]))
+
+  local forward          = state_key(guild_id, "")
+  local removed          = 0
+  local freed            = 0
+  local dropped_prefixes = 0
+
+  local reverse          = rstate_key(guild_id, "")
+
+  local res    = redis.call('SCAN', cursor, 'MATCH', all_state_keys_match(guild_id), 'COUNT', batch_size)
+  local next_c = res[1]
+  for _, sk in ipairs(res[2]) do
+    local is_forward = string.sub(sk, 1, #forward) == forward
+    local flat       = redis.call('HGETALL', sk)
+    if is_forward then
+      local prefix = string.sub(sk, #forward + 1)
+      local lost   = 0
+      for i = 1, #flat, 2 do
+        local field  = flat[i]
+        local weight = tonumber(flat[i + 1]) or 0
+        local scaled = math.floor(weight * factor + math.random())
+        if scaled < weight then
+          local reverse_lost = weight - scaled
+          if scaled <= 0 then
+            scaled = 0
+            reverse_lost = math.huge
+            redis.call('HDEL', sk, field)
+            removed = removed + 1
+          else
+            redis.call('HSET', sk, field, scaled)
+          end
+          lost  = lost + (weight - scaled)
+          freed = freed + (weight - scaled) * (#field + 16)
+          freed = freed + remove_reverse(guild_id, prefix, field, reverse_lost)
+        end
+      end
+      if lost > 0 and is_start_prefix(prefix) then
+        freed = freed + index_start_sub(guild_id, prefix, lost)
+      end
+      if redis.call('EXISTS', sk) == 0 then
+        freed = freed + #sk + 64
+        dropped_prefixes = dropped_prefixes + 1
+        freed = freed + age_index_remove(guild_id, prefix)
+      end
+    elseif string.sub(sk, 1, #reverse) == reverse then
+      local suffix = string.sub(sk, #reverse + 1)
+      for i = 1, #flat, 2 do
+        local prefix, next_word = forward_pair(suffix, flat[i])
+        if redis.call('HEXISTS', state_key(guild_id, prefix), next_word) == 0 then
+          freed = freed + remove_reverse(guild_id, prefix, next_word, math.huge)
+        end
+      end
+    end
+  end
+
+  if dropped_prefixes > 0 then
+    local cur = tonumber(redis.call('GET', stats_prefix_key(guild_id)) or "0") or 0
+    redis.call('SET', stats_prefix_key(guild_id), math.max(0, cur - dropped_prefixes))
+  end
+  add_bytes(guild_id, -freed)
+
+  return { next_c, removed }
+end
+
+-- Deletes one forward state with its reverse transitions, start index entry
+-- and age index entry. Returns the bytes freed and whether the state existed.
+local function evict_state(guild_id, prefix)
+  local sk    = state_key(guild_id, prefix)
+  local flat  = redis.call('HGETALL', sk)
+  local freed = age_index_remove(guild_id, prefix)
+  if #flat == 0 then return freed, false end
+
+  local total = 0
+  for i = 1, #flat, 2 do
+    local weight = tonumber(flat[i + 1]) or 0
+    total = total + weight
+    freed = freed + (#flat[i] + 16) * weight + remove_reverse(guild_id, prefix, flat[i], weight)
+  end
+  if is_start_prefix(prefix) then
+    freed = freed + index_start_sub(guild_id, prefix, total)
+  end
+  redis.call('DEL', sk)
+  return freed + #sk + 64, true
+end
+
+-- ---------------------------------------------------------------------------
+-- evict_batch  KEYS[1]=guild_id
+--              ARGV[1]=policy ("least_used" or "oldest")
+--              ARGV[2]=low_water (estimated_bytes to get down to)
+--              ARGV[3]=cursor ("0" to start)
+--              ARGV[4]=batch_size (keys per call, e.g. 200)
+--              ARGV[5]=max_weight (least_used only)
+--
+-- Evicts whole forward states, reverse transitions and start index entries
+-- included, until estimated_bytes is at most low_water.
+-- least_used SCANs the states and evicts those whose total weight is at most
+-- max_weight; when a full pass did not free enough the caller raises
+-- max_weight, at least to the lightest_kept weight reported by the pass.
+-- oldest first SCANs for states missing from the age index: they were not
+-- trained since the index started, so they are older than any indexed one.
+-- It then walks the age index from the least recently trained state, with
+-- the cursor set to "ages". The scan is skipped when every state is indexed.
+-- Returns {next_cursor, evicted, estimated_bytes, lightest_kept}. Keep calling
+-- until next_cursor == "0": under low_water, or nothing left to evict.
+-- ---------------------------------------------------------------------------
+local function evict_batch(keys, args)
+  local guild_id   = keys[1]
+  local policy     = args[1]
+  local low_water  = tonumber(args[2]) or 0
+  local cursor     = args[3] or "0"
+  local batch_size = tonumber(args[4]) or 200
+  local max_weight = tonumber(args[5]) or 0
+
+  local bytes = tonumber(redis.call('GET', stats_bytes_key(guild_id)) or "0") or 0
+  if bytes <= low_water or (policy ~= "least_used" and policy ~= "oldest") then
+    return { "0", 0, bytes, 0 }
+  end
+
+  local ak            = age_index_key(guild_id)
+  local evicted       = 0
+  local freed         = 0
+  local lightest_kept = 0
+  local done          = false
+
+  -- Evicts one state; true once estimated_bytes reached low_water.
+  local function evict(prefix)
+    local f, existed = evict_state(guild_id, prefix)
+    freed = freed + f
+    if existed then evicted = evicted + 1 end
+    return bytes - freed <= low_water
+  end
+
+  if policy == "oldest" and cursor == "0" then
+    local prefixes = tonumber(redis.call('GET', stats_prefix_key(guild_id)) or "0") or 0
+    if redis.call('ZCARD', ak) >= prefixes then cursor = "ages" end
+  end
+
+  local next_c = "0"
+  if cursor == "ages" then
+    local oldest = redis.call('ZRANGE', ak, 0, batch_size - 1)
+    for _, prefix in ipairs(oldest) do
+      done = evict(prefix)
+      if done then break end
+    end
+    if #oldest > 0 then next_c = "ages" end
+  else
+    local res = redis.call('SCAN', cursor, 'MATCH', state_keys_match(guild_id), 'COUNT', batch_size)
+    next_c = res[1]
+    for _, sk in ipairs(res[2]) do
+      local prefix = prefix_from_state_key(sk)
+      local pick
+      if policy == "oldest" then
+        pick = not redis.call('ZSCORE', ak, prefix)
+      else
+        local total = 0
+        for _, w in ipairs(redis.call('HVALS', sk)) do
+          total = total + (tonumber(w) or 0)
+        end
+        pick = total <= max_weight
+        if not pick and (lightest_kept == 0 or total < lightest_kept) then
+          lightest_kept = total
+        end
+      end
+      if pick then
+        done = evict(prefix)
+        if done then break end
+      end
+    end
+    if policy == "oldest" and next_c == "0" then next_c = "ages" end
+  end
+
+  if evicted > 0 then
+    local cur = tonumber(redis.call('GET', stats_prefix_key(guild_id)) or "0") or 0
+    redis.call('SET', stats_prefix_key(guild_id), math.max(0, cur - evicted))
+    redis.call('INCRBY', stats_evicted_key(guild_id), evicted)
+  end
+  bytes = add_bytes(guild_id, -freed)
+
+  if done then next_c = "0" end
+  return { next_c, evicted, bytes, lightest_kept }
+end
+
+-- ---------------------------------------------------------------------------
+-- analyze_batch  KEYS[1]=guild_id
+--                ARGV[1]=cursor ("0" to start)
+--                ARGV[2]=batch_size (keys per call, e.g. 200)
+--                ARGV[3]=top_n (tokens and prefixes to rank)
+--
+-- Read-only structural analysis of the forward chain, one SCAN page per call.
+-- For the states of the page it returns
+--   {next_cursor, states, transitions, weight, entropy_sum, successors,
+--    dead_ends, histogram, top_prefixes, top_tokens}
+-- where transitions counts distinct (prefix, next) pairs, entropy_sum is the
+-- sum of per-state Shannon entropies in bits (a string, Lua numbers would be
+-- truncated), successors counts non-EOS transitions and dead_ends those whose
+-- shifted prefix has no state (generation has to back off there). histogram
+-- buckets states by branching factor: 1, 2, 3-4, 5-8, ... 129+. top_prefixes
+-- is the page's top_n states by total weight as a flat {prefix, weight} list;
+-- the caller merges pages. Token weights are summed across pages in a scratch
+-- sorted set, so top_tokens is only filled on the last page.
+-- Keep calling until next_cursor == "0".
+-- ---------------------------------------------------------------------------
+local ANALYSIS_BUCKETS = 9
+
+local function analyze_batch(keys, args)
+  local guild_id   = keys[1]
+  local cursor     = args[1] or "0"
+  local batch_size = tonumber(args[2]) or 200
+  local top_n      = tonumber(args[3]) or 10
+  local scratch    = analysis_tokens_key(guild_id)
+
+  if cursor == "0" then redis.call('DEL', scratch) end
+
+  local states, transitions, weight, entropy_sum = 0, 0, 0, 0
+  local successors, dead_ends = 0, 0
+  local histogram = {}
+  for b = 1, ANALYSIS_BUCKETS do histogram[b] = 0 end
+  local prefixes = {}
+  local tokens   = {}
+
+  local res    = redis.call('SCAN', cursor, 'MATCH', state_keys_match(guild_id), 'COUNT', batch_size)
+  local next_c = res[1]
+  for _, sk in ipairs(res[2]) do
+    local flat = redis.call('HGETALL', sk)
+    if #flat > 0 then
+      local prefix = prefix_from_state_key(sk)
+      local shifted = split_tokens(prefix)
+      table.remove(shifted, 1)
+      local shifted_prefix = table.concat(shifted, " ")
+
+      local total, branches = 0, #flat / 2
+      for i = 2, #flat, 2 do
+        total = total + (tonumber(flat[i]) or 0)
+      end
+      for i = 1, #flat, 2 do
+        local next_word = flat[i]
+        local w = tonumber(flat[i + 1]) or 0
+        if total > 0 and w > 0 then
+          local p = w / total
+          entropy_sum = entropy_sum - p * math.log(p) / math.log(2)
+        end
+        if next_word ~= EOS then
+          successors = successors + 1
+          local target = next_word
+          if shifted_prefix ~= "" then target = shifted_prefix .. " " .. next_word end
+          if redis.call('EXISTS', state_key(guild_id, target)) == 0 then
+            dead_ends = dead_ends + 1
+          end
+          tokens[next_word] = (tokens[next_word] or 0) + w
+        end
+      end
+
+      local bucket = 1
+      while bucket < ANALYSIS_BUCKETS and branches > 2 ^ (bucket - 1) do
+        bucket = bucket + 1
+      end
+      histogram[bucket] = histogram[bucket] + 1
+
+      states      = states + 1
+      transitions = transitions + branches
+      weight      = weight + total
+      table.insert(prefixes, { prefix, total })
+    end
+  end
+
+  for token, w in pairs(tokens) do
+    redis.call('ZINCRBY', scratch, w, token)
+  end
+  if next(tokens) then redis.call('PEXPIRE', scratch, 3600000) end
+
+  table.sort(prefixes, function(a, b) return a[2] > b[2] end)
+  local top_prefixes = {}
+  for i = 1, math.min(top_n, #prefixes) do
+    table.insert(top_prefixes, prefixes[i][1])
+    table.insert(top_prefixes, prefixes[i][2])
+  end
+
+  local top_tokens = {}
+  if next_c == "0" then
+    if top_n > 0 then
+      top_tokens = redis.call('ZREVRANGE', scratch, 0, top_n - 1, 'WITHSCORES')
+    end
+    redis.call('DEL', scratch)
+  end
+
+  return { next_c, states, transitions, weight, tostring(entropy_sum), successors,
+    dead_ends, histogram, top_prefixes, top_tokens }
+end
+
+-- ---------------------------------------------------------------------------
+-- backfill_start_index  KEYS[1]=guild_id
+--                       ARGV[1]=cursor ("0" to start)
+--                       ARGV[2]=batch_size (keys per call, e.g. 200)
+--                       ARGV[3]=mode ("bos" or "all", default "bos")
+--
+-- One-time, paginated rebuild of the start-prefix index for guilds trained
+-- before it existed. Each BOS state is indexed with its total outgoing weight;
+-- re-running is safe because weights are overwritten, not incremented.
+-- Chains trained before sentence markers have no BOS state: mode "all"
+-- indexes every forward state instead, since any of them could open a
+-- message back then.
+-- Returns {next_cursor, indexed_this_batch}. Keep calling until next_cursor == "0".
+-- ---------------------------------------------------------------------------
+local function backfill_start_index(keys, args)
+  local guild_id   = keys[1]
+  local cursor     = args[1] or "0"
+  local batch_size = tonumber(args[2]) or 200
+  local matchpat   = start_state_keys_match(guild_id)
+  if args[3] == "all" then matchpat = state_keys_match(guild_id) end
+
+  local ik      = start_index_key(guild_id)
+  local indexed = 0
+  local added   = 0
+
+  local res     = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', batch_size)
+  local next_c  = res[1]
+  for _, sk in ipairs(res[2]) do
+    local vals  = redis.call('HVALS', sk)
+    local total = 0
+    for _, v in ipairs(vals) do
+      total = total + (tonumber(v) or 0)
+    end
+    if total > 0 then
+      local prefix = prefix_from_state_key(sk)
+      start_class_update(guild_id, prefix, tonumber(redis.call('HGET', ik, prefix)) or 0, total)
+      if redis.call('HSET', ik, prefix, total) == 1 then
+        added = added + #prefix + 16
+      end
+      indexed = indexed + 1
+    end
+  end
+
+  add_bytes(guild_id, added)
+
+  return { next_c, indexed }
+end
+
+-- Deletes every key matching matchpat, 200 keys per SCAN page.
+local function delete_matching(matchpat)
+  local cursor = "0"
   repeat
     local res = redis.call('SCAN', cursor, 'MATCH', matchpat, 'COUNT', 200)
     cursor = res[1]
-    for _, sk in ipairs(res[2]) do
-      redis.call('DEL', sk)
+    for _, k in ipairs(res[2]) do
+      redis.call('DEL', k)
     end
   until cursor == "0"
+end
+
+-- ---------------------------------------------------------------------------
+-- clear_channel_chains  KEYS[1]=guild_id
+-- Drops every channel sub-chain of a guild, leaving the guild chain intact.
+-- ---------------------------------------------------------------------------
+local function clear_channel_chains(keys, _args)
+  for _, matchpat in ipairs(sub_chain_keys_matches(keys[1], CHANNEL_SEP)) do
+    delete_matching(matchpat)
+  end
+  return 1
+end
+
+-- ---------------------------------------------------------------------------
+-- clear_language_chains  KEYS[1]=guild_id
+-- Drops every language sub-chain of a guild, leaving the guild chain intact.
+-- ---------------------------------------------------------------------------
+local function clear_language_chains(keys, _args)
+  for _, matchpat in ipairs(sub_chain_keys_matches(keys[1], LANGUAGE_SEP)) do
+    delete_matching(matchpat)
+  end
+  return 1
+end
+
+-- ---------------------------------------------------------------------------
+-- drop_author_chain  KEYS[1]=guild_id  ARGV[1]=user_id
+-- Deletes one member's author sub-chain, stats included, and takes its size
+-- off the author group counter.
+-- ---------------------------------------------------------------------------
+local function drop_author_chain(keys, args)
+  if (args[1] or "") == "" then return 0 end
+  local chain_id = keys[1] .. AUTHOR_SEP .. args[1]
+  add_bytes(chain_id, -get_bytes(stats_bytes_key(chain_id)))
+  delete_matching("markov:" .. chain_id .. ":*")
+  delete_matching("stats:" .. chain_id .. ":*")
+  return 1
+end
+
+-- ---------------------------------------------------------------------------
+-- list_sub_chains  KEYS[1]=guild_id
+--                  ARGV[1]=cursor ("0" to start)
+--                  ARGV[2]=batch_size (keys per call, e.g. 200)
+--
+-- Paginated listing of a guild's channel, language and author sub-chains that
+-- hold anything, found by their byte counters (the group counters are not
+-- chains and are skipped).
+-- Returns {next_cursor, {chain_id, ...}}. Keep calling until next_cursor == "0".
+-- ---------------------------------------------------------------------------
+local function list_sub_chains(keys, args)
+  local guild_id   = keys[1]
+  local cursor     = args[1] or "0"
+  local batch_size = tonumber(args[2]) or 200
+
+  local prefix = "stats:"
+  local suffix = ":estimated_bytes"
+  local ids    = {}
+
+  local res    = redis.call('SCAN', cursor, 'MATCH', prefix .. guild_id .. "[/#@]?*" .. suffix, 'COUNT', batch_size)
+  for _, k in ipairs(res[2]) do
+    if get_bytes(k) > 0 then
+      table.insert(ids, string.sub(k, #prefix + 1, #k - #suffix))
+    end
+  end
+
+  return { res[1], ids }
+end
+
+-- ---------------------------------------------------------------------------
+-- export_states_batch  KEYS[1]=guild_id
+--                      ARGV[1]=cursor ("0" to start)
+--                      ARGV[2]=batch_size (keys per call, e.g. 200)
+--
+-- Paginated read of the forward transition table for chain export. Reverse
+-- transitions and the start index are derived data and rebuilt on import.
+-- Returns {next_cursor, {{prefix, next_1, count_1, next_2, count_2, ...}, ...}}.
+-- Keep calling until next_cursor == "0".
+-- ---------------------------------------------------------------------------
+local function export_states_batch(keys, args)
+  local guild_id   = keys[1]
+  local cursor     = args[1] or "0"
+  local batch_size = tonumber(args[2]) or 200
+
+  local forward = state_key(guild_id, "")
+  local rows    = {}
+
+  local res     = redis.call('SCAN', cursor, 'MATCH', state_keys_match(guild_id), 'COUNT', batch_size)
+  for _, sk in ipairs(res[2]) do
+    local row = redis.call('HGETALL', sk)
+    if #row > 0 then
+      table.insert(row, 1, string.sub(sk, #forward + 1))
+      table.insert(rows, row)
+    end
+  end
+
+  return { res[1], rows }
+end
+
+-- ---------------------------------------------------------------------------
+-- export_media_batch  KEYS[1]=guild_id
+--                     ARGV[1]=kind (gif | image | video | generic)
+--                     ARGV[2]=cursor ("0" to start)
+--                     ARGV[3]=batch_size (members per call, e.g. 500)
+--
+-- Paginated SSCAN of one media set for chain export.
+-- Returns {next_cursor, {url, ...}}. Keep calling until next_cursor == "0".
+-- ---------------------------------------------------------------------------
+local function export_media_batch(keys, args)
+  local cursor     = args[2] or "0"
+  local batch_size = tonumber(args[3]) or 500
+  return redis.call('SSCAN', media_key(keys[1], args[1]), cursor, 'COUNT', batch_size)
+end
+
+-- ---------------------------------------------------------------------------
+-- Novelty index  (hash at novelty:<guild_id>)
+-- field = fingerprint of a stored message or of one of its k-token runs
+-- (hashed in Go), value = how many stored messages produced it. Generated
+-- text is checked against it to avoid repeating real messages verbatim.
+-- Not counted in estimated_bytes: it is not part of the chain.
+-- ---------------------------------------------------------------------------
+
+-- novelty_add  KEYS[1]=guild_id  ARGV[1]=delta (1 = index, -1 = unindex)
+--              ARGV[2..N]=fingerprints
+local function novelty_add(keys, args)
+  local nk    = novelty_key(keys[1])
+  local delta = tonumber(args[1]) or 1
+  for i = 2, #args do
+    if redis.call('HINCRBY', nk, args[i], delta) <= 0 then
+      redis.call('HDEL', nk, args[i])
+    end
+  end
+  return 1
+end
+
+-- novelty_match  KEYS[1]=guild_id  ARGV[1..N]=fingerprints
+-- Returns {1 | 0, ...}: whether each fingerprint is indexed.
+local function novelty_match(keys, args)
+  local nk  = novelty_key(keys[1])
+  local out = {}
+  for i = 1, #args do
+    out[i] = redis.call('HEXISTS', nk, args[i])
+  end
+  return out
+end
+
+-- novelty_clear  KEYS[1]=guild_id
+local function novelty_clear(keys, _args)
+  redis.call('DEL', novelty_key(keys[1]))
+  return 1
+end
+
+-- ---------------------------------------------------------------------------
+-- Rhyme index  (hashes at rhyme:<guild_id>:<rhyme_key>)
+-- field = a trained token, value = how often it was trained. Rhyme keys are
+-- computed in Go (internal/rhyme) for the chain's language; generate_rhyme
+-- reads one hash to know which successors rhyme.
+-- Not counted in estimated_bytes: it is not part of the chain.
+-- ---------------------------------------------------------------------------
+
+-- rhyme_add  KEYS[1]=guild_id
+--            ARGV = rhyme_key, token, delta triples
+local function rhyme_add(keys, args)
+  local guild_id = keys[1]
+  for i = 1, #args - 2, 3 do
+    local rk = rhyme_key(guild_id, args[i])
+    if redis.call('HINCRBY', rk, args[i + 1], tonumber(args[i + 2]) or 1) <= 0 then
+      redis.call('HDEL', rk, args[i + 1])
+    end
+  end
+  return 1
+end
+
+-- rhyme_clear  KEYS[1]=guild_id
+local function rhyme_clear(keys, _args)
+  delete_matching(rhyme_key(keys[1], "*"))
+  return 1
+end
+
+-- ---------------------------------------------------------------------------
+-- Keyword index  (hash at keywords:<guild_id>, counter at keywords:<guild_id>:docs)
+-- field = a trained word token, value = how many trained messages contain it
+-- (document frequency); the counter holds how many messages were indexed.
+-- pick_keywords ranks the words of a message by how rare they are in the
+-- guild, so mention replies are seeded from what the user talked about.
+-- Not counted in estimated_bytes: it is not part of the chain.
+-- ---------------------------------------------------------------------------
+
+-- keyword_add  KEYS[1]=guild_id
+--              ARGV[1]=messages delta, then token, delta pairs
+local function keyword_add(keys, args)
+  local guild_id = keys[1]
+  local dk = keyword_docs_key(guild_id)
+  if redis.call('INCRBY', dk, tonumber(args[1]) or 0) <= 0 then
+    redis.call('DEL', dk)
+  end
+  local kk = keyword_key(guild_id)
+  for i = 2, #args - 1, 2 do
+    if redis.call('HINCRBY', kk, args[i], tonumber(args[i + 1]) or 1) <= 0 then
+      redis.call('HDEL', kk, args[i])
+    end
+  end
+  return 1
+end
+
+-- keyword_clear  KEYS[1]=guild_id
+local function keyword_clear(keys, _args)
+  redis.call('DEL', keyword_key(keys[1]), keyword_docs_key(keys[1]))
+  return 1
+end
+
+-- pick_keywords  KEYS[1]=guild_id
+--                ARGV[1]=limit, then token, occurrences pairs
+-- Returns up to limit tokens of the message that the chain has a state for,
+-- best first. A token scores occurrences * log(1 + messages / df), so rare
+-- words beat common ones; tokens the index never saw are skipped.
+local function pick_keywords(keys, args)
+  local guild_id = keys[1]
+  local limit    = math.max(1, tonumber(args[1]) or 1)
+  local docs     = tonumber(redis.call('GET', keyword_docs_key(guild_id)) or "0") or 0
+  local kk       = keyword_key(guild_id)
+
+  local scored = {}
+  for i = 2, #args - 1, 2 do
+    local token = args[i]
+    local df    = tonumber(redis.call('HGET', kk, token) or "0") or 0
+    if df > 0 and redis.call('EXISTS', state_key(guild_id, token)) == 1 then
+      local tf = tonumber(args[i + 1]) or 1
+      table.insert(scored, { token, tf * math.log(1 + docs / df) })
+    end
+  end
+  table.sort(scored, function(a, b)
+    if a[2] ~= b[2] then return a[2] > b[2] end
+    return a[1] < b[1]
+  end)
+
+  local out = {}
+  for i = 1, math.min(limit, #scored) do
+    out[i] = scored[i][1]
+  end
+  return out
+end
+
+-- ---------------------------------------------------------------------------
+-- Conversation memory  (list at conversation:<guild_id>/<channel_id>,
+-- counter at conversation:<guild_id>/<channel_id>:turns)
+-- The latest messages of a back-and-forth with the bot in one channel, oldest
+-- first, and how many times the bot answered in it. Both expire together once
+-- the conversation is idle for its TTL, which every answer renews.
+-- ---------------------------------------------------------------------------
+
+-- conversation_push  KEYS[1]=channel chain id
+--                    ARGV[1]=ttl_seconds  ARGV[2]=entries kept
+--                    ARGV[3..]=entries to append, oldest first
+-- Counts one answer. Returns the number of answers so far.
+local function conversation_push(keys, args)
+  local ck   = conversation_key(keys[1])
+  local tk   = conversation_turns_key(keys[1])
+  local ttl  = math.max(1, tonumber(args[1]) or 600)
+  local keep = math.max(1, tonumber(args[2]) or 1)
+  for i = 3, #args do
+    redis.call('RPUSH', ck, args[i])
+  end
+  redis.call('LTRIM', ck, -keep, -1)
+  local turns = redis.call('INCR', tk)
+  redis.call('EXPIRE', ck, ttl)
+  redis.call('EXPIRE', tk, ttl)
+  return turns
+end
+
+-- conversation_get  KEYS[1]=channel chain id  ->  {turns, entry, ...}
+local function conversation_get(keys, _args)
+  local out = { tonumber(redis.call('GET', conversation_turns_key(keys[1])) or "0") or 0 }
+  for _, entry in ipairs(redis.call('LRANGE', conversation_key(keys[1]), 0, -1)) do
+    table.insert(out, entry)
+  end
+  return out
+end
+
+-- ---------------------------------------------------------------------------
+-- clear_guild  KEYS[1]=guild_id
+-- Also drops the guild's channel, author and language sub-chains, its
+-- novelty, rhyme and keyword indexes and its conversations.
+-- ---------------------------------------------------------------------------
+local function clear_guild(keys, _args)
+  local guild_id = keys[1]
+  redis.call('DEL', legacy_prefixes_set_key(guild_id))
+  redis.call('DEL', start_index_key(guild_id))
+  drop_start_classes(guild_id)
+  redis.call('DEL', age_index_key(guild_id))
+
+  delete_matching(all_state_keys_match(guild_id))
+  clear_channel_chains(keys, _args)
+  clear_language_chains(keys, _args)
+  for _, matchpat in ipairs(sub_chain_keys_matches(guild_id, AUTHOR_SEP)) do
+    delete_matching(matchpat)
+  end
   redis.call('SET', stats_prefix_key(guild_id), 0)
   redis.call('SET', stats_msg_key(guild_id), 0)
-  redis.call('SET', stats_bytes_key(guild_id), 0)
+  add_bytes(guild_id, -get_bytes(stats_bytes_key(guild_id)))
+  redis.call('DEL', stats_evicted_key(guild_id))
   redis.call('DEL', media_key(guild_id, "gif"))
   redis.call('DEL', media_key(guild_id, "image"))
   redis.call('DEL', media_key(guild_id, "video"))
   redis.call('DEL', media_key(guild_id, "generic"))
+  redis.call('DEL', novelty_key(guild_id))
+  redis.call('DEL', analysis_key(guild_id))
+  rhyme_clear(keys, _args)
+  keyword_clear(keys, _args)
+  delete_matching(conversation_key(guild_id .. CHANNEL_SEP .. "*"))
   return 1
 end
 
+-- ---------------------------------------------------------------------------
+-- migrate_key_layout  KEYS[1]=guild_id (hash-tagged, no sub-chain)
+--                     ARGV[1]=namespace index (1-based)  ARGV[2]=cursor
+--                     ARGV[3]=batch_size
+--
+-- Moves one SCAN page of a guild's keys, sub-chains included, from the
+-- untagged layout ("markov:<guild_id>:...") to the hash-tagged one
+-- ("markov:{<guild_id>}:..."). The cached config is dropped instead of
+-- renamed, since it is rebuilt from SQLite. The old keys live in other slots,
+-- so this only runs on a standalone node, before moving to a cluster.
+-- Returns {next_namespace, next_cursor, moved}; next_namespace is 0 when done.
+-- ---------------------------------------------------------------------------
+local LEGACY_NAMESPACES = { "markov", "stats", "media", "fetching", "novelty", "rhyme", "analysis", "guild", "config" }
+local function migrate_key_layout(keys, args)
+  local tagged     = keys[1]
+  local raw        = string.gsub(tagged, "[{}]", "")
+  local ns_index   = tonumber(args[1]) or 1
+  local cursor     = args[2] or "0"
+  local batch_size = tonumber(args[3]) or 200
+
+  if raw == tagged or ns_index < 1 or ns_index > #LEGACY_NAMESPACES then
+    return { 0, "0", 0 }
+  end
+
+  local ns    = LEGACY_NAMESPACES[ns_index]
+  local moved = 0
+  local function move(key)
+    if ns == "config" then
+      redis.call('DEL', key)
+    else
+      redis.call('RENAME', key, ns .. ":" .. tagged .. string.sub(key, #ns + #raw + 2))
+    end
+    moved = moved + 1
+  end
+
+  -- Keys named after the bare guild id, like config:<guild_id>.
+  if cursor == "0" and redis.call('EXISTS', ns .. ":" .. raw) == 1 then
+    move(ns .. ":" .. raw)
+  end
+  local res = redis.call('SCAN', cursor, 'MATCH', ns .. ":" .. raw .. "[:/@#]*", 'COUNT', batch_size)
+  for _, key in ipairs(res[2]) do
+    move(key)
+  end
+
+  if res[1] ~= "0" then
+    return { ns_index, res[1], moved }
+  end
+  if ns_index == #LEGACY_NAMESPACES then
+    return { 0, "0", moved }
+  end
+  return { ns_index + 1, "0", moved }
+end
+
 -- ---------------------------------------------------------------------------
 -- Config cache  (Redis hash at config:<guild_id>)
 -- Fields are snake_case strings mirroring ChainConfig.
@@ -674,17 +2368,46 @@ end
 -- ---------------------------------------------------------------------------
 -- Registration
 -- ---------------------------------------------------------------------------
+redis.register_function{
+  function_name = 'library_version',
+  callback      = library_version,
+  flags         = { 'no-writes' },
+}
 redis.register_function('train_markov', train_markov)
 redis.register_function('train_batch', train_batch)
 redis.register_function('count_message', count_message)
 redis.register_function('find_prefix', find_prefix)
 redis.register_function('generate_markov', generate_markov)
+redis.register_function('generate_around', generate_around)
 redis.register_function('generate_rhyme', generate_rhyme)
+redis.register_function('generate_crossover', generate_crossover)
+redis.register_function('generate_constrained', generate_constrained)
 redis.register_function('delete_markov', delete_markov)
 redis.register_function('get_stats_markov', get_stats_markov)
 redis.register_function('reconcile_bytes_batch', reconcile_bytes_batch)
 redis.register_function('cap_branching_batch', cap_branching_batch)
+redis.register_function('decay_batch', decay_batch)
+redis.register_function('evict_batch', evict_batch)
+redis.register_function('analyze_batch', analyze_batch)
+redis.register_function('backfill_start_index', backfill_start_index)
+redis.register_function('export_states_batch', export_states_batch)
+redis.register_function('export_media_batch', export_media_batch)
+redis.register_function('novelty_add', novelty_add)
+redis.register_function('novelty_match', novelty_match)
+redis.register_function('novelty_clear', novelty_clear)
+redis.register_function('rhyme_add', rhyme_add)
+redis.register_function('rhyme_clear', rhyme_clear)
+redis.register_function('keyword_add', keyword_add)
+redis.register_function('keyword_clear', keyword_clear)
+redis.register_function('pick_keywords', pick_keywords)
+redis.register_function('conversation_push', conversation_push)
+redis.register_function('conversation_get', conversation_get)
 redis.register_function('clear_guild', clear_guild)
+redis.register_function('migrate_key_layout', migrate_key_layout)
+redis.register_function('clear_channel_chains', clear_channel_chains)
+redis.register_function('clear_language_chains', clear_language_chains)
+redis.register_function('drop_author_chain', drop_author_chain)
+redis.register_function('list_sub_chains', list_sub_chains)
 redis.register_function('set_config', set_config)
 redis.register_function('get_config', get_config)
 redis.register_function('delete_config', delete_config)
@@ -0,0 +1,11 @@
+// Package cache embeds the function library the bot runs on the cache
+// service, so the binary can check for and load the version it was built with.
+package cache
+
+import _ "embed"
+
+// MarkovLibrary is the source of cache_markov.lua, loadable as is with
+// FUNCTION LOAD.
+//
+//go:embed cache_markov.lua
+var MarkovLibrary string
@@ -10,7 +10,20 @@ export interface ChainAnalytics {
   id: string;
   images: number;
   max_size_mb: number;
+  eviction_policy?: "freeze" | "least_used" | "oldest";
+  evicted?: number;
   markov_max_branches?: number;
+  temperature?: number;
+  top_k?: number;
+  top_p?: number;
+  smoothing?: number;
+  chain_scope?: "guild" | "channel";
+  decay_half_life_days?: number;
+  novelty_run_length?: number;
+  conversation_turns?: number;
+  tokenizer?: "whitespace" | "punct" | "cjk";
+  language_chains?: boolean;
+  allow_crossover?: boolean;
   messages: number;
   name: string;
   pings_enabled: boolean;
@@ -24,6 +37,24 @@ export interface ChainAnalytics {
   words: number;
 }
 
+export interface RankedEntry {
+  text: string;
+  count: number;
+}
+
+export interface ChainDeepAnalytics {
+  states: number;
+  transitions: number;
+  weight: number;
+  avg_branching: number;
+  avg_entropy: number;
+  dead_end_ratio: number;
+  branching_histogram: { min: number; max: number; count: number }[];
+  top_tokens: RankedEntry[];
+  top_prefixes: RankedEntry[];
+  computed_at: string;
+}
+
 export function useGetChainAnalytics(token: string, chainId: string) {
   return useQuery({
     queryKey: ["/analytics/:chain", chainId],
@@ -35,6 +66,19 @@ export function useGetChainAnalytics(token: string, chainId: string) {
   });
 }
 
+// Resolves to null while the first analysis of the chain is still running.
+export function useGetChainDeepAnalytics(token: string, chainId: string) {
+  return useQuery({
+    queryKey: ["/analytics/:chain/deep", chainId],
+    queryFn: async () => {
+      const response = await apiFetch(`/analytics/${chainId}/deep`, { token });
+      if (!response.ok) throw new Error(`Failed to fetch chain ${chainId} deep analytics`);
+      if (response.status === 202) return null;
+      return response.json() as Promise<ChainDeepAnalytics>;
+    },
+  });
+}
+
 export function useGetAllChainsAnalytics(token: string) {
   return useQuery({
     queryKey: ["/analytics/all"],
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"rolando/internal/config"
 	"rolando/internal/logger"
+	"rolando/internal/repositories"
 	"rolando/internal/utils"
+	"strings"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
@@ -21,7 +23,8 @@ func (h *SlashCommandsHandler) analyticsCommand(s *bot.Client, i *events.Applica
 		logger.Errorf("Failed to fetch chain document for guild %s: %v", i.GuildID, err)
 		return
 	}
-	analytics, err := h.ChainsService.NewMarkovAnalyzer(chainConf).GetRawAnalytics(ctx)
+	analyzer := h.ChainsService.NewMarkovAnalyzer(chainConf)
+	analytics, err := analyzer.GetRawAnalytics(ctx)
 	if err != nil {
 		logger.Errorf("failed to analyze chain: %v", err)
 		return
@@ -88,6 +91,11 @@ func (h *SlashCommandsHandler) analyticsCommand(s *bot.Client, i *events.Applica
 				Value:  fmt.Sprintf("```%s / %s```", utils.FormatBytes(analytics.Size), utils.FormatBytes(uint64(chainConf.MaxSizeMb*1024*1024))),
 				Inline: new(true),
 			},
+			{
+				Name:   "Evicted",
+				Value:  fmt.Sprintf("```%d states (%s)```", analytics.Evicted, chainConf.EvictionPolicy),
+				Inline: new(true),
+			},
 		},
 		Footer: &discord.EmbedFooter{
 			Text:    fmt.Sprintf("Version: %s", config.Version),
@@ -95,6 +103,16 @@ func (h *SlashCommandsHandler) analyticsCommand(s *bot.Client, i *events.Applica
 		},
 	}
 
+	// The deep analysis scans the whole chain, so only a cached one is shown;
+	// a missing or stale one is refreshed in the background for next time.
+	deep, err := analyzer.GetCachedDeepAnalytics(ctx)
+	if err != nil {
+		logger.Warnf("failed to load deep analytics for %s: %v", chainConf.ID, err)
+	}
+	if deep != nil {
+		embed.Fields = append(embed.Fields, deepAnalyticsFields(deep)...)
+	}
+
 	// Send the response with the embed
 	err = s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 		Type: discord.InteractionResponseTypeCreateMessage,
@@ -104,3 +122,41 @@ func (h *SlashCommandsHandler) analyticsCommand(s *bot.Client, i *events.Applica
 		logger.Errorf("Failed to send analytics embed: %v", err)
 	}
 }
+
+func deepAnalyticsFields(deep *repositories.ChainAnalysis) []discord.EmbedField {
+	words := make([]string, 0, 5)
+	for _, t := range deep.TopTokens[:min(5, len(deep.TopTokens))] {
+		words = append(words, t.Text)
+	}
+	topWords := strings.Join(words, ", ")
+	if topWords == "" {
+		topWords = "-"
+	}
+	return []discord.EmbedField{
+		{
+			Name:   "\t", // Empty field for spacing
+			Value:  "\t",
+			Inline: new(false),
+		},
+		{
+			Name:   "Entropy",
+			Value:  fmt.Sprintf("```%.2f bits```", deep.AvgEntropy),
+			Inline: new(true),
+		},
+		{
+			Name:   "Branching",
+			Value:  fmt.Sprintf("```%.2f```", deep.AvgBranching),
+			Inline: new(true),
+		},
+		{
+			Name:   "Dead Ends",
+			Value:  fmt.Sprintf("```%.1f%%```", deep.DeadEndRatio*100),
+			Inline: new(true),
+		},
+		{
+			Name:   "Top Words",
+			Value:  fmt.Sprintf("```%s```\nAnalyzed <t:%d:R>", topWords, deep.ComputedAt.Unix()),
+			Inline: new(false),
+		},
+	}
+}
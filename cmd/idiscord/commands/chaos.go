@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"rolando/internal/repositories"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+// implementation of /chaos command
+func (h *SlashCommandsHandler) chaosCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	ctx := context.Background()
+	options := i.SlashCommandInteractionData().Options
+	fields := make(map[string]any)
+	for _, option := range options {
+		switch {
+		case option.Name == "temperature" && option.Type == discord.ApplicationCommandOptionTypeFloat:
+			fields["temperature"] = option.Float()
+		case option.Name == "top_k" && option.Type == discord.ApplicationCommandOptionTypeInt:
+			fields["top_k"] = option.Int()
+		case option.Name == "top_p" && option.Type == discord.ApplicationCommandOptionTypeFloat:
+			fields["top_p"] = option.Float()
+		}
+	}
+
+	chainDoc, err := h.ChainsService.GetChainConf(ctx, i.GuildID().String())
+	if err != nil {
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: "Failed to retrieve chain data.",
+				Flags:   discord.MessageFlagEphemeral,
+			},
+		})
+		return
+	}
+	if len(fields) > 0 {
+		if !h.checkAdmin(i, "You are not authorized to change the chaos settings.") {
+			return
+		}
+		updated, err := h.ChainsService.UpdateChainMeta(ctx, chainDoc.ID, fields)
+		if err != nil {
+			s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+				Type: discord.InteractionResponseTypeCreateMessage,
+				Data: discord.MessageCreate{
+					Content: "Failed to update chaos settings.",
+					Flags:   discord.MessageFlagEphemeral,
+				},
+			})
+			return
+		}
+
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: "Set chaos to " + formatSampling(updated.Sampling()),
+			},
+		})
+		return
+	}
+
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeCreateMessage,
+		Data: discord.MessageCreate{
+			Content: "Current chaos is " + formatSampling(chainDoc.Sampling()),
+		},
+	})
+}
+
+func formatSampling(sp repositories.Sampling) string {
+	topK := "unlimited"
+	if sp.TopK > 0 {
+		topK = fmt.Sprintf("%d", sp.TopK)
+	}
+	return fmt.Sprintf("temperature `%.2f`, top k `%s`, top p `%.2f`", sp.Temperature, topK, sp.TopP)
+}
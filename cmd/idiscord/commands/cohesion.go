@@ -2,7 +2,9 @@ package commands
 
 import (
 	"context"
-	"strconv"
+	"fmt"
+
+	"rolando/internal/repositories"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
@@ -13,12 +15,13 @@ import (
 func (h *SlashCommandsHandler) cohesionCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
 	ctx := context.Background()
 	options := i.SlashCommandInteractionData().Options
-	var cohesion *int
+	fields := make(map[string]any)
 	for _, option := range options {
-		if option.Name == "value" && option.Type == discord.ApplicationCommandOptionTypeInt {
-			value := int(option.Int())
-			cohesion = &value
-			break
+		switch {
+		case option.Name == "value" && option.Type == discord.ApplicationCommandOptionTypeInt:
+			fields["n_gram_size"] = int(option.Int())
+		case option.Name == "smoothing" && option.Type == discord.ApplicationCommandOptionTypeFloat:
+			fields["smoothing"] = option.Float()
 		}
 	}
 
@@ -33,11 +36,12 @@ func (h *SlashCommandsHandler) cohesionCommand(s *bot.Client, i *events.Applicat
 		})
 		return
 	}
-	if cohesion != nil {
+	if len(fields) > 0 {
 		if !h.checkAdmin(i, "You are not authorized to change the cohesion value.") {
 			return
 		}
-		if _, err := h.ChainsService.UpdateChainMeta(ctx, chainDoc.ID, map[string]interface{}{"n_gram_size": *cohesion}); err != nil {
+		updated, err := h.ChainsService.UpdateChainMeta(ctx, chainDoc.ID, fields)
+		if err != nil {
 			s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 				Type: discord.InteractionResponseTypeCreateMessage,
 				Data: discord.MessageCreate{
@@ -51,7 +55,7 @@ func (h *SlashCommandsHandler) cohesionCommand(s *bot.Client, i *events.Applicat
 		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 			Type: discord.InteractionResponseTypeCreateMessage,
 			Data: discord.MessageCreate{
-				Content: "Set cohesion value to `" + strconv.Itoa(*cohesion) + "`",
+				Content: "Set cohesion to " + formatCohesion(updated),
 			},
 		})
 		return
@@ -60,7 +64,15 @@ func (h *SlashCommandsHandler) cohesionCommand(s *bot.Client, i *events.Applicat
 	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 		Type: discord.InteractionResponseTypeCreateMessage,
 		Data: discord.MessageCreate{
-			Content: "Current cohesion value is `" + strconv.Itoa(chainDoc.NGramSize) + "`",
+			Content: "Current cohesion is " + formatCohesion(chainDoc),
 		},
 	})
 }
+
+func formatCohesion(chain *repositories.ChainConfig) string {
+	smoothing := "off"
+	if chain.Smoothing > 0 {
+		smoothing = fmt.Sprintf("%.2f", chain.Smoothing)
+	}
+	return fmt.Sprintf("value `%d`, smoothing `%s`", chain.NGramSize, smoothing)
+}
@@ -4,6 +4,7 @@ import (
 	"rolando/cmd/idiscord/services"
 	"rolando/internal/config"
 	"rolando/internal/logger"
+	"rolando/internal/repositories"
 	"time"
 
 	"github.com/disgoorg/disgo/bot"
@@ -150,10 +151,77 @@ func NewSlashCommandsHandler(
 						Description: "the value to set, must be at least 2 (leave empty to view)",
 						Required:    false,
 					},
+					discord.ApplicationCommandOptionFloat{
+						MinValue:    new(0.0),
+						MaxValue:    new(0.95),
+						Name:        "smoothing",
+						Description: "how much shorter contexts are blended in, keeps high values varied, 0 to turn off",
+						Required:    false,
+					},
 				},
 			},
 			Handler: handler.cohesionCommand,
 		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "chaos",
+				Description: "View or set how chaotic generated text is; Lower values stay coherent, higher ones get absurd",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionFloat{
+						MinValue:    new(0.1),
+						MaxValue:    new(3.0),
+						Name:        "temperature",
+						Description: "1 follows the learned odds, lower is safer, higher is wilder (leave empty to view)",
+						Required:    false,
+					},
+					discord.ApplicationCommandOptionInt{
+						MinValue:    new(0),
+						MaxValue:    new(256),
+						Name:        "top_k",
+						Description: "only pick among the K most common next words, 0 for no limit",
+						Required:    false,
+					},
+					discord.ApplicationCommandOptionFloat{
+						MinValue:    new(0.05),
+						MaxValue:    new(1.0),
+						Name:        "top_p",
+						Description: "only pick among the most likely next words covering this share, 1 for no limit",
+						Required:    false,
+					},
+				},
+			},
+			Handler: handler.chaosCommand,
+		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "scope",
+				Description: "View or set whether replies use the whole server or each channel's own voice",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "value",
+						Description: "the scope to use (leave empty to view)",
+						Required:    false,
+						Choices: []discord.ApplicationCommandOptionChoiceString{
+							{
+								Name:  "Server",
+								Value: repositories.ChainScopeGuild,
+							},
+							{
+								Name:  "Channel",
+								Value: repositories.ChainScopeChannel,
+							},
+						},
+					},
+				},
+			},
+			Handler: handler.scopeCommand,
+		},
 		{
 			Command: discord.SlashCommandCreate{
 				Name:        "opinion",
@@ -171,6 +239,43 @@ func NewSlashCommandsHandler(
 			},
 			Handler: handler.opinionCommand,
 		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "imitate",
+				Description: "Generates a message in the style of a specific member",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionUser{
+						Name:        "user",
+						Description: "The member to imitate",
+						Required:    true,
+					},
+				},
+			},
+			Handler: handler.imitateCommand,
+		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "imitate-optout",
+				Description: "Toggles whether others can /imitate you in this server",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+			},
+			Handler: handler.imitateOptOutCommand,
+		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "forgetme",
+				Description: "Erases every message the bot learned from you in this server",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+			},
+			Handler: handler.forgetMeCommand,
+		},
 		{
 			Command: discord.SlashCommandCreate{
 				Name:        "rhyme",
@@ -184,10 +289,41 @@ func NewSlashCommandsHandler(
 						Description: "Text whose last word is used as the rhyme target",
 						Required:    true,
 					},
+					discord.ApplicationCommandOptionInt{
+						MinValue:    new(1),
+						MaxValue:    new(4),
+						Name:        "couplets",
+						Description: "Write this many rhyming couplets instead of a single line",
+						Required:    false,
+					},
 				},
 			},
 			Handler: handler.rhymeCommand,
 		},
+		{
+			Command: discord.SlashCommandCreate{
+				Name:        "crossover",
+				Description: "Generates text from a blend of this server's chain and another server's chain (owner only)",
+				Contexts: []discord.InteractionContextType{
+					discord.InteractionContextTypeGuild,
+				},
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "guild",
+						Description: "ID of the other server, which must also allow crossover",
+						Required:    true,
+					},
+					discord.ApplicationCommandOptionInt{
+						MinValue:    new(0),
+						MaxValue:    new(100),
+						Name:        "weight",
+						Description: "Share of the other server's chain in the blend, in percent (default 50)",
+						Required:    false,
+					},
+				},
+			},
+			Handler: handler.withOwnerPermission(handler.crossoverCommand),
+		},
 		{
 			Command: discord.SlashCommandCreate{
 				Name:        "wipe",
@@ -304,6 +440,10 @@ func NewSlashCommandsHandler(
 								Name:  "Spanish",
 								Value: 3,
 							},
+							{
+								Name:  "Automatic",
+								Value: 4,
+							},
 						},
 						Description: "the language to set (leave empty to view)",
 						Required:    false,
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"rolando/cmd/idiscord/services"
+	"rolando/internal/logger"
+	"rolando/internal/repositories"
+	"rolando/internal/utils"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+// implementation of /crossover command
+func (h *SlashCommandsHandler) crossoverCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	data := i.SlashCommandInteractionData()
+	otherID := strings.TrimSpace(data.String("guild"))
+	weight := 50
+	if w, ok := data.OptInt("weight"); ok {
+		weight = w
+	}
+
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeDeferredCreateMessage,
+	})
+
+	msg, err := h.ChainsService.Crossover(context.Background(), i.GuildID().String(), otherID, weight, utils.GetRandom(8, 40))
+	if err != nil || msg == "" {
+		content := "Failed to generate text."
+		switch {
+		case errors.Is(err, services.ErrCrossoverNotAllowed):
+			content = "Both servers must enable crossover in their chain settings."
+		case errors.Is(err, services.ErrCrossoverSameGuild):
+			content = "Pick a different server to cross this one with."
+		case errors.Is(err, repositories.ErrCrossoverClustered):
+			content = "Crossover is not available on this bot's setup."
+		case err != nil:
+			logger.Errorf("Failed to generate crossover with %s: %v", otherID, err)
+		}
+		s.Rest.UpdateInteractionResponse(s.ApplicationID, i.Token(), discord.NewMessageUpdate().
+			WithContent(content).WithFlags(discord.MessageFlagEphemeral))
+		return
+	}
+
+	s.Rest.UpdateInteractionResponse(s.ApplicationID, i.Token(), discord.NewMessageUpdate().
+		WithContent(msg).WithAllowedMentions(&discord.AllowedMentions{}))
+}
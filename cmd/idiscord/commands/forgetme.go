@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"rolando/cmd/idiscord/services"
+	"rolando/internal/logger"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+// forgetMeProgressInterval throttles progress edits of the /forgetme reply.
+const forgetMeProgressInterval = 3 * time.Second
+
+// implementation of /forgetme command
+func (h *SlashCommandsHandler) forgetMeCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeDeferredCreateMessage,
+		Data: discord.MessageCreate{Flags: discord.MessageFlagEphemeral},
+	})
+
+	update := func(content string) {
+		if _, err := s.Rest.UpdateInteractionResponse(s.ApplicationID, i.Token(), discord.NewMessageUpdate().WithContent(content)); err != nil {
+			logger.Errorf("Failed to update /forgetme response: %v", err)
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		lastUpdate time.Time
+	)
+	onProgress := func(p services.ErasureProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case p.Finished && p.Error != "":
+			update(fmt.Sprintf("Something went wrong after forgetting %d of your %d messages, please try again later.", p.Done, p.Total))
+		case p.Finished:
+			update(fmt.Sprintf("Done, I forgot the %d messages I know you sent in this server. "+
+				"Messages I learned before I kept track of authors cannot be traced back to you, so those are still in my memory.", p.Done))
+		case time.Since(lastUpdate) >= forgetMeProgressInterval:
+			lastUpdate = time.Now()
+			update(fmt.Sprintf("Forgetting your messages... %d/%d", p.Done, p.Total))
+		}
+	}
+
+	p, err := h.ChainsService.ForgetUser(i.GuildID().String(), i.User().ID.String(), onProgress)
+	if errors.Is(err, services.ErrErasureInProgress) {
+		update(fmt.Sprintf("I am already forgetting your messages (%d/%d).", p.Done, p.Total))
+	}
+}
@@ -50,6 +50,31 @@ func (h *SlashCommandsHandler) checkAdmin(i *events.ApplicationCommandInteractio
 	return false
 }
 
+func (h *SlashCommandsHandler) withOwnerPermission(cb SlashCommandHandler) SlashCommandHandler {
+	return func(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+		if !h.checkOwner(i) {
+			return
+		}
+		cb(s, i)
+	}
+}
+
+func (h *SlashCommandsHandler) checkOwner(i *events.ApplicationCommandInteractionCreate) bool {
+	for _, ownerID := range config.OwnerIDs {
+		if i.User().ID.String() == ownerID {
+			return true
+		}
+	}
+	h.Client.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeCreateMessage,
+		Data: discord.MessageCreate{
+			Content: "Only the bot owners can use this command.",
+			Flags:   discord.MessageFlagEphemeral,
+		},
+	})
+	return false
+}
+
 func (h *SlashCommandsHandler) withGuildSubscription(skuId snowflake.ID, cb SlashCommandHandler) SlashCommandHandler {
 	return func(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
 		canUse := h.guildSubscriptionCheck(s, i, skuId)
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rolando/cmd/idiscord/services"
+	"rolando/internal/utils"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+// implementation of /imitate command
+func (h *SlashCommandsHandler) imitateCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	user, ok := i.SlashCommandInteractionData().OptUser("user")
+	if !ok {
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: "You must provide a member to imitate.",
+				Flags:   discord.MessageFlagEphemeral,
+			},
+		})
+		return
+	}
+
+	msg, err := h.ChainsService.Imitate(context.Background(), i.GuildID().String(), user.ID.String(), utils.GetRandom(8, 40))
+	if err != nil || msg == "" {
+		content := "Failed to generate text."
+		switch {
+		case errors.Is(err, services.ErrImitationOptedOut):
+			content = fmt.Sprintf("%s does not want to be imitated.", user.EffectiveName())
+		case errors.Is(err, services.ErrNotEnoughImitationData):
+			content = fmt.Sprintf("I don't know %s well enough yet, they need at least %d messages.", user.EffectiveName(), services.MinImitationMessages)
+		}
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: content,
+				Flags:   discord.MessageFlagEphemeral,
+			},
+		})
+		return
+	}
+
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeCreateMessage,
+		Data: discord.MessageCreate{
+			Content:         fmt.Sprintf("**%s**: %s", user.EffectiveName(), msg),
+			AllowedMentions: &discord.AllowedMentions{},
+		},
+	})
+}
+
+// implementation of /imitate-optout command
+func (h *SlashCommandsHandler) imitateOptOutCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	ctx := context.Background()
+	guildID := i.GuildID().String()
+	userID := i.User().ID.String()
+
+	optedOut, err := h.ChainsService.IsImitationOptedOut(ctx, guildID, userID)
+	if err == nil {
+		err = h.ChainsService.SetImitationOptOut(ctx, guildID, userID, !optedOut)
+	}
+	if err != nil {
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: "Failed to update your imitation preference.",
+				Flags:   discord.MessageFlagEphemeral,
+			},
+		})
+		return
+	}
+
+	content := "You opted out, nobody can `/imitate` you in this server anymore."
+	if optedOut {
+		content = "You opted back in, others can `/imitate` you again once I have learned enough from you."
+	}
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeCreateMessage,
+		Data: discord.MessageCreate{
+			Content: content,
+			Flags:   discord.MessageFlagEphemeral,
+		},
+	})
+}
@@ -15,14 +15,17 @@ import (
 func (h *SlashCommandsHandler) rhymeCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
 	options := i.SlashCommandInteractionData().Options
 	var text string
+	var couplets int
 	for _, option := range options {
-		if option.Name == "with" && option.Type == discord.ApplicationCommandOptionTypeString {
+		switch {
+		case option.Name == "with" && option.Type == discord.ApplicationCommandOptionTypeString:
 			text = option.String()
-			break
+		case option.Name == "couplets" && option.Type == discord.ApplicationCommandOptionTypeInt:
+			couplets = int(option.Int())
 		}
 	}
 
-	if text == "" {
+	if strings.TrimSpace(text) == "" {
 		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 			Type: discord.InteractionResponseTypeCreateMessage,
 			Data: discord.MessageCreate{
@@ -39,8 +42,17 @@ func (h *SlashCommandsHandler) rhymeCommand(s *bot.Client, i *events.Application
 
 	fields := strings.Fields(text)
 	rhymeWord := fields[len(fields)-1]
+	lineLength := func() int { return utils.GetRandom(4, 9) }
 
-	msg, err := h.ChainsService.GenerateRhyme(context.Background(), i.GuildID().String(), rhymeWord, utils.GetRandom(4, 9))
+	var msg string
+	var err error
+	if couplets > 0 {
+		var lines []string
+		lines, err = h.ChainsService.GenerateCouplets(context.Background(), i.GuildID().String(), rhymeWord, couplets, lineLength)
+		msg = strings.Join(lines, "\n")
+	} else {
+		msg, err = h.ChainsService.GenerateRhyme(context.Background(), i.GuildID().String(), rhymeWord, lineLength())
+	}
 	if err != nil {
 		logger.Errorf("Failed to generate a rhyme: %v", err)
 		s.Rest.UpdateInteractionResponse(s.ApplicationID, i.Token(), discord.NewMessageUpdate().
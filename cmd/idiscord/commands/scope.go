@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+
+	"rolando/internal/repositories"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+)
+
+// implementation of /scope command
+func (h *SlashCommandsHandler) scopeCommand(s *bot.Client, i *events.ApplicationCommandInteractionCreate) {
+	ctx := context.Background()
+	var scope string
+	for _, option := range i.SlashCommandInteractionData().Options {
+		if option.Name == "value" && option.Type == discord.ApplicationCommandOptionTypeString {
+			scope = option.String()
+			break
+		}
+	}
+
+	chainDoc, err := h.ChainsService.GetChainConf(ctx, i.GuildID().String())
+	if err != nil {
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: "Failed to retrieve chain data.",
+				Flags:   discord.MessageFlagEphemeral,
+			},
+		})
+		return
+	}
+
+	if scope != "" {
+		if !h.checkAdmin(i, "You are not authorized to change the chain scope.") {
+			return
+		}
+		if _, err := h.ChainsService.UpdateChainMeta(ctx, chainDoc.ID, map[string]any{"chain_scope": scope}); err != nil {
+			s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+				Type: discord.InteractionResponseTypeCreateMessage,
+				Data: discord.MessageCreate{
+					Content: "Failed to update chain scope.",
+					Flags:   discord.MessageFlagEphemeral,
+				},
+			})
+			return
+		}
+		content := "Set scope to `" + scope + "`"
+		if scope == repositories.ChainScopeChannel {
+			content += ", channel chains are being built from stored messages"
+		}
+		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+			Type: discord.InteractionResponseTypeCreateMessage,
+			Data: discord.MessageCreate{
+				Content: content,
+			},
+		})
+		return
+	}
+
+	s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
+		Type: discord.InteractionResponseTypeCreateMessage,
+		Data: discord.MessageCreate{
+			Content: "Current scope is `" + chainDoc.ChainScope + "`",
+		},
+	})
+}
@@ -90,7 +90,7 @@ func (h *SlashCommandsHandler) vcJoinCommand(client *bot.Client, i *events.Appli
 			logger.Errorf("Failed to retrieve chain document: %v", err)
 			return
 		}
-		provider, err := tts.GenerateTTSProvider("i am here", chainDoc.TTSLanguage)
+		provider, err := tts.GenerateTTSProvider("i am here", h.ChainsService.SpeechLanguage(vcCtx, chainDoc, "i am here"))
 		if err != nil {
 			logger.Errorf("Failed to generate TTS provider: %v", err)
 			conn.Close(vcCtx)
@@ -190,7 +190,8 @@ func listenVc(h *SlashCommandsHandler, event *events.ApplicationCommandInteracti
 
 	go func() {
 		pcmChan := make(chan *helpers.PCMPacket, 10)
-		receiver := helpers.NewVoskOpusReceiver(chainConf.ID, chainConf.TTSLanguage, pcmChan)
+		listenLang := h.ChainsService.ListeningLanguage(vcCtx, chainConf)
+		receiver := helpers.NewVoskOpusReceiver(chainConf.ID, listenLang, pcmChan)
 
 		// Register the opus frame receiver with the voice connection
 		conn.SetOpusFrameReceiver(receiver)
@@ -217,7 +218,7 @@ func listenVc(h *SlashCommandsHandler, event *events.ApplicationCommandInteracti
 				pcm := packet.Sequence
 				var audioData bytes.Buffer
 				binary.Write(&audioData, binary.LittleEndian, pcm)
-				text, err := stt.SpeechToTextNative(&audioData, chainConf.TTSLanguage, chainConf.ID)
+				text, err := stt.SpeechToTextNative(&audioData, listenLang, chainConf.ID)
 				if err != nil {
 					logger.Errorf("Failed Speech to Text: %v", err)
 					continue
@@ -225,7 +226,7 @@ func listenVc(h *SlashCommandsHandler, event *events.ApplicationCommandInteracti
 
 				random := utils.GetRandom(1, 1000)
 				if text != "" {
-					h.ChainsService.Train(vcCtx, guildID.String(), text, chainConf.NGramSize, chainConf.MaxSizeBytes(), chainConf.MarkovMaxBranches)
+					h.ChainsService.Train(vcCtx, guildID.String(), text, chainConf.NGramSize, chainConf.SizeLimit(), chainConf.MarkovMaxBranches)
 					if strings.Contains(text, "rolando") {
 						random = 1
 					}
@@ -251,7 +252,7 @@ func listenVc(h *SlashCommandsHandler, event *events.ApplicationCommandInteracti
 						logger.Warnln("Generated empty msg in vc handler")
 						return
 					}
-					provider, err := tts.GenerateTTSProvider(msg, chainConf.TTSLanguage)
+					provider, err := tts.GenerateTTSProvider(msg, h.ChainsService.SpeechLanguage(vcCtx, chainConf, msg))
 					if err != nil {
 						logger.Errorf("Failed to generate random TTS provider in '%s' in '%s': %v", channelName, chainConf.Name, err)
 						return
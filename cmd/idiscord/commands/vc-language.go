@@ -15,7 +15,12 @@ func (h *SlashCommandsHandler) vcLanguageCommand(s *bot.Client, i *events.Applic
 	var lang string
 	for _, option := range i.SlashCommandInteractionData().Options {
 		if option.Name == "language" && option.Type == discord.ApplicationCommandOptionTypeInt {
-			lang = data.Langs[option.Int()]
+			// The choice after the last language is "Automatic".
+			if idx := option.Int(); idx < len(data.Langs) {
+				lang = data.Langs[idx]
+			} else {
+				lang = data.LangAuto
+			}
 			break
 		}
 	}
@@ -46,10 +51,14 @@ func (h *SlashCommandsHandler) vcLanguageCommand(s *bot.Client, i *events.Applic
 			})
 			return
 		}
+		content := "Set language to use in vc to `" + lang + "`"
+		if lang == data.LangAuto {
+			content += ", each utterance is spoken in the language it is written in"
+		}
 		s.Rest.CreateInteractionResponse(i.ID(), i.Token(), discord.InteractionResponse{
 			Type: discord.InteractionResponseTypeCreateMessage,
 			Data: discord.MessageCreate{
-				Content: "Set language to use in vc to `" + lang + "`",
+				Content: content,
 			},
 		})
 		return
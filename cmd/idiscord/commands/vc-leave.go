@@ -37,7 +37,7 @@ func (h *SlashCommandsHandler) vcLeaveCommand(client *bot.Client, event *events.
 	}
 
 	chainDoc, _ := h.ChainsService.GetChainConf(ctx, guildID.String())
-	provider, err := tts.GenerateTTSProvider("bye bye", chainDoc.TTSLanguage)
+	provider, err := tts.GenerateTTSProvider("bye bye", h.ChainsService.SpeechLanguage(ctx, chainDoc, "bye bye"))
 	if err != nil {
 		logger.Errorf("Failed to generate TTS provider: %v", err)
 		return
@@ -84,7 +84,7 @@ func (h *SlashCommandsHandler) vcSpeakCommand(client *bot.Client, event *events.
 			logger.Errorf("Failed to update interaction response: %v", err)
 		}
 
-		provider, err := tts.GenerateTTSProvider(content, chainDoc.TTSLanguage)
+		provider, err := tts.GenerateTTSProvider(content, h.ChainsService.SpeechLanguage(vcCtx, chainDoc, content))
 		if err != nil {
 			logger.Errorf("Failed to generate TTS provider: %v", err)
 			return
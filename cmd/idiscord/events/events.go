@@ -5,6 +5,7 @@ import (
 	"rolando/cmd/idiscord/services"
 	"rolando/internal/logger"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/disgoorg/disgo/bot"
@@ -16,13 +17,19 @@ import (
 type EventsHandler struct {
 	Client        *bot.Client
 	ChainsService *services.ChainsService
+
+	// pendingDeletes collects deleted message IDs per guild until the next
+	// flush, so bulk deletes are untrained as one batch.
+	pendingDeletesMu sync.Mutex
+	pendingDeletes   map[string][]string
 }
 
 // Constructor for EventsHandler
 func NewEventsHandler(client *bot.Client, chainsService *services.ChainsService) *EventsHandler {
 	handler := &EventsHandler{
-		Client:        client,
-		ChainsService: chainsService,
+		Client:         client,
+		ChainsService:  chainsService,
+		pendingDeletes: make(map[string][]string),
 	}
 
 	return handler
@@ -39,6 +46,10 @@ func (h *EventsHandler) OnEventCreate(event bot.Event) {
 		h.onGuildUpdate(e)
 	case *events.GuildVoiceStateUpdate:
 		h.onVoiceStateUpdate(e)
+	case *events.GuildMessageDelete:
+		h.onMessageDelete(e)
+	case *events.GuildMessageUpdate:
+		h.onMessageUpdate(e)
 		// Subscriptions Logs
 		// case *events.EntitlementCreate:
 		//     h.onEntitlementCreate(e)
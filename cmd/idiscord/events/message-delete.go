@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+	"rolando/internal/logger"
+	"time"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+// messageDeleteFlushDelay is how long deletes are collected before being
+// untrained. Discord bulk deletes arrive as a burst of single deletes, which
+// this folds into one batch per guild.
+const messageDeleteFlushDelay = 2 * time.Second
+
+// handler for MESSAGE_DELETE and MESSAGE_DELETE_BULK events
+func (h *EventsHandler) onMessageDelete(e *events.GuildMessageDelete) {
+	guildID := e.GuildID.String()
+
+	h.pendingDeletesMu.Lock()
+	defer h.pendingDeletesMu.Unlock()
+	pending, scheduled := h.pendingDeletes[guildID]
+	h.pendingDeletes[guildID] = append(pending, e.MessageID.String())
+	if !scheduled {
+		time.AfterFunc(messageDeleteFlushDelay, func() { h.flushMessageDeletes(guildID) })
+	}
+}
+
+func (h *EventsHandler) flushMessageDeletes(guildID string) {
+	h.pendingDeletesMu.Lock()
+	messageIDs := h.pendingDeletes[guildID]
+	delete(h.pendingDeletes, guildID)
+	h.pendingDeletesMu.Unlock()
+
+	if len(messageIDs) == 0 {
+		return
+	}
+	if err := h.ChainsService.DeleteDiscordMessages(context.Background(), guildID, messageIDs); err != nil {
+		logger.Errorf("Failed to untrain %d deleted messages in guild %s: %v", len(messageIDs), guildID, err)
+	}
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"context"
+	"rolando/cmd/idiscord/helpers"
+	"rolando/internal/logger"
+
+	"github.com/disgoorg/disgo/events"
+)
+
+// handler for MESSAGE_UPDATE event
+func (h *EventsHandler) onMessageUpdate(e *events.GuildMessageUpdate) {
+	// Partial updates carry no author; only full messages can be retrained.
+	if e.Message.Author.ID == 0 || e.Message.Author.Bot {
+		return
+	}
+	guildID := e.GuildID.String()
+	messages := helpers.TrainableMessages(e.Message)
+	go func() {
+		err := h.ChainsService.EditDiscordMessage(context.Background(), guildID, e.ChannelID.String(), e.MessageID.String(), messages)
+		if err != nil {
+			logger.Errorf("Failed to retrain edited message %s in guild %s: %v", e.MessageID, guildID, err)
+		}
+	}()
+}
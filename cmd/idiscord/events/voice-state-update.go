@@ -95,7 +95,7 @@ func (h *EventsHandler) onVoiceStateUpdate(e *events.GuildVoiceStateUpdate) {
 			logger.Errorf("Failed to generate text: %v", err)
 			return
 		}
-		provider, err := tts.GenerateTTSProvider(content, chainDoc.TTSLanguage)
+		provider, err := tts.GenerateTTSProvider(content, h.ChainsService.SpeechLanguage(vcCtx, chainDoc, content))
 		if err != nil {
 			logger.Errorf("Failed to generate TTS provider: %v", err)
 			conn.Close(vcCtx)
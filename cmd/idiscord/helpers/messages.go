@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"rolando/internal/repositories"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// TrainableMessages returns the rows a live message is trained and stored
+// as: its content when longer than 3 characters, then one row per
+// attachment URL. All rows carry the author and Discord message IDs.
+func TrainableMessages(m discord.Message) []repositories.Message {
+	authorID := m.Author.ID.String()
+	messageID := m.ID.String()
+	messages := make([]repositories.Message, 0, 1+len(m.Attachments))
+	if len(m.Content) > 3 {
+		messages = append(messages, repositories.Message{Content: m.Content, AuthorID: authorID, MessageID: messageID})
+	}
+	for _, attachment := range m.Attachments {
+		if attachment.URL == "" {
+			// should never happen
+			continue
+		}
+		messages = append(messages, repositories.Message{Content: attachment.URL, AuthorID: authorID, MessageID: messageID})
+	}
+	return messages
+}
@@ -9,6 +9,7 @@ import (
 	"rolando/internal/logger"
 	"rolando/internal/utils"
 	"slices"
+	"strings"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
@@ -49,31 +50,31 @@ func (h *MessageHandler) OnMessageCreate(e *events.MessageCreate) {
 			return
 		}
 
-		messages := make([]string, 0)
-		if len(m.Content) > 3 {
-			messages = append(messages, m.Content)
-		}
-		for _, attachment := range m.Attachments {
-			if attachment.URL == "" {
-				// should never happen
-				continue
-			}
-			messages = append(messages, attachment.URL)
-		}
-
+		messages := helpers.TrainableMessages(m)
 		if len(messages) > 0 {
-			if err := h.ChainsService.UpdateChainState(context.Background(), guild.ID.String(), messages); err != nil {
+			if err := h.ChainsService.UpdateChainState(context.Background(), guild.ID.String(), m.ChannelID.String(), messages); err != nil {
 				logger.Errorf("Failed to update chain state in '%s': %v", guild.Name, err)
 			}
+			// Stored with their message ID so deletes and edits can untrain them.
+			if err := h.ChainsService.StoreMessages(guild.ID.String(), m.ChannelID.String(), messages); err != nil {
+				logger.Errorf("Failed to store messages in '%s': %v", guild.Name, err)
+			}
 		}
 
 		// Must use the fetched chain/chainDoc from *this* goroutine
 		botMember, _ := h.Client.Caches.Member(guild.ID, h.Client.ID())
-		if helpers.MentionsUser(m, botMember) {
+		repliesToBot := m.ReferencedMessage != nil && m.ReferencedMessage.Author.ID == h.Client.ID()
+		answered := false
+		if repliesToBot && chainConf.ConversationTurns > 0 {
+			// Replies to the bot are always answered, until the conversation
+			// reaches its length cap. Past it, only mentions are.
+			answered = h.handleConversation(m, guild.Name, chainConf.ID)
+		}
+		if !answered && helpers.MentionsUser(m, botMember) {
 			if err := h.Client.Rest.SendTyping(m.ChannelID); err != nil {
 				logger.Errorf("Failed to send typing in '%s': %v", guild.Name, err)
 			}
-			h.handleReply(m, chainConf.ID)
+			h.handleReply(m, chainConf.ID, m.Content)
 		}
 		if ratedChoice(chainConf.ReplyRate) {
 			if err := h.Client.Rest.SendTyping(m.ChannelID); err != nil {
@@ -87,9 +88,30 @@ func (h *MessageHandler) OnMessageCreate(e *events.MessageCreate) {
 	}()
 }
 
-// handleReply sends a message in reply to a mention.
-func (h *MessageHandler) handleReply(m discord.Message, chainId string) {
-	message, err := h.getMessage(chainId)
+// handleConversation answers a reply to one of the bot's messages, seeded
+// from the channel's conversation with the bot and the reply itself. Returns
+// false, without answering, once the conversation is over its length cap.
+func (h *MessageHandler) handleConversation(m discord.Message, guildName string, chainId string) bool {
+	history, open, err := h.ChainsService.Conversation(context.Background(), chainId, m.ChannelID.String())
+	if err != nil {
+		logger.Errorf("Failed to fetch conversation in '%s': %v", guildName, err)
+		return false
+	}
+	if !open {
+		return false
+	}
+	if err := h.Client.Rest.SendTyping(m.ChannelID); err != nil {
+		logger.Errorf("Failed to send typing in '%s': %v", guildName, err)
+	}
+	h.handleReply(m, chainId, strings.Join(append(history, m.Content), "\n"))
+	return true
+}
+
+// handleReply sends a message in reply to m, seeded from prompt, and
+// remembers the exchange as part of the channel's conversation when the
+// answer is generated text rather than media.
+func (h *MessageHandler) handleReply(m discord.Message, chainId string, prompt string) {
+	message, media, err := h.getMessage(chainId, m.ChannelID.String(), h.ChainsService.DetectLanguage(m.Content), prompt)
 	if err != nil {
 		logger.Errorf("Failed to generate text for mention reply in '%s': %v", m.GuildID, err)
 		return
@@ -97,6 +119,11 @@ func (h *MessageHandler) handleReply(m discord.Message, chainId string) {
 	if len(message) == 0 {
 		return
 	}
+	if !media {
+		if err := h.ChainsService.RememberExchange(context.Background(), chainId, m.ChannelID.String(), m.Content, message); err != nil {
+			logger.Errorf("Failed to remember conversation in '%s': %v", m.GuildID, err)
+		}
+	}
 
 	sendData := discord.MessageCreate{
 		Content: message,
@@ -111,7 +138,7 @@ func (h *MessageHandler) handleReply(m discord.Message, chainId string) {
 
 // handleRandomMessage sends a non-reply/quiet-reply message.
 func (h *MessageHandler) handleRandomMessage(m discord.Message, guildName string, chainId string) {
-	message, err := h.getMessage(chainId)
+	message, _, err := h.getMessage(chainId, m.ChannelID.String(), h.ChainsService.DetectLanguage(m.Content), "")
 	if err != nil {
 		logger.Errorf("Failed to generate text for random message in '%s': %v", guildName, err)
 		return
@@ -193,8 +220,12 @@ func ratedChoice(rate int) bool {
 	return rate == 1 || (rate > 1 && utils.GetRandom(1, rate) == 1)
 }
 
-// Generate a message based on chain probabilities
-func (h *MessageHandler) getMessage(chainId string) (string, error) {
+// Generate a message based on chain probabilities, preferring the sub-chain of
+// the triggering message's language and then the channel's sub-chain when the
+// guild keeps them. A non-empty prompt is the message being answered: text is
+// then seeded from its keywords (see ChainsService.Reply). media reports that
+// the message is a GIF, image or video URL rather than generated text.
+func (h *MessageHandler) getMessage(chainId, channelId, lang, prompt string) (message string, media bool, err error) {
 	// Generate a random number between 4 and 25 (inclusive).
 	random := utils.GetRandom(4, 25)
 
@@ -202,43 +233,51 @@ func (h *MessageHandler) getMessage(chainId string) (string, error) {
 	// (21/22 or approx. 95.5%) to just talk.
 	case random <= 21:
 		{
-			msg, err := h.ChainsService.Generate(context.Background(), chainId, random)
+			msg, err := h.talk(chainId, channelId, lang, prompt, random)
 			if err != nil {
-				return "", err
+				return "", false, err
 			}
-			return msg, nil
+			return msg, false, nil
 		}
 
 	// (2/22 or approx. 9.1%) for a GIF
 	case random <= 23:
-		return h.tryGetMediaOrTalk(chainId, "gif", random)
+		return h.tryGetMediaOrTalk(chainId, channelId, lang, prompt, "gif", random)
 
 	// (1/22 or approx. 4.5%) for an Image
 	case random <= 24:
-		return h.tryGetMediaOrTalk(chainId, "image", random)
+		return h.tryGetMediaOrTalk(chainId, channelId, lang, prompt, "image", random)
 
 	// (1/22 or approx. 4.5%) for a Video
 	default:
-		return h.tryGetMediaOrTalk(chainId, "video", random)
+		return h.tryGetMediaOrTalk(chainId, channelId, lang, prompt, "video", random)
 	}
 }
 
 // tryGetMediaOrTalk attempts to retrieve a specific type of media;
 // if unavailable, it falls back to generating a text message.
-func (h *MessageHandler) tryGetMediaOrTalk(chainId string, mediaType string, random int) (string, error) {
+func (h *MessageHandler) tryGetMediaOrTalk(chainId, channelId, lang, prompt string, mediaType string, random int) (string, bool, error) {
 	ctx := context.Background()
 	media, err := h.ChainsService.GetRandomMedia(ctx, chainId, mediaType)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	if media != "" {
-		return media, nil
+		return media, true, nil
 	}
 
 	// Fallback to text generation if media is not available.
-	msg, err := h.ChainsService.Generate(ctx, chainId, random)
+	msg, err := h.talk(chainId, channelId, lang, prompt, random)
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	return msg, false, nil
+}
+
+// talk generates text, answering prompt when it is set.
+func (h *MessageHandler) talk(chainId, channelId, lang, prompt string, maxLength int) (string, error) {
+	if prompt != "" {
+		return h.ChainsService.Reply(context.Background(), chainId, channelId, lang, prompt, maxLength)
 	}
-	return msg, nil
+	return h.ChainsService.Generate(context.Background(), chainId, channelId, lang, maxLength)
 }
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"io"
+	"rolando/internal/logger"
+	"rolando/internal/repositories"
+	"time"
+)
+
+// BackupService periodically writes a snapshot of every guild chain to disk
+// and restores chains from those snapshots on demand.
+type BackupService struct {
+	ChainService  *ChainsService
+	SnapshotsRepo *repositories.SnapshotsRepository
+	// Interval between two snapshot rounds; 0 disables the scheduled job but
+	// keeps manual snapshots and restores available.
+	Interval time.Duration
+}
+
+func NewBackupService(chainService *ChainsService, snapshotsRepo *repositories.SnapshotsRepository, interval time.Duration) *BackupService {
+	return &BackupService{ChainService: chainService, SnapshotsRepo: snapshotsRepo, Interval: interval}
+}
+
+// Start runs the snapshot job in the background until ctx is done. The first
+// round runs one interval after startup, so restarts don't pile up snapshots.
+func (b *BackupService) Start(ctx context.Context) {
+	if b.Interval <= 0 {
+		logger.Infof("backup: scheduled snapshots disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(b.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				b.snapshotAll(ctx)
+			}
+		}
+	}()
+}
+
+// snapshotAll snapshots the chains one at a time to keep the load on the
+// cache service flat. Empty chains are skipped, so a chain that was reset or
+// lost its cache data does not push its good snapshots out of retention.
+func (b *BackupService) snapshotAll(ctx context.Context) {
+	chains, err := b.ChainService.GetAllChains(ctx)
+	if err != nil {
+		logger.Errorf("backup: failed to list chains: %v", err)
+		return
+	}
+	start := time.Now()
+	written, empty := 0, 0
+	for _, chain := range chains {
+		if ctx.Err() != nil {
+			return
+		}
+		prefixes, messages, _, err := b.ChainService.cacheRepo.GetStats(ctx, chain.ID)
+		if err != nil {
+			logger.Errorf("backup: failed to get stats for %s: %v", chain.ID, err)
+			continue
+		}
+		if prefixes == 0 && messages == 0 {
+			empty++
+			continue
+		}
+		if _, err := b.Snapshot(ctx, chain.ID); err != nil {
+			logger.Errorf("backup: snapshot failed for %s: %v", chain.ID, err)
+			continue
+		}
+		written++
+	}
+	logger.Infof("backup: wrote %d/%d chain snapshots (%d empty skipped) in %s", written, len(chains), empty, time.Since(start).Round(time.Second))
+}
+
+// Snapshot dumps a guild chain to a new snapshot file, pruning the oldest
+// ones beyond the retention count.
+func (b *BackupService) Snapshot(ctx context.Context, id string) (*repositories.Snapshot, error) {
+	return b.SnapshotsRepo.Create(id, func(w io.Writer) error {
+		return b.ChainService.ExportChain(ctx, id, w)
+	})
+}
+
+// ListSnapshots returns a guild's snapshots, newest first.
+func (b *BackupService) ListSnapshots(id string) ([]repositories.Snapshot, error) {
+	return b.SnapshotsRepo.List(id)
+}
+
+// Restore replaces a guild chain with one of its snapshots ("latest" for the
+// newest). An empty snapshot is refused with repositories.ErrEmptyChainDump
+// unless force is set.
+func (b *BackupService) Restore(ctx context.Context, id, name string, force bool) (*repositories.Snapshot, *repositories.ImportResult, error) {
+	f, snapshot, err := b.SnapshotsRepo.Open(id, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	// The chain is wiped before reloading; a caller going away halfway must
+	// not leave it empty.
+	res, err := b.ChainService.RestoreChain(context.WithoutCancel(ctx), id, f, force)
+	if err != nil {
+		return snapshot, res, err
+	}
+	logger.Infof("Restored chain %s from snapshot %s", id, snapshot.Name)
+	return snapshot, res, nil
+}
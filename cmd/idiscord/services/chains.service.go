@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"rolando/internal/analytics"
+	"rolando/internal/data"
+	"rolando/internal/langdetect"
 	"rolando/internal/logger"
 	"rolando/internal/repositories"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/snowflake/v2"
@@ -17,11 +22,15 @@ import (
 type ChainsService struct {
 	session      *bot.Client
 	chainsRepo   *repositories.ChainsRepository
-	cacheRepo    *repositories.CacheRepository
+	cacheRepo    repositories.ChainStore
 	messagesRepo *repositories.MessagesRepository
+	optOutsRepo  *repositories.OptOutsRepository
 
-	// rebuildMu prevents concurrent rebuilds of the same guild.
-	rebuildMu sync.Map // map[string]*sync.Mutex
+	// rebuildMu serialises the rebuilds of each guild (see rebuild).
+	rebuildMu sync.Map // map[string]*rebuildQueue
+
+	// erasures tracks /forgetme jobs by AuthorChainID(guild, user).
+	erasures sync.Map // map[string]*erasureJob
 
 	// bulkTrainingMu ensures at most one bulk cache train (history import or
 	// n-gram rebuild) runs at a time so long train_batch scripts do not stack
@@ -32,14 +41,16 @@ type ChainsService struct {
 func NewChainsService(
 	client *bot.Client,
 	chainsRepo *repositories.ChainsRepository,
-	cacheRepo *repositories.CacheRepository,
+	cacheRepo repositories.ChainStore,
 	messagesRepo *repositories.MessagesRepository,
+	optOutsRepo *repositories.OptOutsRepository,
 ) *ChainsService {
 	return &ChainsService{
 		session:      client,
 		chainsRepo:   chainsRepo,
 		cacheRepo:    cacheRepo,
 		messagesRepo: messagesRepo,
+		optOutsRepo:  optOutsRepo,
 	}
 }
 
@@ -47,34 +58,454 @@ func (cs *ChainsService) NewMarkovAnalyzer(chain *repositories.ChainConfig) *ana
 	return analytics.NewMarkovChainAnalyzer(chain, cs.cacheRepo)
 }
 
-func (cs *ChainsService) Train(ctx context.Context, guildID, message string, nGramSize, maxSizeBytes, maxBranches int) error {
-	return cs.cacheRepo.Train(ctx, guildID, message, nGramSize, maxSizeBytes, maxBranches)
+func (cs *ChainsService) Train(ctx context.Context, guildID, message string, nGramSize int, limit repositories.SizeLimit, maxBranches int) error {
+	chain := cs.generationConf(ctx, guildID)
+	tok := chain.TextTokenizer()
+	if err := cs.cacheRepo.Train(ctx, guildID, message, nGramSize, limit, maxBranches, tok); err != nil {
+		return err
+	}
+	if err := cs.cacheRepo.IndexKeywords(ctx, guildID, []string{message}, tok); err != nil {
+		return err
+	}
+	return cs.cacheRepo.IndexRhymes(ctx, guildID, []string{message}, chain.Language(), tok)
+}
+
+// minChannelChainMessages is how many messages a channel sub-chain needs before
+// Generate prefers it over the guild chain; thinner chains mostly parrot.
+const minChannelChainMessages = 50
+
+// minLanguageChainMessages is the same threshold for language sub-chains.
+const minLanguageChainMessages = 50
+
+// Generate produces text for a guild. When the guild keeps language chains
+// and lang is set (usually the language of the triggering message), that
+// language's sub-chain is tried first. Next, when the guild is channel-scoped
+// and channelID is set, the channel's sub-chain is tried, falling back to the
+// guild chain when it is too small or yields nothing. The text always fits in
+// a single Discord message.
+func (cs *ChainsService) Generate(ctx context.Context, guildID, channelID, lang string, maxLength int) (string, error) {
+	chain := cs.generationConf(ctx, guildID)
+	return cs.guardNovelty(ctx, chain, func() (string, error) {
+		return cs.generate(ctx, chain, channelID, lang, maxLength)
+	})
+}
+
+func (cs *ChainsService) generate(ctx context.Context, chain *repositories.ChainConfig, channelID, lang string, maxLength int) (string, error) {
+	guildID := chain.ID
+	if chain.LanguageChains && lang != "" {
+		subID := repositories.LanguageChainID(guildID, lang)
+		if _, msgs, _, err := cs.cacheRepo.GetStats(ctx, subID); err == nil && msgs >= minLanguageChainMessages {
+			if msg, err := cs.cacheRepo.GenerateConstrained(ctx, subID, replyConstraints(maxLength), chain.Sampling(), chain.TextTokenizer()); err == nil && msg != "" {
+				return detokenize(chain, msg, nil)
+			}
+		}
+	}
+	if chain.ChannelScoped() && channelID != "" {
+		subID := repositories.ChannelChainID(guildID, channelID)
+		if _, msgs, _, err := cs.cacheRepo.GetStats(ctx, subID); err == nil && msgs >= minChannelChainMessages {
+			if msg, err := cs.cacheRepo.GenerateConstrained(ctx, subID, replyConstraints(maxLength), chain.Sampling(), chain.TextTokenizer()); err == nil && msg != "" {
+				return detokenize(chain, msg, nil)
+			}
+		}
+	}
+	msg, err := cs.cacheRepo.GenerateConstrained(ctx, guildID, replyConstraints(maxLength), chain.Sampling(), chain.TextTokenizer())
+	return detokenize(chain, msg, err)
+}
+
+// DiscordMaxMessageLength is the most characters a Discord message can hold.
+const DiscordMaxMessageLength = 2000
+
+// replyConstraints bounds chat replies to maxLength words and to what Discord
+// accepts in one message.
+func replyConstraints(maxLength int) repositories.Constraints {
+	return repositories.Constraints{MaxWords: maxLength, MaxChars: DiscordMaxMessageLength}
+}
+
+// authorChainMaxSizeBytes, channelChainMaxSizeBytes and
+// languageChainMaxSizeBytes cap each author, channel and language sub-chain,
+// on top of the guild's own size limit. Each group of sub-chains also stays
+// within the guild's limit (see subChainLimit), so busy servers do not grow
+// one extra chain per member or channel unbounded.
+const (
+	authorChainMaxSizeBytes   = 2 * 1024 * 1024
+	channelChainMaxSizeBytes  = 8 * 1024 * 1024
+	languageChainMaxSizeBytes = 16 * 1024 * 1024
+)
+
+// subChainLimit returns the size limit of one of doc's author, channel or
+// language sub-chains: the guild's limit capped at maxBytes, with the guild's
+// limit as the budget the sub-chain's whole group shares.
+func subChainLimit(doc *repositories.ChainConfig, maxBytes int) repositories.SizeLimit {
+	limit := doc.SizeLimit()
+	limit.GroupMaxBytes = limit.MaxBytes
+	if limit.MaxBytes <= 0 || limit.MaxBytes > maxBytes {
+		limit.MaxBytes = maxBytes
+	}
+	return limit
+}
+
+// MinImitationMessages is how many messages a member's author sub-chain needs
+// before /imitate will use it.
+const MinImitationMessages = 100
+
+var (
+	ErrImitationOptedOut      = errors.New("member opted out of being imitated")
+	ErrNotEnoughImitationData = errors.New("not enough messages to imitate member")
+)
+
+// Imitate generates text from a member's author sub-chain. It fails with
+// ErrImitationOptedOut or ErrNotEnoughImitationData instead of falling back
+// to the guild chain, so the output is never passed off as someone's voice.
+// Author sub-chains are small and the likeliest to repeat one of the member's
+// messages word for word, so the output goes through guardNovelty.
+func (cs *ChainsService) Imitate(ctx context.Context, guildID, userID string, maxLength int) (string, error) {
+	optedOut, err := cs.optOutsRepo.IsOptedOut(guildID, userID)
+	if err != nil {
+		return "", err
+	}
+	if optedOut {
+		return "", ErrImitationOptedOut
+	}
+	subID := repositories.AuthorChainID(guildID, userID)
+	_, msgs, _, err := cs.cacheRepo.GetStats(ctx, subID)
+	if err != nil {
+		return "", err
+	}
+	if msgs < MinImitationMessages {
+		return "", ErrNotEnoughImitationData
+	}
+	chain := cs.generationConf(ctx, guildID)
+	return cs.guardNovelty(ctx, chain, func() (string, error) {
+		msg, err := cs.cacheRepo.GenerateFiltered(ctx, subID, maxLength, chain.Sampling())
+		return detokenize(chain, msg, err)
+	})
+}
+
+// SetImitationOptOut adds or removes a member from the guild's /imitate
+// opt-out list. Opting out also drops their author sub-chain; opting back in
+// only affects messages trained from then on (or after a retrain).
+func (cs *ChainsService) SetImitationOptOut(ctx context.Context, guildID, userID string, optOut bool) error {
+	if !optOut {
+		return cs.optOutsRepo.OptIn(guildID, userID)
+	}
+	if err := cs.optOutsRepo.OptOut(guildID, userID); err != nil {
+		return err
+	}
+	return cs.cacheRepo.DropAuthorChain(ctx, guildID, userID)
+}
+
+// IsImitationOptedOut reports whether a member refused to be imitated in the guild.
+func (cs *ChainsService) IsImitationOptedOut(_ context.Context, guildID, userID string) (bool, error) {
+	return cs.optOutsRepo.IsOptedOut(guildID, userID)
+}
+
+var (
+	ErrCrossoverNotAllowed = errors.New("both guilds must allow crossover")
+	ErrCrossoverSameGuild  = errors.New("cannot cross a chain with itself")
+)
+
+// Crossover generates text from a blend of two guild chains. weight is the
+// other guild's share of every transition, from 0 (guildID only) to 100
+// (otherID only). Both guilds must have opted in with allow_crossover; the
+// sampling settings and tokenizer of guildID are used. The output may copy a
+// message of either guild, so it goes through both guilds' novelty guards.
+func (cs *ChainsService) Crossover(ctx context.Context, guildID, otherID string, weight, maxLength int) (string, error) {
+	if guildID == otherID {
+		return "", ErrCrossoverSameGuild
+	}
+	chain, err := cs.GetChainConf(ctx, guildID)
+	if err != nil {
+		return "", err
+	}
+	other, err := cs.chainsRepo.GetChainByID(otherID)
+	if err != nil {
+		return "", fmt.Errorf("chain %s not found: %w", otherID, err)
+	}
+	if !chain.AllowCrossover || !other.AllowCrossover {
+		return "", ErrCrossoverNotAllowed
+	}
+	weight = min(max(weight, 0), 100)
+	weights := []float64{float64(100-weight) / 100, float64(weight) / 100}
+	return cs.guardNovelty(ctx, chain, func() (string, error) {
+		msg, err := cs.cacheRepo.GenerateCrossover(ctx, []string{guildID, otherID}, weights, maxLength, chain.Sampling())
+		return detokenize(chain, msg, err)
+	}, other)
+}
+
+// replyKeywordAttempts is how many keywords of the triggering message Reply
+// tries as seeds before generating freely.
+const replyKeywordAttempts = 3
+
+// Reply generates an answer to text, a message addressed to the bot. It is
+// seeded from the rarest of text's words that the guild chain knows, so the
+// answer stays on what was asked; without such a word, or when no keyword
+// yields anything, it falls back to Generate.
+func (cs *ChainsService) Reply(ctx context.Context, guildID, channelID, lang, text string, maxLength int) (string, error) {
+	chain := cs.generationConf(ctx, guildID)
+	keywords, err := cs.cacheRepo.PickKeywords(ctx, guildID, text, replyKeywordAttempts, chain.TextTokenizer())
+	if err != nil {
+		logger.Warnf("Reply: PickKeywords failed for %s: %v", guildID, err)
+	}
+	for _, keyword := range keywords {
+		msg, err := cs.guardNovelty(ctx, chain, func() (string, error) {
+			msg, err := cs.cacheRepo.GenerateFromSeed(ctx, guildID, keyword, maxLength, chain.Sampling(), chain.TextTokenizer())
+			return detokenize(chain, msg, err)
+		})
+		if err != nil {
+			return "", err
+		}
+		if msg != "" {
+			return msg, nil
+		}
+	}
+	return cs.Generate(ctx, guildID, channelID, lang, maxLength)
+}
+
+// Conversations remember the last conversationExchanges prompt/answer pairs
+// of a channel, and are forgotten after conversationTTL without one.
+const (
+	conversationTTL       = 10 * time.Minute
+	conversationExchanges = 3
+)
+
+// Conversation returns the messages of the channel's ongoing conversation
+// with the bot, oldest first, and whether the bot may still answer in it.
+// Conversations stop after the chain's ConversationTurns answers, which bounds
+// both the context fed into each answer and the generation work a single
+// channel can ask for by replying in a loop. Always closed when
+// ConversationTurns is 0.
+func (cs *ChainsService) Conversation(ctx context.Context, guildID, channelID string) (history []string, open bool, err error) {
+	chain := cs.generationConf(ctx, guildID)
+	if chain.ConversationTurns <= 0 {
+		return nil, false, nil
+	}
+	turns, history, err := cs.cacheRepo.GetConversation(ctx, guildID, channelID)
+	if err != nil {
+		return nil, false, err
+	}
+	return history, turns < int64(chain.ConversationTurns), nil
 }
 
-func (cs *ChainsService) Generate(ctx context.Context, guildID string, maxLength int) (string, error) {
-	return cs.cacheRepo.Generate(ctx, guildID, maxLength)
+// RememberExchange adds the bot's answer to prompt to the channel's
+// conversation, starting one when there is none.
+func (cs *ChainsService) RememberExchange(ctx context.Context, guildID, channelID, prompt, answer string) error {
+	_, err := cs.cacheRepo.PushConversation(ctx, guildID, channelID, conversationTTL, 2*conversationExchanges, prompt, answer)
+	return err
 }
 
+// GenerateFromSeed generates a sentence around seed. When the chain has never
+// seen seed it generates freely instead, as seeded generation always did.
 func (cs *ChainsService) GenerateFromSeed(ctx context.Context, guildID, seed string, maxLength int) (string, error) {
-	return cs.cacheRepo.GenerateFromSeed(ctx, guildID, seed, maxLength)
+	chain := cs.generationConf(ctx, guildID)
+	msg, err := cs.guardNovelty(ctx, chain, func() (string, error) {
+		msg, err := cs.cacheRepo.GenerateFromSeed(ctx, guildID, seed, maxLength, chain.Sampling(), chain.TextTokenizer())
+		return detokenize(chain, msg, err)
+	})
+	if err != nil || msg != "" {
+		return msg, err
+	}
+	return cs.Generate(ctx, guildID, "", "", maxLength)
 }
 
 func (cs *ChainsService) GenerateRhyme(ctx context.Context, guildID, rhymeWord string, maxLength int) (string, error) {
-	return cs.cacheRepo.GenerateRhyme(ctx, guildID, rhymeWord, maxLength)
+	chain := cs.generationConf(ctx, guildID)
+	return cs.guardNovelty(ctx, chain, func() (string, error) {
+		msg, err := cs.cacheRepo.GenerateRhyme(ctx, guildID, rhymeWord, chain.Language(), maxLength, chain.Sampling())
+		return detokenize(chain, msg, err)
+	})
 }
 
 func (cs *ChainsService) GenerateRhymeFiltered(ctx context.Context, guildID, rhymeWord string, maxLength int) (string, error) {
-	return cs.cacheRepo.GenerateRhymeFiltered(ctx, guildID, rhymeWord, maxLength)
+	chain := cs.generationConf(ctx, guildID)
+	return cs.guardNovelty(ctx, chain, func() (string, error) {
+		msg, err := cs.cacheRepo.GenerateRhymeFiltered(ctx, guildID, rhymeWord, chain.Language(), maxLength, chain.Sampling())
+		return detokenize(chain, msg, err)
+	})
+}
+
+// GenerateCouplets generates count rhyming couplets, one line each. The first
+// couplet rhymes with rhymeWord; every later couplet opens with a free line
+// and closes with one rhyming with it. Each line goes through guardNovelty;
+// lines that come out empty are dropped.
+func (cs *ChainsService) GenerateCouplets(ctx context.Context, guildID, rhymeWord string, count int, lineLength func() int) ([]string, error) {
+	chain := cs.generationConf(ctx, guildID)
+	lang := chain.Language()
+	gen := func(target string) (string, error) {
+		return cs.guardNovelty(ctx, chain, func() (string, error) {
+			if target == "" {
+				msg, err := cs.cacheRepo.Generate(ctx, guildID, lineLength(), chain.Sampling())
+				return detokenize(chain, msg, err)
+			}
+			msg, err := cs.cacheRepo.GenerateRhyme(ctx, guildID, target, lang, lineLength(), chain.Sampling())
+			return detokenize(chain, msg, err)
+		})
+	}
+
+	lines := make([]string, 0, 2*count)
+	target := rhymeWord
+	for range count {
+		first, err := gen(target)
+		if err != nil {
+			return lines, err
+		}
+		if first == "" {
+			continue
+		}
+		second, err := gen(first)
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, first)
+		if second != "" {
+			lines = append(lines, second)
+		}
+		target = ""
+	}
+	return lines, nil
 }
 func (cs *ChainsService) GenerateFiltered(ctx context.Context, guildID string, maxLength int) (string, error) {
-	return cs.cacheRepo.GenerateFiltered(ctx, guildID, maxLength)
+	chain := cs.generationConf(ctx, guildID)
+	msg, err := cs.cacheRepo.GenerateFiltered(ctx, guildID, maxLength, chain.Sampling())
+	return detokenize(chain, msg, err)
 }
 
-func (cs *ChainsService) GenerateLine(ctx context.Context, guildID string, maxWords int) (string, error) {
+// maxNoveltyAttempts is how many times a copying generation is retried before
+// the last attempt is truncated instead.
+const maxNoveltyAttempts = 3
+
+// guardNovelty runs gen until its output no longer copies NoveltyRunLength
+// consecutive tokens (or the whole text) of a single stored message of chain,
+// or of any of others when given (each with its own run length). When every
+// attempt copies, the last output is cut just before the copied runs
+// complete, which may leave nothing. Index lookup failures let the output
+// through rather than failing generation.
+func (cs *ChainsService) guardNovelty(ctx context.Context, chain *repositories.ChainConfig, gen func() (string, error), others ...*repositories.ChainConfig) (string, error) {
+	var guarded []*repositories.ChainConfig
+	for _, c := range append([]*repositories.ChainConfig{chain}, others...) {
+		if c.NoveltyGuarded() {
+			guarded = append(guarded, c)
+		}
+	}
+	if len(guarded) == 0 {
+		return gen()
+	}
+	var msg string
+	for range maxNoveltyAttempts {
+		var err error
+		if msg, err = gen(); err != nil || msg == "" {
+			return msg, err
+		}
+		if c, _ := cs.copiedRun(ctx, guarded, msg); c == nil {
+			return msg, nil
+		}
+	}
+	// Cutting before one copied run may leave an earlier one of another
+	// chain, so cut until none is left.
+	for msg != "" {
+		c, start := cs.copiedRun(ctx, guarded, msg)
+		if c == nil {
+			break
+		}
+		tok := c.TextTokenizer()
+		tokens := tok.Tokenize(msg)
+		keep := min(len(tokens)-1, start+c.NoveltyRunLength-1)
+		if keep <= 0 {
+			return "", nil
+		}
+		msg = tok.Detokenize(tokens[:keep])
+	}
+	return msg, nil
+}
+
+// copiedRun returns the first of chains whose novelty index finds a copied
+// run in msg, and the token the run starts at. Chains whose lookup fails are
+// skipped.
+func (cs *ChainsService) copiedRun(ctx context.Context, chains []*repositories.ChainConfig, msg string) (*repositories.ChainConfig, int) {
+	for _, c := range chains {
+		start, err := cs.cacheRepo.FindCopiedRun(ctx, c.ID, msg, c.NoveltyRunLength, c.TextTokenizer())
+		if err != nil {
+			logger.Warnf("novelty check failed for %s: %v", c.ID, err)
+			continue
+		}
+		if start >= 0 {
+			return c, start
+		}
+	}
+	return nil, -1
+}
+
+// DetectLanguage returns the language of text among data.Langs, or "" when
+// it cannot be told.
+func (cs *ChainsService) DetectLanguage(text string) string {
+	return langdetect.Detect(text)
+}
+
+// ListeningLanguage returns the language voice chat is transcribed in. With
+// an automatic TTS language it is the guild's most used language.
+func (cs *ChainsService) ListeningLanguage(ctx context.Context, chain *repositories.ChainConfig) string {
+	if !chain.AutoLanguage() {
+		return chain.TTSLanguage
+	}
+	return cs.dominantLanguage(ctx, chain)
+}
+
+// SpeechLanguage returns the language text is spoken in. With an automatic
+// TTS language it is detected from text, falling back to ListeningLanguage.
+func (cs *ChainsService) SpeechLanguage(ctx context.Context, chain *repositories.ChainConfig, text string) string {
+	if !chain.AutoLanguage() {
+		return chain.TTSLanguage
+	}
+	if lang := langdetect.Detect(text); lang != "" {
+		return lang
+	}
+	return cs.dominantLanguage(ctx, chain)
+}
+
+// dominantLanguage returns the language whose sub-chain holds the most
+// messages, or chain.Language() without language chains.
+func (cs *ChainsService) dominantLanguage(ctx context.Context, chain *repositories.ChainConfig) string {
+	best, bestMsgs := chain.Language(), int64(0)
+	if !chain.LanguageChains {
+		return best
+	}
+	for _, lang := range data.Langs {
+		if _, msgs, _, err := cs.cacheRepo.GetStats(ctx, repositories.LanguageChainID(chain.ID, lang)); err == nil && msgs > bestMsgs {
+			best, bestMsgs = lang, msgs
+		}
+	}
+	return best
+}
+
+// generationConf returns the guild's config, falling back to a bare one
+// (raw-count sampling, whitespace tokens, no novelty guard) when it cannot be
+// loaded.
+func (cs *ChainsService) generationConf(ctx context.Context, guildID string) *repositories.ChainConfig {
+	chain, err := cs.GetChainConf(ctx, guildID)
+	if err != nil {
+		return &repositories.ChainConfig{ID: guildID}
+	}
+	return chain
+}
+
+// detokenize turns the space-joined tokens the chain store generates back
+// into text with the chain's tokenizer.
+func detokenize(chain *repositories.ChainConfig, msg string, err error) (string, error) {
+	if err != nil || msg == "" {
+		return msg, err
+	}
+	return chain.TextTokenizer().Detokenize(strings.Fields(msg)), nil
+}
+
+// GenerateConstrained generates text for a guild within c (see
+// repositories.Constraints) with the guild's sampling and tokenizer. Returns
+// "" when the chain cannot satisfy the constraints.
+func (cs *ChainsService) GenerateConstrained(ctx context.Context, guildID string, c repositories.Constraints) (string, error) {
 	if guildID == "" {
 		return "", fmt.Errorf("empty guild id")
 	}
-	return cs.GenerateFiltered(ctx, guildID, maxWords)
+	chain := cs.generationConf(ctx, guildID)
+	msg, err := cs.cacheRepo.GenerateConstrained(ctx, guildID, c, chain.Sampling(), chain.TextTokenizer())
+	return detokenize(chain, msg, err)
 }
 
 func (cs *ChainsService) GetRandomMedia(ctx context.Context, guildID, kind string) (string, error) {
@@ -112,8 +543,6 @@ func (cs *ChainsService) CreateChain(_ context.Context, id, name string) (*repos
 	return cs.chainsRepo.CreateChain(id, name)
 }
 
-// UpdateChainState ingests a batch of raw messages into the cache service.
-// The guild's configured size limit is enforced inside the Lua function.
 // RunBulkCacheTraining runs fn while holding a process-wide lock for heavy
 // cache ingestion (full history fetch or chain rebuild). Live UpdateChainState
 // calls from message events do not use this lock.
@@ -123,36 +552,350 @@ func (cs *ChainsService) RunBulkCacheTraining(fn func()) {
 	fn()
 }
 
-func (cs *ChainsService) UpdateChainState(ctx context.Context, id string, texts []string) error {
+// UpdateChainState ingests a batch of raw messages from one channel into the
+// cache service. Channel-scoped guilds also train the channel's sub-chain,
+// within subChainLimit and the guild's branching limit, and guilds with
+// language chains route each message to the sub-chain of its detected
+// language. Messages with an AuthorID also train that member's author
+// sub-chain for /imitate.
+func (cs *ChainsService) UpdateChainState(ctx context.Context, id, channelID string, messages []repositories.Message) error {
 	chain, err := cs.GetChainConf(ctx, id)
 	if err != nil {
 		return err
 	}
-	if err := cs.cacheRepo.TrainBatch(ctx, id, texts, chain.NGramSize, chain.MaxSizeBytes(), chain.MarkovMaxBranches); err != nil {
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		texts = append(texts, m.Content)
+	}
+	tok := chain.TextTokenizer()
+	if err := cs.cacheRepo.TrainBatch(ctx, id, texts, chain.NGramSize, chain.SizeLimit(), chain.MarkovMaxBranches, tok); err != nil {
 		logger.Errorf("UpdateChainState train error for %s: %v", id, err)
 	}
+	if chain.ChannelScoped() && channelID != "" {
+		if err := cs.cacheRepo.TrainChannelBatch(ctx, id, channelID, texts, chain.NGramSize, subChainLimit(chain, channelChainMaxSizeBytes), chain.MarkovMaxBranches, tok); err != nil {
+			logger.Errorf("UpdateChainState channel train error for %s/%s: %v", id, channelID, err)
+		}
+	}
+	if chain.LanguageChains {
+		cs.trainLanguageChains(ctx, chain, texts, chain.NGramSize)
+	}
+	cs.trainAuthorChains(ctx, chain, messages, chain.NGramSize)
+	if chain.NoveltyGuarded() {
+		if err := cs.cacheRepo.IndexNovelty(ctx, id, texts, chain.NoveltyRunLength, tok); err != nil {
+			logger.Errorf("UpdateChainState novelty index error for %s: %v", id, err)
+		}
+	}
+	if err := cs.cacheRepo.IndexRhymes(ctx, id, texts, chain.Language(), tok); err != nil {
+		logger.Errorf("UpdateChainState rhyme index error for %s: %v", id, err)
+	}
+	if err := cs.cacheRepo.IndexKeywords(ctx, id, texts, tok); err != nil {
+		logger.Errorf("UpdateChainState keyword index error for %s: %v", id, err)
+	}
 	return nil
 }
 
 // DeleteTextData removes a message from both cache state and the SQLite message store.
+// Every stored copy is untrained from the chains it was trained under; text
+// with no stored copy is still untrained from the guild chain once.
 func (cs *ChainsService) DeleteTextData(ctx context.Context, id, data string) error {
 	chain, err := cs.GetChainConf(ctx, id)
 	if err != nil {
 		return err
 	}
-	if err := cs.cacheRepo.Delete(ctx, id, data, chain.NGramSize); err != nil {
-		logger.Errorf("DeleteTextData cache error for %s: %v", id, err)
+	stored, err := cs.messagesRepo.GetGuildMessagesByContent(id, data)
+	if err != nil {
+		logger.Errorf("DeleteTextData lookup error for %s: %v", id, err)
+	}
+	if len(stored) == 0 {
+		stored = []repositories.Message{{Content: data}}
+	}
+	for _, m := range stored {
+		cs.untrainMessage(ctx, chain, m)
 	}
 	return cs.messagesRepo.DeleteGuildMessage(id, data)
 }
 
+// StoreMessages persists live messages to the SQLite message store, so they
+// survive rebuilds and can be untrained when deleted or edited on Discord.
+func (cs *ChainsService) StoreMessages(id, channelID string, messages []repositories.Message) error {
+	return cs.messagesRepo.AddMessagesToGuild(id, channelID, messages)
+}
+
+// DeleteDiscordMessages untrains and removes every row stored for the given
+// Discord messages. Messages that were never stored are ignored.
+func (cs *ChainsService) DeleteDiscordMessages(ctx context.Context, id string, messageIDs []string) error {
+	stored, err := cs.messagesRepo.GetGuildMessagesByMessageIDs(id, messageIDs)
+	if err != nil || len(stored) == 0 {
+		return err
+	}
+	chain, err := cs.GetChainConf(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, m := range stored {
+		cs.untrainMessage(ctx, chain, m)
+	}
+	return cs.messagesRepo.DeleteGuildMessagesByMessageIDs(id, messageIDs)
+}
+
+// EditDiscordMessage replaces the stored rows of an edited Discord message:
+// the old content and attachments are untrained and the new ones trained.
+// Messages that were never stored, and edits that leave the trainable
+// content unchanged (e.g. embeds resolving), are ignored.
+func (cs *ChainsService) EditDiscordMessage(ctx context.Context, id, channelID, messageID string, messages []repositories.Message) error {
+	stored, err := cs.messagesRepo.GetGuildMessagesByMessageIDs(id, []string{messageID})
+	if err != nil || len(stored) == 0 {
+		return err
+	}
+	if sameContents(stored, messages) {
+		return nil
+	}
+	chain, err := cs.GetChainConf(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, m := range stored {
+		cs.untrainMessage(ctx, chain, m)
+	}
+	if err := cs.messagesRepo.DeleteGuildMessagesByMessageIDs(id, []string{messageID}); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	if err := cs.UpdateChainState(ctx, id, channelID, messages); err != nil {
+		return err
+	}
+	return cs.messagesRepo.AddMessagesToGuild(id, channelID, messages)
+}
+
+// ErasureProgress reports how far a ForgetUser job got.
+type ErasureProgress struct {
+	GuildID    string     `json:"guild_id"`
+	UserID     string     `json:"user_id"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	Finished   bool       `json:"finished"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// Note tells what the erasure cannot cover (see ErasureCaveat).
+	Note string `json:"note"`
+}
+
+// ErasureCaveat is what an erasure leaves behind: messages stored without
+// their author, i.e. live messages from before author tracking and history
+// fetched before author sub-chains, cannot be told apart from anyone else's.
+const ErasureCaveat = "Messages stored without an author (received before author tracking, or fetched " +
+	"from history before author chains) cannot be attributed to the member and stay in the chain."
+
+type erasureJob struct {
+	mu       sync.Mutex
+	progress ErasureProgress
+}
+
+func (j *erasureJob) snapshot() ErasureProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+func (j *erasureJob) update(fn func(p *ErasureProgress)) ErasureProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.progress)
+	return j.progress
+}
+
+var ErrErasureInProgress = errors.New("an erasure is already running for this member")
+
+// erasureBatchSize is how many stored messages ForgetUser untrains between
+// progress reports.
+const erasureBatchSize = 200
+
+// ForgetUser starts erasing everything the bot learned from a member of a
+// guild: each stored message (attachment URLs included) is untrained from
+// the chains, media sets and indexes, then deleted, and the member's author
+// sub-chain is dropped. The job runs in the background; onProgress, if set,
+// is called after every batch and once more when it finishes. Messages
+// stored without an author cannot be attributed and are left alone (see
+// ErasureCaveat, which the progress carries as its Note).
+func (cs *ChainsService) ForgetUser(guildID, userID string, onProgress func(ErasureProgress)) (ErasureProgress, error) {
+	key := repositories.AuthorChainID(guildID, userID)
+	job := &erasureJob{progress: ErasureProgress{GuildID: guildID, UserID: userID, StartedAt: time.Now(), Note: ErasureCaveat}}
+	if prev, loaded := cs.erasures.LoadOrStore(key, job); loaded {
+		last := prev.(*erasureJob).snapshot()
+		if !last.Finished || !cs.erasures.CompareAndSwap(key, prev, job) {
+			return last, ErrErasureInProgress
+		}
+	}
+	report := func(p ErasureProgress) {
+		if onProgress != nil {
+			onProgress(p)
+		}
+	}
+
+	go func() {
+		ctx := context.Background()
+		err := cs.forgetUser(ctx, job, report)
+		p := job.update(func(p *ErasureProgress) {
+			now := time.Now()
+			p.Finished, p.FinishedAt = true, &now
+			if err != nil {
+				p.Error = err.Error()
+			}
+		})
+		if err != nil {
+			logger.Errorf("ForgetUser failed for %s@%s after %d/%d messages: %v", guildID, userID, p.Done, p.Total, err)
+		} else {
+			logger.Infof("ForgetUser erased %d messages of %s@%s", p.Done, guildID, userID)
+		}
+		report(p)
+	}()
+	return job.snapshot(), nil
+}
+
+func (cs *ChainsService) forgetUser(ctx context.Context, job *erasureJob, report func(ErasureProgress)) error {
+	p := job.snapshot()
+	chain, err := cs.GetChainConf(ctx, p.GuildID)
+	if err != nil {
+		return err
+	}
+	total, err := cs.messagesRepo.CountGuildMessagesByAuthor(p.GuildID, p.UserID)
+	if err != nil {
+		return err
+	}
+	report(job.update(func(p *ErasureProgress) { p.Total = total }))
+
+	err = cs.messagesRepo.ScanGuildMessagesByAuthor(p.GuildID, p.UserID, erasureBatchSize, func(rows []repositories.Message) error {
+		ids := make([]uint, len(rows))
+		for i, m := range rows {
+			cs.untrainMessage(ctx, chain, m)
+			ids[i] = m.ID
+		}
+		if err := cs.messagesRepo.DeleteMessagesByIDs(ids); err != nil {
+			return err
+		}
+		report(job.update(func(p *ErasureProgress) { p.Done += int64(len(rows)) }))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return cs.cacheRepo.DropAuthorChain(ctx, p.GuildID, p.UserID)
+}
+
+// ErasureStatus returns the progress of the latest ForgetUser job for a
+// member, if any ran since startup.
+func (cs *ChainsService) ErasureStatus(guildID, userID string) (ErasureProgress, bool) {
+	job, ok := cs.erasures.Load(repositories.AuthorChainID(guildID, userID))
+	if !ok {
+		return ErasureProgress{}, false
+	}
+	return job.(*erasureJob).snapshot(), true
+}
+
+func sameContents(a, b []repositories.Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	contents := make(map[string]int, len(a))
+	for _, m := range a {
+		contents[m.Content]++
+	}
+	for _, m := range b {
+		if contents[m.Content] == 0 {
+			return false
+		}
+		contents[m.Content]--
+	}
+	return true
+}
+
+// untrainMessage removes one stored message from the guild chain, its media
+// sets and indexes, and every sub-chain UpdateChainState trained it into.
+func (cs *ChainsService) untrainMessage(ctx context.Context, chain *repositories.ChainConfig, m repositories.Message) {
+	id, data := chain.ID, m.Content
+	tok := chain.TextTokenizer()
+	if err := cs.cacheRepo.Delete(ctx, id, data, chain.NGramSize, tok); err != nil {
+		logger.Errorf("untrain cache error for %s: %v", id, err)
+	}
+	if err := cs.cacheRepo.UnindexRhymes(ctx, id, data, chain.Language(), tok); err != nil {
+		logger.Errorf("untrain rhyme index error for %s: %v", id, err)
+	}
+	if err := cs.cacheRepo.UnindexKeywords(ctx, id, data, tok); err != nil {
+		logger.Errorf("untrain keyword index error for %s: %v", id, err)
+	}
+	if chain.NoveltyGuarded() {
+		if err := cs.cacheRepo.UnindexNovelty(ctx, id, data, chain.NoveltyRunLength, tok); err != nil {
+			logger.Errorf("untrain novelty index error for %s: %v", id, err)
+		}
+	}
+	// Detection is deterministic, so the message was routed to this language.
+	if lang := langdetect.Detect(data); chain.LanguageChains && lang != "" {
+		if err := cs.cacheRepo.Delete(ctx, repositories.LanguageChainID(id, lang), data, chain.NGramSize, tok); err != nil {
+			logger.Errorf("untrain language cache error for %s#%s: %v", id, lang, err)
+		}
+	}
+	if chain.ChannelScoped() && m.ChannelID != "" {
+		if err := cs.cacheRepo.Delete(ctx, repositories.ChannelChainID(id, m.ChannelID), data, chain.NGramSize, tok); err != nil {
+			logger.Errorf("untrain channel cache error for %s/%s: %v", id, m.ChannelID, err)
+		}
+	}
+	if m.AuthorID != "" {
+		if err := cs.cacheRepo.Delete(ctx, repositories.AuthorChainID(id, m.AuthorID), data, chain.NGramSize, tok); err != nil {
+			logger.Errorf("untrain author cache error for %s@%s: %v", id, m.AuthorID, err)
+		}
+	}
+}
+
 // UpdateChainMeta applies field-level updates to SQLite and refreshes the
-// cache-backed config store. If n_gram_size changes, a rebuild is triggered in the
-// background.
+// cache-backed config store. If n_gram_size or tokenizer changes, a rebuild is
+// triggered in the background; a novelty_run_length change only rebuilds the
+// novelty index, a language change only the rhyme index and a
+// language_chains toggle only the language sub-chains.
 func (cs *ChainsService) UpdateChainMeta(ctx context.Context, id string, fields map[string]any) (*repositories.ChainConfig, error) {
 	if _, ok := fields["id"]; ok {
 		return nil, errors.New("cannot change field 'id'")
 	}
+	if scope, ok := fields["chain_scope"]; ok && scope != repositories.ChainScopeGuild && scope != repositories.ChainScopeChannel {
+		return nil, fmt.Errorf("invalid chain_scope %v", scope)
+	}
+	if tok, ok := fields["tokenizer"]; ok {
+		if name, _ := tok.(string); !repositories.IsTokenizer(name) {
+			return nil, fmt.Errorf("invalid tokenizer %v", tok)
+		}
+	}
+	if policy, ok := fields["eviction_policy"]; ok {
+		if name, _ := policy.(string); !repositories.IsEvictionPolicy(name) {
+			return nil, fmt.Errorf("invalid eviction_policy %v", policy)
+		}
+	}
+	if smoothing, ok := fields["smoothing"]; ok {
+		if d, err := strconv.ParseFloat(fmt.Sprint(smoothing), 64); err != nil || d < 0 || d >= 1 {
+			return nil, fmt.Errorf("invalid smoothing %v, must be in [0, 1)", smoothing)
+		}
+	}
+	if temperature, ok := fields["temperature"]; ok {
+		if d, err := strconv.ParseFloat(fmt.Sprint(temperature), 64); err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid temperature %v, must be above 0", temperature)
+		}
+	}
+	if topK, ok := fields["top_k"]; ok {
+		if n, err := strconv.Atoi(fmt.Sprint(topK)); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid top_k %v, must be 0 or more", topK)
+		}
+	}
+	if topP, ok := fields["top_p"]; ok {
+		if d, err := strconv.ParseFloat(fmt.Sprint(topP), 64); err != nil || d <= 0 || d > 1 {
+			return nil, fmt.Errorf("invalid top_p %v, must be in (0, 1]", topP)
+		}
+	}
+	if turns, ok := fields["conversation_turns"]; ok {
+		if n, err := strconv.Atoi(fmt.Sprint(turns)); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid conversation_turns %v, must be 0 or more", turns)
+		}
+	}
 
 	oldChain, err := cs.GetChainConf(ctx, id)
 	if err != nil {
@@ -164,10 +907,33 @@ func (cs *ChainsService) UpdateChainMeta(ctx context.Context, id string, fields
 		return nil, err
 	}
 
-	// If the n-gram order changed the entire chain must be rebuilt.
-	if updated.NGramSize != oldChain.NGramSize {
-		go cs.rebuildChain(id, updated.NGramSize)
+	// Re-enabling decay must not apply the time it spent disabled.
+	if updated.DecayHalfLifeDays > 0 && oldChain.DecayHalfLifeDays <= 0 && updated.DecayedAt != nil {
+		if updated, err = cs.chainsRepo.UpdateChain(id, map[string]any{"decayed_at": nil}); err != nil {
+			return nil, err
+		}
+	}
+
+	// If the n-gram order or the tokenizer changed the entire chain must be
+	// rebuilt. Switching scope only touches the channel sub-chains.
+	var steps []func()
+	if updated.NGramSize != oldChain.NGramSize || updated.Tokenizer != oldChain.Tokenizer {
+		steps = append(steps, func() { cs.rebuildChain(id, updated.NGramSize) })
+	} else {
+		if updated.ChannelScoped() != oldChain.ChannelScoped() {
+			steps = append(steps, func() { cs.rebuildChannelChains(id, updated.ChannelScoped()) })
+		}
+		if updated.NoveltyRunLength != oldChain.NoveltyRunLength {
+			steps = append(steps, func() { cs.rebuildNoveltyIndex(id, updated.NoveltyRunLength, updated.TextTokenizer()) })
+		}
+		if updated.Language() != oldChain.Language() {
+			steps = append(steps, func() { cs.rebuildRhymeIndex(id, updated.Language()) })
+		}
+		if updated.LanguageChains != oldChain.LanguageChains {
+			steps = append(steps, func() { cs.rebuildLanguageChains(id, updated.LanguageChains) })
+		}
 	}
+	cs.rebuild(id, steps...)
 
 	if _, touched := fields["markov_max_branches"]; touched && updated.MarkovMaxBranches > 0 &&
 		updated.MarkovMaxBranches != oldChain.MarkovMaxBranches {
@@ -232,6 +998,67 @@ func (cs *ChainsService) ResetChain(ctx context.Context, id string) error {
 	return nil
 }
 
+// ExportChain streams a portable dump of the guild chain and its config to w.
+func (cs *ChainsService) ExportChain(ctx context.Context, id string, w io.Writer) error {
+	chain, err := cs.GetChainConf(ctx, id)
+	if err != nil {
+		return err
+	}
+	return cs.cacheRepo.ExportChain(ctx, id, chain, w)
+}
+
+// ImportChain applies a dump produced by ExportChain to the guild chain within
+// the target chain's size and branching limits. Merging requires matching
+// n-gram sizes; replacing wipes the guild with clear_guild first and adopts
+// the dump's n-gram size. The channel, language and author sub-chains and the
+// novelty index are not part of a dump, so a replace retrains them from
+// stored messages in the background. Stored messages are left untouched, so
+// a later rebuild retrains from them instead of the dump. A replace with an
+// empty dump fails with repositories.ErrEmptyChainDump unless force is set.
+func (cs *ChainsService) ImportChain(ctx context.Context, id string, src io.Reader, replace, force bool) (*repositories.ImportResult, error) {
+	chain, err := cs.GetChainConf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	opts := repositories.ImportOptions{
+		Replace:        replace,
+		MaxSizeBytes:   chain.MaxSizeBytes(),
+		MaxBranches:    chain.MarkovMaxBranches,
+		EvictionPolicy: chain.EvictionPolicy,
+		Accept: func(dumped *repositories.ChainConfig) error {
+			return cs.chainsRepo.AcceptDumpConfig(chain, dumped, replace)
+		},
+		AllowEmpty: force,
+	}
+
+	var res *repositories.ImportResult
+	cs.RunBulkCacheTraining(func() {
+		res, err = cs.cacheRepo.ImportChain(ctx, id, src, opts)
+	})
+	if err != nil {
+		return res, err
+	}
+	// Imported transitions never went through training.
+	if err := cs.cacheRepo.ReindexRhymes(ctx, id, chain.Language()); err != nil {
+		logger.Errorf("ImportChain: ReindexRhymes failed for %s: %v", id, err)
+	}
+	if err := cs.cacheRepo.ReindexKeywords(ctx, id); err != nil {
+		logger.Errorf("ImportChain: ReindexKeywords failed for %s: %v", id, err)
+	}
+	logger.Infof("Imported chain dump into %s: %d states, %d transitions, %d media (truncated=%t)",
+		id, res.States, res.Transitions, res.Media, res.Truncated)
+	if replace {
+		cs.rebuild(id, func() { cs.RetrainSubChains(id) })
+	}
+	return res, nil
+}
+
+// RestoreChain replaces the guild chain with a snapshot produced by
+// ExportChain (see ImportChain).
+func (cs *ChainsService) RestoreChain(ctx context.Context, id string, src io.Reader, force bool) (*repositories.ImportResult, error) {
+	return cs.ImportChain(ctx, id, src, true, force)
+}
+
 func (cs *ChainsService) GetChainMessages(id string) ([]string, error) {
 	messages, err := cs.messagesRepo.GetAllGuildMessages(id)
 	if err != nil {
@@ -246,20 +1073,49 @@ func (cs *ChainsService) GetChainMessages(id string) ([]string, error) {
 
 // ---------- rebuild ----------
 
-// rebuildChain clears and re-trains a guild's chain with a new n-gram size.
-// A per-guild mutex prevents duplicate concurrent rebuilds (e.g. if the user
-// hammers the config endpoint).
-func (cs *ChainsService) rebuildChain(id string, newNGramSize int) {
-	// Per-guild mutex — load-or-store a *sync.Mutex for this id.
-	mu, _ := cs.rebuildMu.LoadOrStore(id, &sync.Mutex{})
-	guildMu := mu.(*sync.Mutex)
+// rebuildQueue holds the pending rebuild steps of one guild.
+type rebuildQueue struct {
+	mu      sync.Mutex
+	steps   []func()
+	running bool
+}
 
-	if !guildMu.TryLock() {
-		logger.Warnf("rebuildChain: rebuild already in progress for %s, skipping", id)
+// rebuild queues steps for the guild and runs them in order on a single
+// background goroutine per guild. Rebuilds requested while one is running
+// wait their turn instead of being dropped, so every config change is applied
+// and two rebuilds of the same guild never interleave their writes.
+func (cs *ChainsService) rebuild(id string, steps ...func()) {
+	if len(steps) == 0 {
 		return
 	}
-	defer guildMu.Unlock()
+	v, _ := cs.rebuildMu.LoadOrStore(id, &rebuildQueue{})
+	q := v.(*rebuildQueue)
 
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.steps = append(q.steps, steps...)
+	if q.running {
+		return
+	}
+	q.running = true
+	go func() {
+		for {
+			q.mu.Lock()
+			if len(q.steps) == 0 {
+				q.running = false
+				q.mu.Unlock()
+				return
+			}
+			step := q.steps[0]
+			q.steps = q.steps[1:]
+			q.mu.Unlock()
+			step()
+		}
+	}()
+}
+
+// rebuildChain clears and re-trains a guild's chain with a new n-gram size.
+func (cs *ChainsService) rebuildChain(id string, newNGramSize int) {
 	ctx := context.Background()
 
 	doc, err := cs.chainsRepo.GetChainByID(id)
@@ -267,7 +1123,7 @@ func (cs *ChainsService) rebuildChain(id string, newNGramSize int) {
 		logger.Errorf("rebuildChain: failed to load chain %s: %v", id, err)
 		return
 	}
-	logger.Infof("Rebuilding chain %s with n_gram_size=%d", doc.Name, newNGramSize)
+	logger.Infof("Rebuilding chain %s with n_gram_size=%d tokenizer=%s", doc.Name, newNGramSize, doc.Tokenizer)
 
 	cs.RunBulkCacheTraining(func() {
 		if err := cs.cacheRepo.ClearGuild(ctx, id); err != nil {
@@ -275,17 +1131,40 @@ func (cs *ChainsService) rebuildChain(id string, newNGramSize int) {
 			return
 		}
 
-		messages, err := cs.GetChainMessages(id)
+		messages, err := cs.messagesRepo.GetAllGuildMessages(id)
 		if err != nil {
-			logger.Errorf("rebuildChain: GetChainMessages failed for %s: %v", id, err)
+			logger.Errorf("rebuildChain: GetAllGuildMessages failed for %s: %v", id, err)
 			return
 		}
 
-		if err := cs.cacheRepo.TrainBatch(ctx, id, messages, newNGramSize, doc.MaxSizeBytes(), doc.MarkovMaxBranches); err != nil {
+		texts := make([]string, 0, len(messages))
+		for _, m := range messages {
+			texts = append(texts, m.Content)
+		}
+		if err := cs.cacheRepo.TrainBatch(ctx, id, texts, newNGramSize, doc.SizeLimit(), doc.MarkovMaxBranches, doc.TextTokenizer()); err != nil {
 			logger.Errorf("rebuildChain: TrainBatch failed for %s: %v", id, err)
 			return
 		}
 
+		if doc.ChannelScoped() {
+			cs.trainChannelChains(ctx, doc, messages, newNGramSize)
+		}
+		if doc.LanguageChains {
+			cs.trainLanguageChains(ctx, doc, texts, newNGramSize)
+		}
+		cs.trainAuthorChains(ctx, doc, messages, newNGramSize)
+		if doc.NoveltyGuarded() {
+			if err := cs.cacheRepo.IndexNovelty(ctx, id, texts, doc.NoveltyRunLength, doc.TextTokenizer()); err != nil {
+				logger.Errorf("rebuildChain: IndexNovelty failed for %s: %v", id, err)
+			}
+		}
+		if err := cs.cacheRepo.IndexRhymes(ctx, id, texts, doc.Language(), doc.TextTokenizer()); err != nil {
+			logger.Errorf("rebuildChain: IndexRhymes failed for %s: %v", id, err)
+		}
+		if err := cs.cacheRepo.IndexKeywords(ctx, id, texts, doc.TextTokenizer()); err != nil {
+			logger.Errorf("rebuildChain: IndexKeywords failed for %s: %v", id, err)
+		}
+
 		if _, err := cs.cacheRepo.ReconcileBytes(ctx, id); err != nil {
 			logger.Warnf("rebuildChain: ReconcileBytes failed for %s: %v", id, err)
 		}
@@ -294,6 +1173,217 @@ func (cs *ChainsService) rebuildChain(id string, newNGramSize int) {
 	})
 }
 
+// rebuildChannelChains drops a guild's channel sub-chains and, when enabled,
+// re-trains them from stored messages. Messages stored before channel
+// tracking have no channel and only live in the guild chain.
+func (cs *ChainsService) rebuildChannelChains(id string, enabled bool) {
+	ctx := context.Background()
+
+	if err := cs.cacheRepo.ClearChannelChains(ctx, id); err != nil {
+		logger.Errorf("rebuildChannelChains: ClearChannelChains failed for %s: %v", id, err)
+		return
+	}
+	if !enabled {
+		logger.Infof("Channel chains cleared for %s", id)
+		return
+	}
+
+	doc, err := cs.chainsRepo.GetChainByID(id)
+	if err != nil {
+		logger.Errorf("rebuildChannelChains: failed to load chain %s: %v", id, err)
+		return
+	}
+
+	cs.RunBulkCacheTraining(func() {
+		messages, err := cs.messagesRepo.GetAllGuildMessages(id)
+		if err != nil {
+			logger.Errorf("rebuildChannelChains: GetAllGuildMessages failed for %s: %v", id, err)
+			return
+		}
+		cs.trainChannelChains(ctx, doc, messages, doc.NGramSize)
+		logger.Infof("Channel chains rebuilt for %s", doc.Name)
+	})
+}
+
+// rebuildLanguageChains drops a guild's language sub-chains and, when enabled,
+// re-trains them from stored messages.
+func (cs *ChainsService) rebuildLanguageChains(id string, enabled bool) {
+	ctx := context.Background()
+
+	if err := cs.cacheRepo.ClearLanguageChains(ctx, id); err != nil {
+		logger.Errorf("rebuildLanguageChains: ClearLanguageChains failed for %s: %v", id, err)
+		return
+	}
+	if !enabled {
+		logger.Infof("Language chains cleared for %s", id)
+		return
+	}
+
+	doc, err := cs.chainsRepo.GetChainByID(id)
+	if err != nil {
+		logger.Errorf("rebuildLanguageChains: failed to load chain %s: %v", id, err)
+		return
+	}
+
+	cs.RunBulkCacheTraining(func() {
+		err := cs.messagesRepo.ScanGuildMessageContents(id, 1000, func(contents []string) error {
+			cs.trainLanguageChains(ctx, doc, contents, doc.NGramSize)
+			return nil
+		})
+		if err != nil {
+			logger.Errorf("rebuildLanguageChains: scan failed for %s: %v", id, err)
+			return
+		}
+		logger.Infof("Language chains rebuilt for %s", doc.Name)
+	})
+}
+
+// rebuildNoveltyIndex drops a guild's novelty index and, when runLength is
+// positive, re-indexes every stored message with it.
+func (cs *ChainsService) rebuildNoveltyIndex(id string, runLength int, tok repositories.Tokenizer) {
+	ctx := context.Background()
+
+	if err := cs.cacheRepo.ClearNovelty(ctx, id); err != nil {
+		logger.Errorf("rebuildNoveltyIndex: ClearNovelty failed for %s: %v", id, err)
+		return
+	}
+	if runLength <= 0 {
+		logger.Infof("Novelty index cleared for %s", id)
+		return
+	}
+
+	cs.RunBulkCacheTraining(func() {
+		err := cs.messagesRepo.ScanGuildMessageContents(id, 1000, func(contents []string) error {
+			return cs.cacheRepo.IndexNovelty(ctx, id, contents, runLength, tok)
+		})
+		if err != nil {
+			logger.Errorf("rebuildNoveltyIndex: indexing failed for %s: %v", id, err)
+			return
+		}
+		logger.Infof("Novelty index rebuilt for %s (run length %d)", id, runLength)
+	})
+}
+
+// rebuildRhymeIndex recomputes a guild's rhyme index for lang from its chain.
+func (cs *ChainsService) rebuildRhymeIndex(id, lang string) {
+	cs.RunBulkCacheTraining(func() {
+		if err := cs.cacheRepo.ReindexRhymes(context.Background(), id, lang); err != nil {
+			logger.Errorf("rebuildRhymeIndex: ReindexRhymes failed for %s: %v", id, err)
+			return
+		}
+		logger.Infof("Rhyme index rebuilt for %s (language %s)", id, lang)
+	})
+}
+
+// RetrainSubChains trains a guild's sub-chains and novelty index from stored
+// messages on top of an otherwise cleared guild, e.g. after a replace import.
+// The bot runs it through rebuild; the migrate tool calls it directly.
+func (cs *ChainsService) RetrainSubChains(id string) {
+	ctx := context.Background()
+
+	doc, err := cs.chainsRepo.GetChainByID(id)
+	if err != nil {
+		logger.Errorf("RetrainSubChains: failed to load chain %s: %v", id, err)
+		return
+	}
+
+	cs.RunBulkCacheTraining(func() {
+		messages, err := cs.messagesRepo.GetAllGuildMessages(id)
+		if err != nil {
+			logger.Errorf("RetrainSubChains: GetAllGuildMessages failed for %s: %v", id, err)
+			return
+		}
+		texts := make([]string, 0, len(messages))
+		for _, m := range messages {
+			texts = append(texts, m.Content)
+		}
+
+		if doc.ChannelScoped() {
+			cs.trainChannelChains(ctx, doc, messages, doc.NGramSize)
+		}
+		if doc.LanguageChains {
+			cs.trainLanguageChains(ctx, doc, texts, doc.NGramSize)
+		}
+		cs.trainAuthorChains(ctx, doc, messages, doc.NGramSize)
+		if doc.NoveltyGuarded() {
+			if err := cs.cacheRepo.IndexNovelty(ctx, id, texts, doc.NoveltyRunLength, doc.TextTokenizer()); err != nil {
+				logger.Errorf("RetrainSubChains: IndexNovelty failed for %s: %v", id, err)
+			}
+		}
+		logger.Infof("Sub-chains retrained for %s", doc.Name)
+	})
+}
+
+// trainChannelChains groups stored messages by channel and trains each
+// channel's sub-chain. Callers hold the bulk training lock.
+func (cs *ChainsService) trainChannelChains(ctx context.Context, doc *repositories.ChainConfig, messages []repositories.Message, nGramSize int) {
+	byChannel := make(map[string][]string)
+	for _, m := range messages {
+		if m.ChannelID != "" {
+			byChannel[m.ChannelID] = append(byChannel[m.ChannelID], m.Content)
+		}
+	}
+	limit := subChainLimit(doc, channelChainMaxSizeBytes)
+	for channelID, texts := range byChannel {
+		if err := cs.cacheRepo.TrainChannelBatch(ctx, doc.ID, channelID, texts, nGramSize, limit, doc.MarkovMaxBranches, doc.TextTokenizer()); err != nil {
+			logger.Errorf("trainChannelChains: TrainChannelBatch failed for %s/%s: %v", doc.ID, channelID, err)
+		}
+	}
+}
+
+// trainLanguageChains groups texts by detected language and trains each
+// language's sub-chain. Texts whose language cannot be told only live in the
+// guild chain.
+func (cs *ChainsService) trainLanguageChains(ctx context.Context, doc *repositories.ChainConfig, texts []string, nGramSize int) {
+	byLang := make(map[string][]string)
+	for _, text := range texts {
+		if lang := langdetect.Detect(text); lang != "" {
+			byLang[lang] = append(byLang[lang], text)
+		}
+	}
+	limit := subChainLimit(doc, languageChainMaxSizeBytes)
+	for lang, texts := range byLang {
+		if err := cs.cacheRepo.TrainLanguageBatch(ctx, doc.ID, lang, texts, nGramSize, limit, doc.MarkovMaxBranches, doc.TextTokenizer()); err != nil {
+			logger.Errorf("trainLanguageChains: TrainLanguageBatch failed for %s#%s: %v", doc.ID, lang, err)
+		}
+	}
+}
+
+// trainAuthorChains groups messages by author and trains each author's
+// sub-chain, skipping members who opted out of /imitate.
+func (cs *ChainsService) trainAuthorChains(ctx context.Context, doc *repositories.ChainConfig, messages []repositories.Message, nGramSize int) {
+	byAuthor := make(map[string][]string)
+	for _, m := range messages {
+		if m.AuthorID != "" {
+			byAuthor[m.AuthorID] = append(byAuthor[m.AuthorID], m.Content)
+		}
+	}
+	if len(byAuthor) == 0 {
+		return
+	}
+
+	authorIDs := make([]string, 0, len(byAuthor))
+	for authorID := range byAuthor {
+		authorIDs = append(authorIDs, authorID)
+	}
+	optedOut, err := cs.optOutsRepo.OptedOutAmong(doc.ID, authorIDs)
+	if err != nil {
+		logger.Errorf("trainAuthorChains: opt-out lookup failed for %s: %v", doc.ID, err)
+		return
+	}
+
+	tok := doc.TextTokenizer()
+	limit := subChainLimit(doc, authorChainMaxSizeBytes)
+	for authorID, texts := range byAuthor {
+		if optedOut[authorID] {
+			continue
+		}
+		if err := cs.cacheRepo.TrainAuthorBatch(ctx, doc.ID, authorID, texts, nGramSize, limit, doc.MarkovMaxBranches, tok); err != nil {
+			logger.Errorf("trainAuthorChains: TrainAuthorBatch failed for %s@%s: %v", doc.ID, authorID, err)
+		}
+	}
+}
+
 // ---------- helpers ----------
 
 func parseToInt(v any) (int, error) {
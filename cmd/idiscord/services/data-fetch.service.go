@@ -162,8 +162,8 @@ func (d *DataFetchService) fetchChannelMessages(channel discord.Channel, guildID
 
 		// Only write if the filter produced anything — but always paginate
 		if len(cleaned) > 0 {
-			d.ChainService.UpdateChainState(context.Background(), guildID, cleaned)
-			d.messagesRepo.AddMessagesToGuild(guildID, cleaned)
+			d.ChainService.UpdateChainState(context.Background(), guildID, channel.ID().String(), cleaned)
+			d.messagesRepo.AddMessagesToGuild(guildID, channel.ID().String(), cleaned)
 		}
 
 		totalFetched += raw
@@ -177,9 +177,9 @@ func (d *DataFetchService) fetchChannelMessages(channel discord.Channel, guildID
 	return totalFetched, nil
 }
 
-// fetchBatch returns: raw message count, cleaned strings, new pagination ID, error.
+// fetchBatch returns: raw message count, cleaned messages, new pagination ID, error.
 // Separating raw count from cleaned count is what fixes the false-termination bug.
-func (d *DataFetchService) fetchBatch(channelID, lastID snowflake.ID) (int, []string, snowflake.ID, error) {
+func (d *DataFetchService) fetchBatch(channelID, lastID snowflake.ID) (int, []repositories.Message, snowflake.ID, error) {
 	messages, err := d.Session.Rest.GetMessages(channelID, 0, lastID, 0, 100)
 	if err != nil {
 		if rest.IsJSONErrorCode(err, rest.JSONErrorCodeMissingAccess) {
@@ -197,17 +197,24 @@ func (d *DataFetchService) fetchBatch(channelID, lastID snowflake.ID) (int, []st
 	return len(messages), cleaned, newLastID, nil
 }
 
-func (d *DataFetchService) cleanMessages(messages []discord.Message) []string {
-	var result []string
+// cleanMessages keeps trainable content along with its author. Webhook
+// messages have no real member behind them, so they carry no AuthorID.
+func (d *DataFetchService) cleanMessages(messages []discord.Message) []repositories.Message {
+	var result []repositories.Message
 	for _, msg := range messages {
 		isWebhook := msg.WebhookID != nil && *msg.WebhookID != 0
 		if d.SkipBots && msg.Author.Bot && !isWebhook {
 			continue
 		}
+		authorID := msg.Author.ID.String()
+		if isWebhook {
+			authorID = ""
+		}
+		messageID := msg.ID.String()
 		if len(strings.Fields(msg.Content)) > 1 || utils.ReURL.MatchString(msg.Content) {
-			result = append(result, msg.Content)
+			result = append(result, repositories.Message{Content: msg.Content, AuthorID: authorID, MessageID: messageID})
 			for _, attachment := range msg.Attachments {
-				result = append(result, attachment.URL)
+				result = append(result, repositories.Message{Content: attachment.URL, AuthorID: authorID, MessageID: messageID})
 			}
 		}
 	}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"rolando/internal/logger"
+	"time"
+)
+
+const (
+	// decayCheckInterval is how often the job looks for chains due a decay pass.
+	decayCheckInterval = time.Hour
+	// decayMinElapsed is the minimum time between two decay passes of a chain.
+	decayMinElapsed = 24 * time.Hour
+)
+
+// DecayService periodically scales down transition weights of chains with a
+// decay half-life, so a guild's chain follows its current culture instead of
+// being dominated by years-old messages.
+type DecayService struct {
+	ChainService *ChainsService
+}
+
+func NewDecayService(chainService *ChainsService) *DecayService {
+	return &DecayService{ChainService: chainService}
+}
+
+// Start runs the decay job in the background until ctx is done.
+func (d *DecayService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(decayCheckInterval)
+		defer ticker.Stop()
+		for {
+			d.runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDue decays every chain whose last pass is at least decayMinElapsed old,
+// along with its channel, language and author sub-chains. The factor is
+// derived from the real elapsed time (persisted as decayed_at), so restarts
+// neither skip nor double-apply decay. A chain seen for the first time only
+// starts its clock.
+func (d *DecayService) runDue(ctx context.Context) {
+	chains, err := d.ChainService.GetAllChains(ctx)
+	if err != nil {
+		logger.Errorf("decay: failed to list chains: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, chain := range chains {
+		if chain.DecayHalfLifeDays <= 0 {
+			continue
+		}
+		if chain.DecayedAt != nil {
+			elapsed := now.Sub(*chain.DecayedAt)
+			if elapsed < decayMinElapsed {
+				continue
+			}
+			if !d.decay(ctx, chain.ID, chain.DecayFactor(elapsed), chain.DecayHalfLifeDays) {
+				continue
+			}
+		}
+		if _, err := d.ChainService.chainsRepo.UpdateChain(chain.ID, map[string]any{"decayed_at": now}); err != nil {
+			logger.Errorf("decay: failed to record decayed_at for %s: %v", chain.ID, err)
+		}
+	}
+}
+
+// decay runs one decay pass over a guild chain and its sub-chains, reporting
+// whether it went through. Sub-chain failures are only logged: the guild
+// chain is what decayed_at tracks.
+func (d *DecayService) decay(ctx context.Context, guildID string, factor float64, halfLifeDays int) bool {
+	store := d.ChainService.cacheRepo
+	removed, err := store.Decay(ctx, guildID, factor)
+	if err != nil {
+		logger.Errorf("decay: Decay failed for %s: %v", guildID, err)
+		return false
+	}
+	subIDs, err := store.SubChains(ctx, guildID)
+	if err != nil {
+		logger.Errorf("decay: failed to list sub-chains of %s: %v", guildID, err)
+	}
+	for _, subID := range subIDs {
+		n, err := store.Decay(ctx, subID, factor)
+		if err != nil {
+			logger.Errorf("decay: Decay failed for %s: %v", subID, err)
+			continue
+		}
+		removed += n
+	}
+	logger.Infof("decay %s: removed %d faded transitions from %d chains (half-life=%dd)", guildID, removed, 1+len(subIDs), halfLifeDays)
+	return true
+}
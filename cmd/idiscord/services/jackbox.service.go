@@ -43,7 +43,7 @@ func (g *guildJackbox) shutdownConn() {
 
 type JackboxService struct {
 	client   *bot.Client
-	cache    *repositories.CacheRepository
+	cache    repositories.ChainStore
 	chains   *ChainsService
 	http     *http.Client
 	sessions sync.Map
@@ -55,7 +55,7 @@ var jackboxRateWindow = time.Minute
 
 const jackboxMaxFails = 6
 
-func NewJackboxService(client *bot.Client, cache *repositories.CacheRepository, chains *ChainsService) *JackboxService {
+func NewJackboxService(client *bot.Client, cache repositories.ChainStore, chains *ChainsService) *JackboxService {
 	return &JackboxService{
 		client:   client,
 		cache:    cache,
@@ -65,11 +65,12 @@ func NewJackboxService(client *bot.Client, cache *repositories.CacheRepository,
 	}
 }
 
-func (s *JackboxService) GenerateLine(ctx context.Context, guildID string, maxWords int) (string, error) {
+func (s *JackboxService) GenerateConstrained(ctx context.Context, guildID string, c repositories.Constraints) (string, error) {
 	if s.chains == nil {
 		return "", fmt.Errorf("chains service unavailable")
 	}
-	return s.chains.GenerateLine(ctx, guildID, maxWords)
+	c.Filtered = true
+	return s.chains.GenerateConstrained(ctx, guildID, c)
 }
 
 func (s *JackboxService) rateLimited(guildID string) bool {
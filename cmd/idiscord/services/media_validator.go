@@ -14,13 +14,13 @@ const (
 )
 
 type MediaValidator struct {
-	markovRepo   *repositories.CacheRepository
+	markovRepo   repositories.ChainStore
 	messagesRepo *repositories.MessagesRepository
 	sem          chan struct{}
 	httpClient   *http.Client
 }
 
-func NewMediaValidator(markovRepo *repositories.CacheRepository, messagesRepo *repositories.MessagesRepository) *MediaValidator {
+func NewMediaValidator(markovRepo repositories.ChainStore, messagesRepo *repositories.MessagesRepository) *MediaValidator {
 	return &MediaValidator{
 		markovRepo:   markovRepo,
 		messagesRepo: messagesRepo,
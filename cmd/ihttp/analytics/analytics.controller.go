@@ -57,6 +57,32 @@ func (s *AnalyticsController) GetChainAnalytics(c *gin.Context) {
 	c.JSON(200, getSerializableAnalytics(&rawAnalytics, chainDoc))
 }
 
+// GET /analytics/:chain/deep?refresh=true, requires member authorization
+func (s *AnalyticsController) GetChainDeepAnalytics(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureGuildMember(c, s.ds, chainId)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	chain, err := s.chainsService.GetChainConf(context.Background(), chainId)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	refresh, _ := strconv.ParseBool(c.Query("refresh"))
+	deep, err := s.chainsService.NewMarkovAnalyzer(chain).GetDeepAnalytics(c.Request.Context(), refresh)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if deep == nil {
+		c.JSON(202, gin.H{"message": "analysis in progress, try again later"})
+		return
+	}
+	c.JSON(200, deep)
+}
+
 // GET /analytics/all, requires owner authorization
 func (s *AnalyticsController) GetAllChainsAnalytics(c *gin.Context) {
 	errCode, err := auth.EnsureOwner(c, s.ds)
@@ -180,24 +206,37 @@ func BuildAllChainsAnalyticsMap(chainsService *services.ChainsService) (map[stri
 
 func getSerializableAnalytics(rawAnalytics *ianalytics.NumericChainAnalytics, chainDoc *repositories.ChainConfig) gin.H {
 	return gin.H{
-		"complexity_score": rawAnalytics.ComplexityScore,
-		"gifs":             rawAnalytics.Gifs,
-		"images":           rawAnalytics.Images,
-		"videos":           rawAnalytics.Videos,
-		"reply_rate":       rawAnalytics.ReplyRate,
-		"n_gram_size":      rawAnalytics.NGramSize,
-		"words":            rawAnalytics.Words,
-		"messages":         rawAnalytics.Messages,
-		"bytes":            rawAnalytics.Size,
-		"id":               chainDoc.ID,
-		"name":             chainDoc.Name,
-		"max_size_mb":         chainDoc.MaxSizeMb,
-		"markov_max_branches": chainDoc.MarkovMaxBranches,
-		"pings_enabled":    chainDoc.Pings,
-		"premium":          chainDoc.Premium,
-		"trained_at":       chainDoc.TrainedAt,
-		"tts_language":     chainDoc.TTSLanguage,
-		"vc_join_rate":     chainDoc.VcJoinRate,
-		"reaction_rate":    chainDoc.ReactionRate,
+		"complexity_score":     rawAnalytics.ComplexityScore,
+		"gifs":                 rawAnalytics.Gifs,
+		"images":               rawAnalytics.Images,
+		"videos":               rawAnalytics.Videos,
+		"reply_rate":           rawAnalytics.ReplyRate,
+		"n_gram_size":          rawAnalytics.NGramSize,
+		"words":                rawAnalytics.Words,
+		"messages":             rawAnalytics.Messages,
+		"bytes":                rawAnalytics.Size,
+		"evicted":              rawAnalytics.Evicted,
+		"id":                   chainDoc.ID,
+		"name":                 chainDoc.Name,
+		"max_size_mb":          chainDoc.MaxSizeMb,
+		"eviction_policy":      chainDoc.EvictionPolicy,
+		"markov_max_branches":  chainDoc.MarkovMaxBranches,
+		"temperature":          chainDoc.Temperature,
+		"top_k":                chainDoc.TopK,
+		"top_p":                chainDoc.TopP,
+		"smoothing":            chainDoc.Smoothing,
+		"chain_scope":          chainDoc.ChainScope,
+		"decay_half_life_days": chainDoc.DecayHalfLifeDays,
+		"novelty_run_length":   chainDoc.NoveltyRunLength,
+		"conversation_turns":   chainDoc.ConversationTurns,
+		"tokenizer":            chainDoc.Tokenizer,
+		"language_chains":      chainDoc.LanguageChains,
+		"allow_crossover":      chainDoc.AllowCrossover,
+		"pings_enabled":        chainDoc.Pings,
+		"premium":              chainDoc.Premium,
+		"trained_at":           chainDoc.TrainedAt,
+		"tts_language":         chainDoc.TTSLanguage,
+		"vc_join_rate":         chainDoc.VcJoinRate,
+		"reaction_rate":        chainDoc.ReactionRate,
 	}
 }
@@ -1,8 +1,13 @@
 package data
 
 import (
+	"errors"
+	"fmt"
+	"rolando/cmd/idiscord/services"
 	"rolando/cmd/ihttp/auth"
+	"rolando/internal/logger"
 	"rolando/internal/repositories"
+	"rolando/internal/utils"
 	"strconv"
 
 	"github.com/disgoorg/disgo/bot"
@@ -10,14 +15,18 @@ import (
 )
 
 type DataController struct {
-	messagesRepo *repositories.MessagesRepository
-	ds           *bot.Client
+	chainsService *services.ChainsService
+	backupService *services.BackupService
+	messagesRepo  *repositories.MessagesRepository
+	ds            *bot.Client
 }
 
-func NewController(ds *bot.Client, messagesRepo *repositories.MessagesRepository) *DataController {
+func NewController(ds *bot.Client, chainsService *services.ChainsService, backupService *services.BackupService, messagesRepo *repositories.MessagesRepository) *DataController {
 	return &DataController{
-		messagesRepo: messagesRepo,
-		ds:           ds,
+		chainsService: chainsService,
+		backupService: backupService,
+		messagesRepo:  messagesRepo,
+		ds:            ds,
 	}
 }
 
@@ -79,3 +88,183 @@ func (s *DataController) GetDataPaginated(c *gin.Context) {
 		},
 	})
 }
+
+// GET /data/:chain/export, requires guild member authorization
+func (s *DataController) ExportChain(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureGuildMember(c, s.ds, chainId)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.chainsService.GetChainConf(c.Request.Context(), chainId); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.chain.ndjson"`, chainId))
+	c.Status(200)
+	// Headers are already sent once streaming starts, so errors can only be logged.
+	if err := s.chainsService.ExportChain(c.Request.Context(), chainId, c.Writer); err != nil {
+		logger.Errorf("Failed to export chain %s: %v", chainId, err)
+	}
+}
+
+// POST /data/:chain/import?mode=merge|replace&force=true, requires owner authorization
+// An empty dump only replaces the chain with force=true.
+func (s *DataController) ImportChain(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	var replace bool
+	switch c.DefaultQuery("mode", "merge") {
+	case "merge":
+	case "replace":
+		replace = true
+	default:
+		c.JSON(400, gin.H{"error": "mode must be 'merge' or 'replace'"})
+		return
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+	res, err := s.chainsService.ImportChain(c.Request.Context(), chainId, c.Request.Body, replace, force)
+	if err != nil {
+		code := 400
+		if errors.Is(err, repositories.ErrEmptyChainDump) {
+			code = 409
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, res)
+}
+
+// GET /data/:chain/snapshots, requires owner authorization
+func (s *DataController) ListSnapshots(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	snapshots, err := s.backupService.ListSnapshots(chainId)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, snapshots)
+}
+
+// POST /data/:chain/snapshots, requires owner authorization
+func (s *DataController) CreateSnapshot(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.chainsService.GetChainConf(c.Request.Context(), chainId); err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	snapshot, err := s.backupService.Snapshot(c.Request.Context(), chainId)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, snapshot)
+}
+
+// POST /data/:chain/snapshots/:name/restore?force=true, requires owner authorization
+// Wipes the chain and reloads the snapshot; :name may be "latest". An empty
+// snapshot is only restored with force=true.
+func (s *DataController) RestoreSnapshot(c *gin.Context) {
+	chainId, name := c.Param("chain"), c.Param("name")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+	snapshot, res, err := s.backupService.Restore(c.Request.Context(), chainId, name, force)
+	if err != nil {
+		code := 400
+		switch {
+		case errors.Is(err, repositories.ErrSnapshotNotFound):
+			code = 404
+		case errors.Is(err, repositories.ErrEmptyChainDump):
+			code = 409
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"snapshot": snapshot, "result": res})
+}
+
+// GET /data/:chain/crossover?with=<guild_id>&weight=0-100, requires owner authorization
+func (s *DataController) Crossover(c *gin.Context) {
+	chainId := c.Param("chain")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	otherId := c.Query("with")
+	if otherId == "" {
+		c.JSON(400, gin.H{"error": "missing 'with' guild id"})
+		return
+	}
+	weight, err := strconv.Atoi(c.DefaultQuery("weight", "50"))
+	if err != nil || weight < 0 || weight > 100 {
+		c.JSON(400, gin.H{"error": "weight must be an integer between 0 and 100"})
+		return
+	}
+	text, err := s.chainsService.Crossover(c.Request.Context(), chainId, otherId, weight, utils.GetRandom(8, 40))
+	if err != nil {
+		code := 500
+		if errors.Is(err, services.ErrCrossoverNotAllowed) || errors.Is(err, services.ErrCrossoverSameGuild) {
+			code = 400
+		} else if errors.Is(err, repositories.ErrCrossoverClustered) {
+			code = 501
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"text": text})
+}
+
+// POST /data/:chain/users/:user/forget, requires owner authorization
+// Starts erasing everything learned from the user; poll the GET route for progress.
+// Messages stored without an author are not erased, as the progress note says.
+func (s *DataController) ForgetUser(c *gin.Context) {
+	chainId, userId := c.Param("chain"), c.Param("user")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	progress, err := s.chainsService.ForgetUser(chainId, userId, nil)
+	if errors.Is(err, services.ErrErasureInProgress) {
+		c.JSON(409, gin.H{"error": err.Error(), "progress": progress})
+		return
+	}
+	c.JSON(202, progress)
+}
+
+// GET /data/:chain/users/:user/forget, requires owner authorization
+func (s *DataController) GetForgetUserStatus(c *gin.Context) {
+	chainId, userId := c.Param("chain"), c.Param("user")
+	errCode, err := auth.EnsureOwner(c, s.ds)
+	if err != nil {
+		c.JSON(errCode, gin.H{"error": err.Error()})
+		return
+	}
+	progress, ok := s.chainsService.ErasureStatus(chainId, userId)
+	if !ok {
+		c.JSON(404, gin.H{"error": "no erasure found for this user"})
+		return
+	}
+	c.JSON(200, progress)
+}
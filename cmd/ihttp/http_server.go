@@ -16,13 +16,15 @@ import (
 
 type HttpServer struct {
 	ChainsService  *services.ChainsService
+	BackupService  *services.BackupService
 	DiscordSession *bot.Client
 	MessagesRepo   *repositories.MessagesRepository
 }
 
-func NewHttpServer(discordSession *bot.Client, chainsService *services.ChainsService, messagesRepo *repositories.MessagesRepository) *HttpServer {
+func NewHttpServer(discordSession *bot.Client, chainsService *services.ChainsService, backupService *services.BackupService, messagesRepo *repositories.MessagesRepository) *HttpServer {
 	return &HttpServer{
 		ChainsService:  chainsService,
+		BackupService:  backupService,
 		DiscordSession: discordSession,
 		MessagesRepo:   messagesRepo,
 	}
@@ -40,16 +42,25 @@ func (s *HttpServer) Start() {
 	analyticsController := analytics.NewController(s.ChainsService, s.DiscordSession)
 	botController := httpBot.NewController(s.ChainsService, s.DiscordSession)
 	authController := auth.NewController(s.DiscordSession)
-	dataController := data.NewController(s.DiscordSession, s.MessagesRepo)
+	dataController := data.NewController(s.DiscordSession, s.ChainsService, s.BackupService, s.MessagesRepo)
 	// Routes
 	r.GET("/auth/@me", authController.GetUser)
 
 	r.GET("/analytics/:chain", analyticsController.GetChainAnalytics)
+	r.GET("/analytics/:chain/deep", analyticsController.GetChainDeepAnalytics)
 	r.GET("/analytics", analyticsController.GetChainsAnalyticsPaginated)
 	r.GET("/analytics/all", analyticsController.GetAllChainsAnalytics)
 
 	r.GET("/data/:chain/all", dataController.GetData)
 	r.GET("/data/:chain", dataController.GetDataPaginated)
+	r.GET("/data/:chain/export", dataController.ExportChain)
+	r.POST("/data/:chain/import", dataController.ImportChain)
+	r.GET("/data/:chain/snapshots", dataController.ListSnapshots)
+	r.POST("/data/:chain/snapshots", dataController.CreateSnapshot)
+	r.POST("/data/:chain/snapshots/:name/restore", dataController.RestoreSnapshot)
+	r.GET("/data/:chain/crossover", dataController.Crossover)
+	r.POST("/data/:chain/users/:user/forget", dataController.ForgetUser)
+	r.GET("/data/:chain/users/:user/forget", dataController.GetForgetUserStatus)
 
 	r.GET("/bot/user", botController.GetBotUser)
 	r.GET("/bot/guilds", botController.GetBotGuildsPaginated)
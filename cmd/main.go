@@ -37,22 +37,33 @@ func main() {
 	config.Version = Version
 	logger.Infof("Version: %s", config.Version)
 	logger.Debugf("Env: %s", config.Env)
+	if config.Token == "" {
+		logger.Fatalf("TOKEN not set in the environment")
+	}
 	ctx := context.Background()
 
-	logger.Debugln("Connecting to cache service at", config.CacheURL)
-	opt, err := valkey.ParseURL(config.CacheURL)
-	if err != nil {
-		logger.Fatalf("failed to parse cache url: %v", err)
-	}
-	config.ApplyValkeyClientTuning(&opt)
-	rdb, err := valkey.NewClient(opt)
-	if err != nil {
-		logger.Fatalf("failed to create cache client: %v", err)
-	}
-	if err := rdb.Do(ctx, rdb.B().Ping().Build()).Error(); err != nil {
-		logger.Fatalf("failed to ping cache service: %v", err)
+	var rdb valkey.Client
+	if config.CacheURL == config.MemoryCacheURL {
+		logger.Warnln("Using the in-memory chain store, chains will not survive a restart")
+	} else {
+		logger.Debugln("Connecting to cache service at", config.CacheURL)
+		opt, err := valkey.ParseURL(config.CacheURL)
+		if err != nil {
+			logger.Fatalf("failed to parse cache url: %v", err)
+		}
+		config.ApplyValkeyClientTuning(&opt)
+		rdb, err = valkey.NewClient(opt)
+		if err != nil {
+			logger.Fatalf("failed to create cache client: %v", err)
+		}
+		if err := rdb.Do(ctx, rdb.B().Ping().Build()).Error(); err != nil {
+			logger.Fatalf("failed to ping cache service: %v", err)
+		}
+		if err := repositories.EnsureLibrary(ctx, rdb, config.CacheLoadLibrary); err != nil {
+			logger.Fatalf("cache function library check failed: %v", err)
+		}
+		logger.Debugln("Connected to cache service")
 	}
-	logger.Debugln("Connected to cache service")
 
 	logger.Debugln("Creating discord client...")
 	client, err := disgo.New(config.Token,
@@ -102,10 +113,26 @@ func main() {
 	if err != nil {
 		logger.Fatalf("error creating chains repository: %v", err)
 	}
-	cacheRepo := repositories.NewCacheRepository(rdb)
-	chainsService := services.NewChainsService(client, chainsRepo, cacheRepo, messagesRepo)
+	optOutsRepo, err := repositories.NewOptOutsRepository(config.DatabasePath)
+	if err != nil {
+		logger.Fatalf("error creating opt-outs repository: %v", err)
+	}
+	var cacheRepo repositories.ChainStore
+	if rdb != nil {
+		cacheRepo = repositories.NewCacheRepository(rdb)
+	} else {
+		cacheRepo = repositories.NewMemoryStore()
+	}
+	chainsService := services.NewChainsService(client, chainsRepo, cacheRepo, messagesRepo, optOutsRepo)
 	dataFetchService := services.NewDataFetchService(client, chainsService, messagesRepo)
 	jackboxService := services.NewJackboxService(client, cacheRepo, chainsService)
+	services.NewDecayService(chainsService).Start(ctx)
+	snapshotsRepo, err := repositories.NewSnapshotsRepository(config.BackupDir, config.BackupRetention)
+	if err != nil {
+		logger.Fatalf("error creating snapshots repository: %v", err)
+	}
+	backupService := services.NewBackupService(chainsService, snapshotsRepo, config.BackupInterval)
+	backupService.Start(ctx)
 	// Handlers
 	messagesHandler := messages.NewMessageHandler(client, chainsService)
 	commandsHandler := commands.NewSlashCommandsHandler(client, chainsService, jackboxService)
@@ -126,7 +153,7 @@ func main() {
 	}
 	logger.Infof("Logged in as %s#%s", botUser.Username, botUser.Discriminator)
 	if config.RunHttpServer {
-		srv := ihttp.NewHttpServer(client, chainsService, messagesRepo)
+		srv := ihttp.NewHttpServer(client, chainsService, backupService, messagesRepo)
 		srv.Start()
 	}
 	logger.Infof("Startup time: %s", time.Since(config.StartupTime).String())
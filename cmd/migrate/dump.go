@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"rolando/cmd/idiscord/services"
+	"rolando/internal/config"
+	"rolando/internal/repositories"
+)
+
+// runDump handles the export and import subcommands, which move a single
+// guild chain in or out of the cache service as a portable dump. A replace
+// import wipes the guild with clear_guild, then retrains its sub-chains from
+// stored messages like the bot does.
+func runDump(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dbPath := fs.String("db", config.DatabasePath, "path to SQLite database")
+	cacheURL := fs.String("cache", config.CacheURL, "cache service URL")
+	loadLibrary := fs.Bool("load-library", config.CacheLoadLibrary, "load the embedded Lua library into the cache service when missing or outdated")
+	chainID := fs.String("chain", "", "guild/chain id")
+	file := fs.String("file", "-", "dump file to write (export) or read (import); - for stdout/stdin")
+	mode := fs.String("mode", "merge", "import mode: merge or replace")
+	force := fs.Bool("force", false, "import: let replace apply an empty dump")
+	fs.Parse(args)
+
+	if *chainID == "" {
+		log.Fatalf("%s: --chain is required", cmd)
+	}
+	if cmd == "import" && *mode != "merge" && *mode != "replace" {
+		log.Fatalf("import: --mode must be 'merge' or 'replace'")
+	}
+
+	ctx := context.Background()
+	rdb := connectCache(ctx, *cacheURL, *loadLibrary)
+	defer rdb.Close()
+
+	chainsRepo, err := repositories.NewChainsRepository(*dbPath, rdb)
+	if err != nil {
+		log.Fatalf("open sqlite (chains): %v", err)
+	}
+	chain, err := chainsRepo.GetChainByID(*chainID)
+	if err != nil {
+		log.Fatalf("load chain %s: %v", *chainID, err)
+	}
+
+	markovRepo := repositories.NewCacheRepository(rdb)
+
+	if cmd == "export" {
+		var w io.Writer = os.Stdout
+		if *file != "-" {
+			f, err := os.Create(*file)
+			if err != nil {
+				log.Fatalf("create %s: %v", *file, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := markovRepo.ExportChain(ctx, chain.ID, chain, w); err != nil {
+			log.Fatalf("export %s: %v", chain.ID, err)
+		}
+		log.Printf("Exported chain %s (%s)", chain.Name, chain.ID)
+		return
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("open %s: %v", *file, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	replace := *mode == "replace"
+	res, err := markovRepo.ImportChain(ctx, chain.ID, r, repositories.ImportOptions{
+		Replace:        replace,
+		MaxSizeBytes:   chain.MaxSizeBytes(),
+		MaxBranches:    chain.MarkovMaxBranches,
+		EvictionPolicy: chain.EvictionPolicy,
+		Accept: func(dumped *repositories.ChainConfig) error {
+			return chainsRepo.AcceptDumpConfig(chain, dumped, replace)
+		},
+		AllowEmpty: *force,
+	})
+	if err != nil {
+		log.Fatalf("import %s: %v", chain.ID, err)
+	}
+	log.Printf("Imported into %s (%s): %d states, %d transitions, %d media, %d messages, truncated=%t",
+		chain.Name, chain.ID, res.States, res.Transitions, res.Media, res.Messages, res.Truncated)
+	afterImport(ctx, *dbPath, chainsRepo, markovRepo, chain, replace)
+}
+
+// afterImport rebuilds what an import leaves out: the rhyme and keyword
+// indexes of the imported transitions and, after a replace, the channel,
+// language and author sub-chains and the novelty index that clear_guild
+// wiped, which are retrained from stored messages.
+func afterImport(ctx context.Context, dbPath string, chainsRepo *repositories.ChainsRepository, markovRepo *repositories.CacheRepository, chain *repositories.ChainConfig, replace bool) {
+	if err := markovRepo.ReindexRhymes(ctx, chain.ID, chain.Language()); err != nil {
+		log.Printf("reindex rhymes %s: %v", chain.ID, err)
+	}
+	if err := markovRepo.ReindexKeywords(ctx, chain.ID); err != nil {
+		log.Printf("reindex keywords %s: %v", chain.ID, err)
+	}
+	if !replace {
+		return
+	}
+
+	messagesRepo, err := repositories.NewMessagesRepository(dbPath)
+	if err != nil {
+		log.Fatalf("open sqlite (messages): %v", err)
+	}
+	optOutsRepo, err := repositories.NewOptOutsRepository(dbPath)
+	if err != nil {
+		log.Fatalf("open sqlite (opt-outs): %v", err)
+	}
+	services.NewChainsService(nil, chainsRepo, markovRepo, messagesRepo, optOutsRepo).RetrainSubChains(chain.ID)
+}
@@ -6,12 +6,41 @@
 // Safe to re-run after clearing the cache data with FCALL clear_guild <guild_id>.
 // Re-running without clearing will double-count existing n-grams.
 //
+// With --backfill-index it skips training entirely and only builds the
+// start-prefix index for guilds whose chains were trained before it existed,
+// including chains trained before sentence markers, which otherwise only get
+// a start from a bounded sample of the keyspace.
+//
+// With --migrate-key-layout it also skips training and moves each guild's
+// keys to the hash-tagged layout (see repositories.ChainKey) that lets the
+// cache run as a cluster. Run it once, against the standalone node, before
+// starting a bot version using that layout.
+//
+// The export and import subcommands move one guild chain in or out of the
+// cache service as a portable dump (see repositories.ExportChain). The
+// snapshot and restore subcommands do the same against the bot's backup
+// directory (BACKUP_DIR), where restore wipes the guild before reloading.
+// Replace imports and restores then retrain the guild's sub-chains and
+// novelty index from the stored messages in --db. They refuse an empty dump
+// unless --force is given, and snapshot without --chain skips empty chains.
+//
 /* Usage:
    go run ./cmd/migrate \
      --db      ./data/rolando.db \
      --cache  valkey://:change_me@localhost:6379 \
      --workers 16 \
      --clear
+
+   go run ./cmd/migrate --cache valkey://:change_me@localhost:6379 --backfill-index
+
+   go run ./cmd/migrate --cache valkey://:change_me@localhost:6379 --migrate-key-layout
+
+   go run ./cmd/migrate export --chain <guild_id> --file chain.ndjson
+   go run ./cmd/migrate import --chain <guild_id> --file chain.ndjson --mode replace
+
+   go run ./cmd/migrate snapshot [--chain <guild_id>]
+   go run ./cmd/migrate restore --chain <guild_id> --list
+   go run ./cmd/migrate restore --chain <guild_id> --name latest [--force]
 */
 package main
 
@@ -33,10 +62,22 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		runDump(os.Args[1], os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "snapshot" || os.Args[1] == "restore") {
+		runSnapshot(os.Args[1], os.Args[2:])
+		return
+	}
+
 	dbPath := flag.String("db", config.DatabasePath, "path to SQLite messages database")
 	cacheURL := flag.String("cache", config.CacheURL, "cache service URL")
 	workers := flag.Int("workers", 8, "number of concurrent workers")
 	clearCache := flag.Bool("clear", true, "clear each guild's cache data before training")
+	backfillIndex := flag.Bool("backfill-index", false, "only build the start-prefix index for existing chains, without training")
+	loadLibrary := flag.Bool("load-library", config.CacheLoadLibrary, "load the embedded Lua library into the cache service when missing or outdated")
+	migrateKeyLayout := flag.Bool("migrate-key-layout", false, "only move existing chains to the hash-tagged key layout, without training")
 	flag.Parse()
 
 	// --- SQLite ---
@@ -46,19 +87,8 @@ func main() {
 	}
 
 	// --- Cache service ---
-	opt, err := valkey.ParseURL(*cacheURL)
-	if err != nil {
-		log.Fatalf("parse cache url: %v", err)
-	}
-	config.ApplyValkeyClientTuning(&opt)
-	rdb, err := valkey.NewClient(opt)
-	if err != nil {
-		log.Fatalf("create cache client: %v", err)
-	}
 	ctx := context.Background()
-	if err := rdb.Do(ctx, rdb.B().Ping().Build()).Error(); err != nil {
-		log.Fatalf("cache ping: %v", err)
-	}
+	rdb := connectCache(ctx, *cacheURL, *loadLibrary)
 
 	chainsRepo, err := repositories.NewChainsRepository(*dbPath, rdb)
 	if err != nil {
@@ -91,6 +121,10 @@ func main() {
 		if c.TrainedAt != nil {
 			trainedAt = c.TrainedAt.UTC().Format(time.RFC3339)
 		}
+		decayedAt := ""
+		if c.DecayedAt != nil {
+			decayedAt = c.DecayedAt.UTC().Format(time.RFC3339)
+		}
 		pings := "0"
 		if c.Pings {
 			pings = "1"
@@ -99,6 +133,14 @@ func main() {
 		if c.Premium {
 			premium = "1"
 		}
+		languageChains := "0"
+		if c.LanguageChains {
+			languageChains = "1"
+		}
+		allowCrossover := "0"
+		if c.AllowCrossover {
+			allowCrossover = "1"
+		}
 		hargs := []string{
 			"id", c.ID,
 			"name", c.Name,
@@ -106,15 +148,28 @@ func main() {
 			"reaction_rate", strconv.Itoa(c.ReactionRate),
 			"vc_join_rate", strconv.Itoa(c.VcJoinRate),
 			"max_size_mb", strconv.Itoa(c.MaxSizeMb),
+			"eviction_policy", c.EvictionPolicy,
 			"n_gram_size", strconv.Itoa(c.NGramSize),
 			"markov_max_branches", strconv.Itoa(c.MarkovMaxBranches),
+			"temperature", strconv.FormatFloat(c.Temperature, 'f', -1, 64),
+			"top_k", strconv.Itoa(c.TopK),
+			"top_p", strconv.FormatFloat(c.TopP, 'f', -1, 64),
+			"smoothing", strconv.FormatFloat(c.Smoothing, 'f', -1, 64),
+			"chain_scope", c.ChainScope,
+			"decay_half_life_days", strconv.Itoa(c.DecayHalfLifeDays),
+			"decayed_at", decayedAt,
+			"novelty_run_length", strconv.Itoa(c.NoveltyRunLength),
+			"conversation_turns", strconv.Itoa(c.ConversationTurns),
+			"tokenizer", c.Tokenizer,
+			"language_chains", languageChains,
+			"allow_crossover", allowCrossover,
 			"tts_language", c.TTSLanguage,
 			"pings", pings,
 			"trained_at", trainedAt,
 			"updated_at", c.UpdatedAt.UTC().Format(time.RFC3339),
 			"premium", premium,
 		}
-		cmds = append(cmds, rdb.B().Arbitrary("HSET").Keys("config:"+c.ID).Args(hargs...).Build())
+		cmds = append(cmds, rdb.B().Arbitrary("HSET").Keys(repositories.ConfigKey(c.ID)).Args(hargs...).Build())
 	}
 	resps := rdb.DoMulti(ctx, cmds...)
 	for _, resp := range resps {
@@ -127,7 +182,13 @@ func main() {
 	markovRepo := repositories.NewCacheRepository(rdb)
 
 	logger := log.New(os.Stdout, "", log.LstdFlags)
-	logger.Printf("Migrating %d guilds with %d workers...", len(chains), *workers)
+	if *backfillIndex {
+		logger.Printf("Backfilling start-prefix index for %d guilds with %d workers...", len(chains), *workers)
+	} else if *migrateKeyLayout {
+		logger.Printf("Moving %d guilds to the hash-tagged key layout with %d workers...", len(chains), *workers)
+	} else {
+		logger.Printf("Migrating %d guilds with %d workers...", len(chains), *workers)
+	}
 
 	// Counters for the final summary line.
 	var (
@@ -152,6 +213,35 @@ func main() {
 		wg.Go(func() {
 			for j := range jobs {
 				chain := j.chain
+
+				if *backfillIndex {
+					start := time.Now()
+					n, err := markovRepo.BackfillStartIndex(ctx, chain.ID)
+					if err != nil {
+						logger.Printf("  [ERR]  [%d] %s (%s): backfill failed: %v", j.index, chain.Name, chain.ID, err)
+						nErr.Add(1)
+						continue
+					}
+					logger.Printf("  [OK]   [%d] %-30s  %6d start prefixes  %s",
+						j.index, chain.Name, n, time.Since(start).Round(time.Millisecond))
+					nOK.Add(1)
+					continue
+				}
+
+				if *migrateKeyLayout {
+					start := time.Now()
+					n, err := markovRepo.MigrateKeyLayout(ctx, chain.ID)
+					if err != nil {
+						logger.Printf("  [ERR]  [%d] %s (%s): key layout migration failed: %v", j.index, chain.Name, chain.ID, err)
+						nErr.Add(1)
+						continue
+					}
+					logger.Printf("  [OK]   [%d] %-30s  %6d keys moved  %s",
+						j.index, chain.Name, n, time.Since(start).Round(time.Millisecond))
+					nOK.Add(1)
+					continue
+				}
+
 				count := countMap[chain.ID]
 
 				// Fast path: if the guild has no messages at all in SQLite,
@@ -171,11 +261,25 @@ func main() {
 					}
 				}
 
+				// The novelty index is rebuilt from scratch either way so
+				// re-running a migration does not inflate its counts.
+				if chain.NoveltyGuarded() && !*clearCache {
+					if err := markovRepo.ClearNovelty(ctx, chain.ID); err != nil {
+						logger.Printf("  [WARN] [%d] %s (%s): novelty clear failed: %v", j.index, chain.Name, chain.ID, err)
+					}
+				}
+
 				// Train.
 				var totalRows int
 				trainErr := messagesRepo.ScanGuildMessageContents(chain.ID, 5000, func(texts []string) error {
 					totalRows += len(texts)
-					return markovRepo.TrainBatch(ctx, chain.ID, texts, chain.NGramSize, chain.MaxSizeBytes(), chain.MarkovMaxBranches)
+					if err := markovRepo.TrainBatch(ctx, chain.ID, texts, chain.NGramSize, chain.SizeLimit(), chain.MarkovMaxBranches, chain.TextTokenizer()); err != nil {
+						return err
+					}
+					if chain.NoveltyGuarded() {
+						return markovRepo.IndexNovelty(ctx, chain.ID, texts, chain.NoveltyRunLength, chain.TextTokenizer())
+					}
+					return nil
 				})
 				if trainErr != nil {
 					logger.Printf("  [ERR]  [%d] %s (%s): train failed: %v", j.index, chain.Name, chain.ID, trainErr)
@@ -183,6 +287,14 @@ func main() {
 					continue
 				}
 
+				// Rebuilt from the trained chain for the same reason.
+				if err := markovRepo.ReindexRhymes(ctx, chain.ID, chain.Language()); err != nil {
+					logger.Printf("  [WARN] [%d] %s (%s): rhyme reindex failed: %v", j.index, chain.Name, chain.ID, err)
+				}
+				if err := markovRepo.ReindexKeywords(ctx, chain.ID); err != nil {
+					logger.Printf("  [WARN] [%d] %s (%s): keyword reindex failed: %v", j.index, chain.Name, chain.ID, err)
+				}
+
 				var trueBytes uint64
 				// Reconcile bytes only when NOT doing a fresh train (train_batch already tracks bytes accurately).
 				if !*clearCache {
@@ -211,6 +323,27 @@ func main() {
 		nOK.Load(), nSkipped.Load(), nErr.Load())
 }
 
+// connectCache opens the cache client and checks its function library like
+// the bot does at startup, exiting on failure.
+func connectCache(ctx context.Context, cacheURL string, loadLibrary bool) valkey.Client {
+	opt, err := valkey.ParseURL(cacheURL)
+	if err != nil {
+		log.Fatalf("parse cache url: %v", err)
+	}
+	config.ApplyValkeyClientTuning(&opt)
+	rdb, err := valkey.NewClient(opt)
+	if err != nil {
+		log.Fatalf("create cache client: %v", err)
+	}
+	if err := rdb.Do(ctx, rdb.B().Ping().Build()).Error(); err != nil {
+		log.Fatalf("cache ping: %v", err)
+	}
+	if err := repositories.EnsureLibrary(ctx, rdb, loadLibrary); err != nil {
+		log.Fatalf("cache function library check failed: %v", err)
+	}
+	return rdb
+}
+
 func formatBytes(b uint64) string {
 	switch {
 	case b >= 1<<20:
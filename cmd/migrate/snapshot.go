@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+
+	"rolando/internal/config"
+	"rolando/internal/repositories"
+)
+
+// runSnapshot handles the snapshot and restore subcommands, which write chain
+// dumps into the backup directory and load them back. Without --chain,
+// snapshot covers every non-empty chain. Restore wipes the guild with
+// clear_guild before reloading, then retrains its sub-chains like a replace
+// import; an empty snapshot is refused unless --force is given.
+func runSnapshot(cmd string, args []string) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dbPath := fs.String("db", config.DatabasePath, "path to SQLite database")
+	cacheURL := fs.String("cache", config.CacheURL, "cache service URL")
+	loadLibrary := fs.Bool("load-library", config.CacheLoadLibrary, "load the embedded Lua library into the cache service when missing or outdated")
+	dir := fs.String("dir", config.BackupDir, "snapshot directory")
+	retention := fs.Int("retention", config.BackupRetention, "snapshots kept per chain (0 = all)")
+	chainID := fs.String("chain", "", "guild/chain id (snapshot: all chains when empty)")
+	name := fs.String("name", "latest", "restore: snapshot file name, or latest")
+	list := fs.Bool("list", false, "restore: list the chain's snapshots instead of restoring")
+	force := fs.Bool("force", false, "restore: restore the snapshot even if it is empty")
+	fs.Parse(args)
+
+	if cmd == "restore" && *chainID == "" {
+		log.Fatalf("restore: --chain is required")
+	}
+
+	snapshotsRepo, err := repositories.NewSnapshotsRepository(*dir, *retention)
+	if err != nil {
+		log.Fatalf("open snapshot dir %s: %v", *dir, err)
+	}
+	if *list {
+		snapshots, err := snapshotsRepo.List(*chainID)
+		if err != nil {
+			log.Fatalf("list snapshots: %v", err)
+		}
+		for _, s := range snapshots {
+			log.Printf("%s  %d bytes", s.Name, s.Size)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	rdb := connectCache(ctx, *cacheURL, *loadLibrary)
+	defer rdb.Close()
+
+	chainsRepo, err := repositories.NewChainsRepository(*dbPath, rdb)
+	if err != nil {
+		log.Fatalf("open sqlite (chains): %v", err)
+	}
+
+	markovRepo := repositories.NewCacheRepository(rdb)
+
+	if cmd == "snapshot" {
+		var chains []*repositories.ChainConfig
+		if *chainID != "" {
+			chain, err := chainsRepo.GetChainByID(*chainID)
+			if err != nil {
+				log.Fatalf("load chain %s: %v", *chainID, err)
+			}
+			chains = append(chains, chain)
+		} else if chains, err = chainsRepo.GetAll(); err != nil {
+			log.Fatalf("list chains: %v", err)
+		}
+		failed, empty := 0, 0
+		for _, chain := range chains {
+			// Only an explicitly named chain is snapshotted while empty, so
+			// a full round cannot prune good snapshots away.
+			if *chainID == "" {
+				prefixes, messages, _, err := markovRepo.GetStats(ctx, chain.ID)
+				if err != nil {
+					log.Printf("stats %s: %v", chain.ID, err)
+					failed++
+					continue
+				}
+				if prefixes == 0 && messages == 0 {
+					empty++
+					continue
+				}
+			}
+			snapshot, err := snapshotsRepo.Create(chain.ID, func(w io.Writer) error {
+				return markovRepo.ExportChain(ctx, chain.ID, chain, w)
+			})
+			if err != nil {
+				log.Printf("snapshot %s: %v", chain.ID, err)
+				failed++
+				continue
+			}
+			log.Printf("Snapshot of %s (%s): %s, %d bytes", chain.Name, chain.ID, snapshot.Name, snapshot.Size)
+		}
+		if empty > 0 {
+			log.Printf("Skipped %d empty chains", empty)
+		}
+		if failed > 0 {
+			log.Fatalf("%d/%d snapshots failed", failed, len(chains))
+		}
+		return
+	}
+
+	chain, err := chainsRepo.GetChainByID(*chainID)
+	if err != nil {
+		log.Fatalf("load chain %s: %v", *chainID, err)
+	}
+	f, snapshot, err := snapshotsRepo.Open(chain.ID, *name)
+	if err != nil {
+		log.Fatalf("open snapshot %s: %v", *name, err)
+	}
+	defer f.Close()
+	res, err := markovRepo.ImportChain(ctx, chain.ID, f, repositories.ImportOptions{
+		Replace:        true,
+		MaxSizeBytes:   chain.MaxSizeBytes(),
+		MaxBranches:    chain.MarkovMaxBranches,
+		EvictionPolicy: chain.EvictionPolicy,
+		Accept: func(dumped *repositories.ChainConfig) error {
+			return chainsRepo.AcceptDumpConfig(chain, dumped, true)
+		},
+		AllowEmpty: *force,
+	})
+	if errors.Is(err, repositories.ErrEmptyChainDump) {
+		log.Fatalf("restore %s: snapshot %s is empty; pass --force to restore it anyway", chain.ID, snapshot.Name)
+	}
+	if err != nil {
+		log.Fatalf("restore %s: %v", chain.ID, err)
+	}
+	log.Printf("Restored %s (%s) from %s: %d states, %d transitions, %d media, truncated=%t",
+		chain.Name, chain.ID, snapshot.Name, res.States, res.Transitions, res.Media, res.Truncated)
+	afterImport(ctx, *dbPath, chainsRepo, markovRepo, chain, true)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"rolando/internal/logger"
 	"rolando/internal/repositories"
+	"sync"
+	"time"
 )
 
 type ChainAnalytics struct {
@@ -17,6 +20,7 @@ type ChainAnalytics struct {
 	Words           string `json:"words"`
 	Messages        string `json:"messages"`
 	Size            string `json:"bytes"`
+	Evicted         string `json:"evicted"`
 }
 
 type NumericChainAnalytics struct {
@@ -29,14 +33,15 @@ type NumericChainAnalytics struct {
 	Words           int64  `json:"words"`
 	Messages        int64  `json:"messages"`
 	Size            uint64 `json:"bytes"`
+	Evicted         int64  `json:"evicted"`
 }
 
 type MarkovChainAnalyzer struct {
 	chain     *repositories.ChainConfig
-	cacheRepo *repositories.CacheRepository
+	cacheRepo repositories.ChainStore
 }
 
-func NewMarkovChainAnalyzer(chain *repositories.ChainConfig, cacheRepo *repositories.CacheRepository) *MarkovChainAnalyzer {
+func NewMarkovChainAnalyzer(chain *repositories.ChainConfig, cacheRepo repositories.ChainStore) *MarkovChainAnalyzer {
 	return &MarkovChainAnalyzer{chain: chain, cacheRepo: cacheRepo}
 }
 
@@ -63,6 +68,7 @@ func (mca *MarkovChainAnalyzer) GetAnalytics(ctx context.Context) (ChainAnalytic
 		Words:           fmt.Sprintf("%d", raw.Words),
 		Messages:        fmt.Sprintf("%d", raw.Messages),
 		Size:            fmt.Sprintf("%d", raw.Size),
+		Evicted:         fmt.Sprintf("%d", raw.Evicted),
 	}, nil
 }
 
@@ -79,6 +85,10 @@ func (mca *MarkovChainAnalyzer) getRaw(ctx context.Context) (NumericChainAnalyti
 	if err != nil {
 		return NumericChainAnalytics{}, err
 	}
+	evicted, err := mca.cacheRepo.GetEvictions(ctx, mca.chain.ID)
+	if err != nil {
+		return NumericChainAnalytics{}, err
+	}
 	return NumericChainAnalytics{
 		ComplexityScore: complexityScore(prefixes, messages),
 		Gifs:            gifs,
@@ -89,5 +99,54 @@ func (mca *MarkovChainAnalyzer) getRaw(ctx context.Context) (NumericChainAnalyti
 		Words:           prefixes,
 		Messages:        messages,
 		Size:            size,
+		Evicted:         evicted,
 	}, nil
 }
+
+// DeepAnalysisTopN is how many tokens and prefixes a deep analysis ranks.
+const DeepAnalysisTopN = 10
+
+// DeepAnalysisMaxAge is how long a cached deep analysis is served before a
+// new pass is started.
+const DeepAnalysisMaxAge = 24 * time.Hour
+
+// deepInFlight holds the guilds with a deep analysis pass running, so
+// concurrent requests do not scan the same chain twice.
+var deepInFlight sync.Map
+
+// GetDeepAnalytics returns the guild's deep analysis, running a new pass when
+// refresh is set or the cached one is missing or older than
+// DeepAnalysisMaxAge. While another pass runs, the cached result is returned
+// as is (nil when there is none yet).
+func (mca *MarkovChainAnalyzer) GetDeepAnalytics(ctx context.Context, refresh bool) (*repositories.ChainAnalysis, error) {
+	cached, err := mca.cacheRepo.GetChainAnalysis(ctx, mca.chain.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !refresh && cached != nil && time.Since(cached.ComputedAt) < DeepAnalysisMaxAge {
+		return cached, nil
+	}
+	if _, running := deepInFlight.LoadOrStore(mca.chain.ID, struct{}{}); running {
+		return cached, nil
+	}
+	defer deepInFlight.Delete(mca.chain.ID)
+	return mca.cacheRepo.AnalyzeChain(ctx, mca.chain.ID, DeepAnalysisTopN)
+}
+
+// GetCachedDeepAnalytics returns the cached deep analysis without waiting
+// for a pass: when it is missing or stale a refresh is started in the
+// background and the (possibly nil) cached result is returned right away.
+func (mca *MarkovChainAnalyzer) GetCachedDeepAnalytics(ctx context.Context) (*repositories.ChainAnalysis, error) {
+	cached, err := mca.cacheRepo.GetChainAnalysis(ctx, mca.chain.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil || time.Since(cached.ComputedAt) >= DeepAnalysisMaxAge {
+		go func() {
+			if _, err := mca.GetDeepAnalytics(context.Background(), true); err != nil {
+				logger.Errorf("deep analysis of %s failed: %v", mca.chain.ID, err)
+			}
+		}()
+	}
+	return cached, nil
+}
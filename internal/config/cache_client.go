@@ -6,6 +6,10 @@ import (
 	"github.com/valkey-io/valkey-go"
 )
 
+// MemoryCacheURL, set as CACHE_URL, keeps chains in process memory instead of
+// the cache service. Meant for a single-node dev bot: nothing survives a restart.
+const MemoryCacheURL = "memory://"
+
 // ApplyValkeyClientTuning sets client options for a single-node Valkey used by
 // this Discord bot: many guilds in parallel, little overlap on the same guild.
 // Call after valkey.ParseURL so URL-derived auth/addresses stay intact.
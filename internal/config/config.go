@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +24,7 @@ var (
 	Env                  string
 	DatabasePath         string
 	CacheURL             string
+	CacheLoadLibrary     bool
 	ServerAddress        string
 	LogWebhook           string
 	StartupTime          time.Time
@@ -28,13 +33,19 @@ var (
 	PaywallsEnabled      bool
 	VoiceChatFeaturesSKU snowflake.ID
 	PremiumsPageLink     string
+	BackupDir            string
+	BackupInterval       time.Duration
+	BackupRetention      int
 )
 
 func init() {
 	log.Println("Initializing config...")
 	// Load environment variables from the .env file
+	// The variables may come from the environment alone (containers, tests).
 	err := godotenv.Load()
-	if err != nil {
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Println("No .env file, using the environment only")
+	} else if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 	Env = os.Getenv("GO_ENV")
@@ -46,7 +57,8 @@ func init() {
 	// Assign the environment variables to package-level variables
 	Token = os.Getenv("TOKEN")
 	if Token == "" {
-		log.Fatalf("TOKEN not set in the environment")
+		// Only the bot needs it; the bot exits without it.
+		log.Println("TOKEN not set in the environment")
 	}
 	InviteUrl = os.Getenv("INVITE_URL")
 	if InviteUrl == "" {
@@ -72,6 +84,27 @@ func init() {
 		log.Println("CACHE_URL not set in the environment")
 		CacheURL = "valkey://localhost:6379"
 	}
+	BackupDir = os.Getenv("BACKUP_DIR")
+	if BackupDir == "" {
+		BackupDir = filepath.Join(filepath.Dir(DatabasePath), "backups")
+	}
+	BackupInterval = 24 * time.Hour
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		BackupInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Printf("BACKUP_INTERVAL '%s' is not a valid duration, disabling scheduled backups\n", v)
+			BackupInterval = 0
+		}
+	}
+	BackupRetention = 7
+	if v := os.Getenv("BACKUP_RETENTION"); v != "" {
+		BackupRetention, err = strconv.Atoi(v)
+		if err != nil {
+			log.Printf("BACKUP_RETENTION '%s' is not a valid integer, defaulting to 7\n", v)
+			BackupRetention = 7
+		}
+	}
+	CacheLoadLibrary = os.Getenv("CACHE_LOAD_LIBRARY") == "true" || os.Getenv("CACHE_LOAD_LIBRARY") == "1" || os.Getenv("CACHE_LOAD_LIBRARY") == ""
 	ServerAddress = os.Getenv("SERVER_ADDRESS")
 	if ServerAddress == "" {
 		ServerAddress = "127.0.0.1:8080"
@@ -1,5 +1,9 @@
 package data
 
+// LangAuto is the TTS language of guilds whose voice chat follows the
+// language of each utterance.
+const LangAuto = "auto"
+
 var (
 	Langs         = []string{"en", "it", "de", "es"}
 	EmojiUnicodes = []string{
@@ -1,7 +1,13 @@
 package common
 
-import "context"
+import (
+	"context"
+
+	"rolando/internal/repositories"
+)
 
 type Jackbox interface {
-	GenerateLine(ctx context.Context, guildID string, maxWords int) (string, error)
+	// GenerateConstrained generates filtered text within c, or "" when the
+	// guild chain cannot satisfy it.
+	GenerateConstrained(ctx context.Context, guildID string, c repositories.Constraints) (string, error)
 }
@@ -11,6 +11,7 @@ import (
 	"sync/atomic"
 
 	"rolando/internal/jackbox/common"
+	"rolando/internal/repositories"
 
 	"github.com/gorilla/websocket"
 )
@@ -236,15 +237,18 @@ func (m *jobjob) genWriting(ctx context.Context, maxLen, minWords int) string {
 	if minWords <= 0 {
 		minWords = 5
 	}
-	var base string
 	if m.jackboxService != nil && m.sess.GuildID != "" {
-		if t, err := m.jackboxService.GenerateLine(ctx, m.sess.GuildID, minWords+rand.IntN(12)+4); err == nil {
-			base = strings.TrimSpace(t)
+		t, err := m.jackboxService.GenerateConstrained(ctx, m.sess.GuildID, repositories.Constraints{
+			MinWords: minWords,
+			MaxWords: minWords + rand.IntN(12) + 4,
+			MaxChars: maxLen,
+		})
+		if t = strings.TrimSpace(t); err == nil && t != "" {
+			return t
 		}
 	}
-	if strings.TrimSpace(base) == "" {
-		base = "one two three four five six seven eight nine ten eleven twelve"
-	}
+	// The chain could not fit the prompt: pad a placeholder instead.
+	base := "one two three four five six seven eight nine ten eleven twelve"
 	for wordCount(base) < minWords {
 		base += " fillerword"
 	}
@@ -11,6 +11,7 @@ import (
 	"sync/atomic"
 
 	"rolando/internal/jackbox/common"
+	"rolando/internal/repositories"
 
 	"github.com/gorilla/websocket"
 )
@@ -303,12 +304,15 @@ func (m *quiplash3) oneLine(ctx context.Context, maxLen int) string {
 	if m.jackboxService == nil || guildID == "" {
 		return ""
 	}
-	maxWords := 1 + rand.IntN(8)
-	t, err := m.jackboxService.GenerateLine(ctx, guildID, maxWords)
+	t, err := m.jackboxService.GenerateConstrained(ctx, guildID, repositories.Constraints{
+		MinWords: 1,
+		MaxWords: 1 + rand.IntN(8),
+		MaxChars: maxLen,
+	})
 	if err != nil {
 		return ""
 	}
-	return common.ClipRunes(t, maxLen)
+	return t
 }
 
 func (m *quiplash3) Close() error {
@@ -0,0 +1,28 @@
+package langdetect
+
+func init() {
+	register("de", `
+Ich weiß nicht, was du meinst, aber ich finde das eine gute Idee. Was machst
+du heute Abend? Wir sollten nach der Arbeit zusammen etwas spielen. Das war
+das Lustigste, was ich je gesehen habe, das musst du dir anschauen. Ja, ich
+stimme dir zu, das ist viel besser als das alte. Will jemand in den
+Sprachkanal kommen? Ich gehe jetzt schlafen, gute Nacht zusammen. Danke für
+die Hilfe, jetzt funktioniert es wirklich. Warum sollten sie das machen? Das
+ergibt überhaupt keinen Sinn. Hast du das neue Update gesehen? Sie haben alles
+geändert und ich hasse es. Mein Freund hat mir von diesem Spiel erzählt und es
+ist eigentlich ziemlich gut. Kannst du mir den Link schicken, wenn du zu Hause
+bist? Ich habe gerade genau das Gleiche gedacht. Wie spät ist es bei dir? Hier
+regnet es schon wieder und das Wetter ist schrecklich. Das würde ich niemals
+essen, es sieht ekelhaft aus. Ehrlich gesagt ist dieser Server das Beste, was
+mir dieses Jahr passiert ist. Sag mir Bescheid, wenn du bereit bist, dann
+können wir anfangen. Wer hat diese Nachricht geschrieben? Niemand weiß, was
+gestern passiert ist, aber alle reden darüber. Bitte hör auf, den Chat zu
+spammen. Ich brauche erst einen Kaffee, bevor ich über irgendetwas nachdenken
+kann. Wir fahren dieses Wochenende an den Strand, wenn das Wetter schön ist.
+Jemand sollte den Bot reparieren, weil er ständig komische Sachen sagt. Gerade
+arbeite ich von zu Hause und es ist wirklich ruhig. Die Schule fängt nächste
+Woche wieder an und ich habe meine Hausaufgaben nicht gemacht. Welches gefällt
+dir besser, das erste oder das zweite? Sie warten schon seit Stunden und nichts
+ist passiert. Möchtest du mit uns kommen? Ich glaube, es gibt einen besseren Weg.
+`)
+}
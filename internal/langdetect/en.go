@@ -0,0 +1,26 @@
+package langdetect
+
+func init() {
+	register("en", `
+I don't know what you mean, but I think it's a good idea. What are you doing
+tonight? We should play something together after work. That was the funniest
+thing I have ever seen, you have to watch it. Yeah I agree with you, this is
+so much better than the old one. Does anyone want to join the voice channel?
+I'm going to bed now, good night everyone. Thank you for the help, it really
+works now. Why would they do that? It doesn't make any sense at all. Have you
+seen the new update? They changed everything and I hate it. My friend told me
+about this game and it's actually pretty good. Can you send me the link when
+you get home? I was just thinking the same thing. What time is it where you
+live? It's raining again here and the weather is terrible. I would never eat
+that, it looks disgusting. Honestly this server is the best thing that happened
+to me this year. Let me know when you are ready and we can start. Who wrote
+this message? Nobody knows what happened yesterday but everybody is talking
+about it. Please stop spamming the chat. I need some coffee before I can think
+about anything. We are going to the beach this weekend if the weather is nice.
+Somebody should really fix the bot because it keeps saying weird things. That's
+what she said. Right now I'm working from home and it's really quiet. The
+school starts again next week and I haven't done my homework. Which one do you
+like more, the first or the second? They have been waiting for hours and nothing
+happened. Would you like to come with us? I think there should be a better way.
+`)
+}
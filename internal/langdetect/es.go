@@ -0,0 +1,27 @@
+package langdetect
+
+func init() {
+	register("es", `
+No sé qué quieres decir, pero creo que es una buena idea. ¿Qué haces esta
+noche? Deberíamos jugar algo juntos después del trabajo. Es lo más gracioso
+que he visto en mi vida, tienes que verlo. Sí, estoy de acuerdo contigo, esto
+es mucho mejor que el viejo. ¿Alguien quiere entrar al canal de voz? Me voy a
+dormir ya, buenas noches a todos. Gracias por la ayuda, ahora sí funciona.
+¿Por qué harían eso? No tiene ningún sentido. ¿Has visto la nueva
+actualización? Lo cambiaron todo y lo odio. Mi amigo me habló de este juego y
+la verdad es que está bastante bien. ¿Me puedes mandar el enlace cuando llegues
+a casa? Estaba pensando exactamente lo mismo. ¿Qué hora es donde vives? Aquí
+está lloviendo otra vez y el tiempo es horrible. Yo nunca comería eso, tiene
+una pinta asquerosa. Sinceramente este servidor es lo mejor que me ha pasado
+este año. Avísame cuando estés listo y podemos empezar. ¿Quién escribió este
+mensaje? Nadie sabe lo que pasó ayer pero todo el mundo está hablando de eso.
+Por favor deja de hacer spam en el chat. Necesito un café antes de poder
+pensar en nada. Vamos a la playa este fin de semana si hace buen tiempo.
+Alguien debería arreglar el bot porque no para de decir cosas raras. Ahora
+mismo estoy trabajando desde casa y está muy tranquilo. Las clases empiezan
+otra vez la semana que viene y no he hecho los deberes. ¿Cuál te gusta más,
+el primero o el segundo? Llevan horas esperando y no ha pasado nada. ¿Quieres
+venir con nosotros? Creo que debería haber una manera mejor. Bueno, pues nos
+vemos mañana, hasta luego.
+`)
+}
@@ -0,0 +1,27 @@
+package langdetect
+
+func init() {
+	register("it", `
+Non so cosa vuoi dire, ma secondo me è una buona idea. Cosa fai stasera?
+Dovremmo giocare qualcosa insieme dopo il lavoro. È la cosa più divertente che
+abbia mai visto, devi guardarla anche tu. Sì sono d'accordo con te, questo è
+molto meglio di quello vecchio. Qualcuno vuole entrare nel canale vocale? Io
+vado a dormire adesso, buona notte a tutti. Grazie per l'aiuto, adesso
+funziona davvero. Perché dovrebbero fare una cosa del genere? Non ha nessun
+senso. Hai visto il nuovo aggiornamento? Hanno cambiato tutto e lo odio. Il mio
+amico mi ha parlato di questo gioco ed è proprio bello. Mi mandi il link quando
+torni a casa? Stavo pensando esattamente la stessa cosa. Che ore sono da te?
+Qui piove di nuovo e il tempo fa schifo. Non mangerei mai quella roba, sembra
+disgustosa. Sinceramente questo server è la cosa migliore che mi sia successa
+quest'anno. Fammi sapere quando sei pronto e possiamo cominciare. Chi ha scritto
+questo messaggio? Nessuno sa cosa sia successo ieri ma tutti ne parlano. Per
+favore smettila di scrivere nella chat. Ho bisogno di un caffè prima di
+pensare a qualsiasi cosa. Andiamo al mare questo fine settimana se fa bel tempo.
+Qualcuno dovrebbe sistemare il bot perché continua a dire cose strane. Adesso
+sto lavorando da casa ed è molto tranquillo. La scuola ricomincia la settimana
+prossima e non ho fatto i compiti. Quale ti piace di più, il primo o il
+secondo? Stanno aspettando da ore e non è successo niente. Vuoi venire con noi?
+Penso che ci dovrebbe essere un modo migliore. Ragazzi che ne pensate? Boh,
+allora ci vediamo domani, ciao.
+`)
+}
@@ -0,0 +1,96 @@
+// Package langdetect guesses the language of short chat messages among the
+// languages in data.Langs, locally and without a model download.
+//
+// Each language has a character trigram profile built at startup from a small
+// sample of everyday text. A message is scored against every profile with a
+// naive Bayes model over its own trigrams; the best language wins only when it
+// beats the runner-up by a clear margin, so greetings, links and emoji-only
+// messages come back undetected instead of being guessed.
+package langdetect
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// minLetters is how many letters a message needs before it is classified.
+const minLetters = 8
+
+// minMargin is the average per-trigram log-probability lead the best language
+// needs over the runner-up.
+const minMargin = 0.15
+
+var reNoise = regexp.MustCompile(`https?://\S+|<[@#:!&a-zA-Z0-9_]+>|@\S+`)
+
+type profile struct {
+	lang   string
+	counts map[string]float64
+	total  float64
+}
+
+var profiles []*profile
+
+// vocabulary is the number of distinct trigrams across all profiles, used for
+// add-one smoothing.
+var vocabulary float64
+
+func register(lang, sample string) {
+	p := &profile{lang: lang, counts: make(map[string]float64)}
+	for _, g := range trigrams(sample) {
+		p.counts[g]++
+		p.total++
+	}
+	profiles = append(profiles, p)
+
+	seen := make(map[string]struct{})
+	for _, p := range profiles {
+		for g := range p.counts {
+			seen[g] = struct{}{}
+		}
+	}
+	vocabulary = float64(len(seen))
+}
+
+// Detect returns the language code of text, or "" when it is too short or too
+// ambiguous to tell.
+func Detect(text string) string {
+	grams := trigrams(reNoise.ReplaceAllString(text, " "))
+	// A padded word of n letters yields n trigrams.
+	if len(grams) < minLetters {
+		return ""
+	}
+	best, second := math.Inf(-1), math.Inf(-1)
+	lang := ""
+	for _, p := range profiles {
+		score := 0.0
+		for _, g := range grams {
+			score += math.Log((p.counts[g] + 1) / (p.total + vocabulary))
+		}
+		score /= float64(len(grams))
+		switch {
+		case score > best:
+			best, second, lang = score, best, p.lang
+		case score > second:
+			second = score
+		}
+	}
+	if best-second < minMargin {
+		return ""
+	}
+	return lang
+}
+
+// trigrams lower-cases text, keeps its words of letters and returns the
+// trigrams of each word padded with one space on both sides.
+func trigrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"rolando/internal/logger"
@@ -23,8 +26,48 @@ var (
 	reSpaces      = regexp.MustCompile(`\s+`)
 )
 
+// Sentence markers recorded around every trained message (must match BOS /
+// EOS in cache_markov.lua). Generation starts from a BOS prefix and stops when
+// EOS is sampled, so output reads like a whole message instead of a fragment.
+const (
+	tokenBOS = "\x02"
+	tokenEOS = "\x03"
+)
+
+// Sampling tunes how generation draws the next token from a prefix's
+// transitions. The zero value samples in proportion to raw counts.
+type Sampling struct {
+	Temperature float64 // 1 = raw counts, < 1 more coherent, > 1 more chaotic (<= 0 = 1)
+	TopK        int     // keep only the K most frequent successors (0 = unlimited)
+	TopP        float64 // nucleus mass to keep, in (0, 1] (0 = disabled)
+	// Smoothing is the discount interpolating the n-gram orders, in [0, 1).
+	// 0 keeps hard backoff: only the longest known prefix is sampled from.
+	Smoothing float64
+}
+
+func (s Sampling) args() []any {
+	temperature, topP, smoothing := s.Temperature, s.TopP, s.Smoothing
+	if temperature <= 0 {
+		temperature = 1
+	}
+	if topP <= 0 || topP > 1 {
+		topP = 1
+	}
+	if smoothing < 0 || smoothing >= 1 {
+		smoothing = 0
+	}
+	return []any{
+		strconv.FormatFloat(temperature, 'f', -1, 64),
+		s.TopK,
+		strconv.FormatFloat(topP, 'f', -1, 64),
+		strconv.FormatFloat(smoothing, 'f', -1, 64),
+	}
+}
+
 type CacheRepository struct {
 	rdb valkey.Client
+	// evicting holds the chains with an eviction pass running.
+	evicting sync.Map
 }
 
 func NewCacheRepository(rdb valkey.Client) *CacheRepository {
@@ -33,15 +76,14 @@ func NewCacheRepository(rdb valkey.Client) *CacheRepository {
 
 // Train ingests a single message into the chain for the given guild.
 // URLs are classified and stored in media sets instead.
-// maxSizeBytes = 0 means unlimited.
-func (r *CacheRepository) Train(ctx context.Context, guildID, message string, nGramSize, maxSizeBytes, maxBranches int) error {
+func (r *CacheRepository) Train(ctx context.Context, guildID, message string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
 	for _, url := range utils.ExtractUrls(message) {
 		if err := r.AddMedia(ctx, guildID, url); err != nil {
 			return err
 		}
 	}
 
-	tokens := tokenize(message)
+	tokens := tok.Tokenize(message)
 	if len(tokens) < nGramSize {
 		return nil
 	}
@@ -52,19 +94,80 @@ func (r *CacheRepository) Train(ctx context.Context, guildID, message string, nG
 		return nil
 	}
 
-	args := make([]string, 0, 3+len(pairs))
-	args = append(args, strconv.Itoa(maxSizeBytes), strconv.Itoa(maxBranches), "1")
-	args = append(args, pairs...)
+	args := append(limit.trainArgs(maxBranches, 1), pairs...)
+	return r.trainOrEvict(ctx, guildID, args, limit)
+}
+
+// ChannelChainID returns the chain ID of a guild channel's sub-chain. The "/"
+// separator keeps its keys out of the parent guild's SCAN patterns.
+func ChannelChainID(guildID, channelID string) string {
+	return guildID + "/" + channelID
+}
 
-	return r.runWriteFCall(ctx, guildID, "train_batch", func(c context.Context) error {
-		return r.doFCall(c, "train_batch", []string{guildID}, args).Error()
-	})
+// AuthorChainID returns the chain ID of a guild member's author sub-chain,
+// used by /imitate.
+func AuthorChainID(guildID, userID string) string {
+	return guildID + "@" + userID
+}
+
+// LanguageChainID returns the chain ID of a guild's sub-chain for one
+// language of data.Langs.
+func LanguageChainID(guildID, lang string) string {
+	return guildID + "#" + lang
+}
+
+// ChainKey returns a chain ID as it appears in cache keys, with the guild ID
+// hash-tagged: "{<guild_id>}", "{<guild_id>}/<channel_id>" and so on. A guild
+// and all of its sub-chains then share one cluster slot, so a Lua function
+// declaring the chain in KEYS may touch every key of the guild. Already
+// tagged IDs are returned unchanged.
+func ChainKey(id string) string {
+	if strings.HasPrefix(id, "{") {
+		return id
+	}
+	if i := strings.IndexAny(id, "/@#"); i >= 0 {
+		return "{" + id[:i] + "}" + id[i:]
+	}
+	return "{" + id + "}"
+}
+
+// chainIDFromKey undoes ChainKey.
+func chainIDFromKey(key string) string {
+	if !strings.HasPrefix(key, "{") {
+		return key
+	}
+	if i := strings.IndexByte(key, '}'); i > 0 {
+		return key[1:i] + key[i+1:]
+	}
+	return key
 }
 
 // TrainBatch ingests multiple messages using a single FCall per flush window.
 // This replaces the old per-n-gram pipeline, cutting round-trips from O(tokens)
 // to O(messages/flushEvery).
-func (r *CacheRepository) TrainBatch(ctx context.Context, guildID string, messages []string, nGramSize, maxSizeBytes, maxBranches int) error {
+func (r *CacheRepository) TrainBatch(ctx context.Context, guildID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return r.trainBatch(ctx, guildID, messages, true, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainChannelBatch ingests messages into a channel sub-chain. Media is only
+// tracked on the guild chain, so URLs are not added to media sets here.
+func (r *CacheRepository) TrainChannelBatch(ctx context.Context, guildID, channelID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return r.trainBatch(ctx, ChannelChainID(guildID, channelID), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainAuthorBatch ingests one member's messages into their author sub-chain.
+// Like channel sub-chains, media is not tracked here.
+func (r *CacheRepository) TrainAuthorBatch(ctx context.Context, guildID, userID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return r.trainBatch(ctx, AuthorChainID(guildID, userID), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainLanguageBatch ingests messages detected as lang into the guild's
+// language sub-chain, without media.
+func (r *CacheRepository) TrainLanguageBatch(ctx context.Context, guildID, lang string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return r.trainBatch(ctx, LanguageChainID(guildID, lang), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+func (r *CacheRepository) trainBatch(ctx context.Context, guildID string, messages []string, withMedia bool, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
 	const maxPairsPerCall = 4096 // keeps individual ARGV lists sane
 
 	pairs := make([]string, 0, 512)
@@ -74,25 +177,23 @@ func (r *CacheRepository) TrainBatch(ctx context.Context, guildID string, messag
 		if len(pairs) == 0 {
 			return nil
 		}
-		args := make([]string, 0, 3+len(pairs))
-		args = append(args, strconv.Itoa(maxSizeBytes), strconv.Itoa(maxBranches), strconv.Itoa(msgCount))
-		args = append(args, pairs...)
-		err := r.runWriteFCall(ctx, guildID, "train_batch", func(c context.Context) error {
-			return r.doFCall(c, "train_batch", []string{guildID}, args).Error()
-		})
+		args := append(limit.trainArgs(maxBranches, msgCount), pairs...)
+		err := r.trainOrEvict(ctx, guildID, args, limit)
 		pairs = pairs[:0]
 		msgCount = 0
 		return err
 	}
 
 	for _, msg := range messages {
-		for _, url := range utils.ExtractUrls(msg) {
-			if err := r.AddMedia(ctx, guildID, url); err != nil {
-				return err
+		if withMedia {
+			for _, url := range utils.ExtractUrls(msg) {
+				if err := r.AddMedia(ctx, guildID, url); err != nil {
+					return err
+				}
 			}
 		}
 
-		tokens := tokenize(msg)
+		tokens := tok.Tokenize(msg)
 		if len(tokens) < nGramSize {
 			continue
 		}
@@ -111,27 +212,24 @@ func (r *CacheRepository) TrainBatch(ctx context.Context, guildID string, messag
 	return flush()
 }
 
-// Delete removes a message's contribution from the chain.
-func (r *CacheRepository) Delete(ctx context.Context, guildID, message string, nGramSize int) error {
+// Delete removes a message's contribution from the chain, forward and reverse.
+func (r *CacheRepository) Delete(ctx context.Context, guildID, message string, nGramSize int, tok Tokenizer) error {
 	for _, url := range utils.ExtractUrls(message) {
 		if err := r.RemoveMedia(ctx, guildID, classifyURL(url), url); err != nil {
 			return err
 		}
 	}
 
-	tokens := tokenize(message)
+	tokens := tok.Tokenize(message)
 	if len(tokens) < nGramSize {
 		return nil
 	}
 
-	last := len(tokens) - nGramSize
-	cmds := make([]valkey.Completed, 0, last+1)
-	var prefixB strings.Builder
-	for i := 0; i <= last; i++ {
-		prefixB.Reset()
-		writeJoinedTokens(&prefixB, tokens, i, nGramSize-1)
-		prefix := prefixB.String()
-		next := tokens[i+nGramSize-1]
+	// Use the exact pairs train_batch recorded, sentence markers included.
+	pairs := buildPairs(tokens, nGramSize)
+	cmds := make([]valkey.Completed, 0, len(pairs))
+	for _, pair := range pairs {
+		prefix, next, _ := strings.Cut(pair, "\x00")
 		cmds = append(cmds, r.buildFCall("delete_markov", []string{guildID}, prefix, next))
 	}
 	return r.runWriteFCall(ctx, guildID, "delete_markov_pipeline", func(c context.Context) error {
@@ -145,13 +243,76 @@ func (r *CacheRepository) Delete(ctx context.Context, guildID, message string, n
 	})
 }
 
-// ClearGuild wipes all Markov state, media sets, and the byte counter for a guild.
+// ClearGuild wipes all Markov state (forward and reverse), channel, author and
+// language sub-chains, media sets, and the byte counter for a guild.
 func (r *CacheRepository) ClearGuild(ctx context.Context, guildID string) error {
 	return r.runWriteFCall(ctx, guildID, "clear_guild", func(c context.Context) error {
 		return r.fcallErr(c, "clear_guild", []string{guildID})
 	})
 }
 
+// ClearChannelChains wipes every channel sub-chain of a guild, leaving the
+// guild chain itself untouched. ClearGuild already covers them.
+func (r *CacheRepository) ClearChannelChains(ctx context.Context, guildID string) error {
+	return r.runWriteFCall(ctx, guildID, "clear_channel_chains", func(c context.Context) error {
+		return r.fcallErr(c, "clear_channel_chains", []string{guildID})
+	})
+}
+
+// ClearLanguageChains wipes every language sub-chain of a guild. ClearGuild
+// already covers them.
+func (r *CacheRepository) ClearLanguageChains(ctx context.Context, guildID string) error {
+	return r.runWriteFCall(ctx, guildID, "clear_language_chains", func(c context.Context) error {
+		return r.fcallErr(c, "clear_language_chains", []string{guildID})
+	})
+}
+
+// DropAuthorChain deletes a member's author sub-chain in a guild.
+func (r *CacheRepository) DropAuthorChain(ctx context.Context, guildID, userID string) error {
+	return r.runWriteFCall(ctx, guildID, "drop_author_chain", func(c context.Context) error {
+		return r.fcallErr(c, "drop_author_chain", []string{guildID}, userID)
+	})
+}
+
+// SubChains returns the IDs of a guild's channel, language and author
+// sub-chains that hold anything, sorted.
+func (r *CacheRepository) SubChains(ctx context.Context, guildID string) ([]string, error) {
+	const batchSize = 200
+	cursor := "0"
+	var ids []string
+
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWithCacheReadRetry(ctx, guildID, "list_sub_chains", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "list_sub_chains", []string{guildID}, cursor, batchSize)
+			return e
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list_sub_chains: %w", err)
+		}
+		if len(raw) < 2 {
+			return nil, fmt.Errorf("list_sub_chains: unexpected response len %d", len(raw))
+		}
+		if cursor, err = raw[0].ToString(); err != nil {
+			return nil, fmt.Errorf("list_sub_chains: cursor: %w", err)
+		}
+		keys, err := raw[1].AsStrSlice()
+		if err != nil {
+			return nil, fmt.Errorf("list_sub_chains: ids: %w", err)
+		}
+		for _, key := range keys {
+			ids = append(ids, chainIDFromKey(key))
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
 // SetFetching sets a flag indicating that the guild is currently fetching messages.
 func (r *CacheRepository) SetFetching(ctx context.Context, guildID string) error {
 	return r.fcallErr(ctx, "set_fetching", []string{guildID})
@@ -172,7 +333,7 @@ func (r *CacheRepository) IsFetching(ctx context.Context, guildID string) (bool,
 }
 
 // Generate produces text of up to maxLength tokens from a random starting prefix.
-func (r *CacheRepository) Generate(ctx context.Context, guildID string, maxLength int) (string, error) {
+func (r *CacheRepository) Generate(ctx context.Context, guildID string, maxLength int, sampling Sampling) (string, error) {
 	var prefix string
 	err := r.runWithCacheReadRetry(ctx, guildID, "find_prefix", func(c context.Context) error {
 		var e error
@@ -182,39 +343,47 @@ func (r *CacheRepository) Generate(ctx context.Context, guildID string, maxLengt
 	if err != nil || prefix == "" {
 		return "", err
 	}
-	return r.generateFrom(ctx, guildID, prefix, maxLength)
+	return r.generateFrom(ctx, guildID, prefix, maxLength, sampling)
 }
 
-// GenerateFromSeed produces text seeded by the given string.
-func (r *CacheRepository) GenerateFromSeed(ctx context.Context, guildID, seed string, maxLength int) (string, error) {
-	var prefix string
-	err := r.runWithCacheReadRetry(ctx, guildID, "find_prefix", func(c context.Context) error {
+// GenerateFromSeed produces a sentence containing the given seed. The Lua side
+// walks the reverse transition table back to a sentence start and generates
+// forward to an end, so the seed may land anywhere in the output.
+// The seed is tokenized like training text so it matches stored prefixes.
+// Returns "" when the chain has never seen the seed.
+func (r *CacheRepository) GenerateFromSeed(ctx context.Context, guildID, seed string, maxLength int, sampling Sampling, tok Tokenizer) (string, error) {
+	seed = strings.Join(tok.Tokenize(seed), " ")
+	if seed == "" {
+		return "", nil
+	}
+	args := append([]any{seed, maxLength}, sampling.args()...)
+	var out string
+	err := r.runWithCacheReadRetry(ctx, guildID, "generate_around", func(c context.Context) error {
 		var e error
-		prefix, e = r.fcallString(c, "find_prefix", []string{guildID}, seed)
+		out, e = r.fcallString(c, "generate_around", []string{guildID}, args...)
 		return e
 	})
-	if err != nil || prefix == "" {
-		return "", err
-	}
-	return r.generateFrom(ctx, guildID, prefix, maxLength)
+	return out, err
 }
 
-func (r *CacheRepository) generateFrom(ctx context.Context, guildID, prefix string, maxLength int) (string, error) {
+func (r *CacheRepository) generateFrom(ctx context.Context, guildID, prefix string, maxLength int, sampling Sampling) (string, error) {
+	args := append([]any{prefix, maxLength}, sampling.args()...)
 	var out string
 	err := r.runWithCacheReadRetry(ctx, guildID, "generate_markov", func(c context.Context) error {
 		var e error
-		out, e = r.fcallString(c, "generate_markov", []string{guildID}, prefix, maxLength)
+		out, e = r.fcallString(c, "generate_markov", []string{guildID}, args...)
 		return e
 	})
 	return out, err
 }
 
-// GenerateRhyme generates text whose last token rhymes with rhymeWord.
+// GenerateRhyme generates text whose last token rhymes with rhymeWord under
+// lang's phonetic rules, drawing rhyming tokens from the rhyme index.
 // The Lua side does a single forward pass, tracking rhyming successors at
 // each step and swapping the latest position above max_length/2 at the end.
-// Falls back to plain generated text when no rhyme is reachable.
-func (r *CacheRepository) GenerateRhyme(ctx context.Context, guildID, rhymeWord string, maxLength int) (string, error) {
-	suffix := extractRhymeSuffix(rhymeWord)
+// Falls back to plain generated text when nothing in the index rhymes.
+func (r *CacheRepository) GenerateRhyme(ctx context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error) {
+	key, word := rhymeTarget(rhymeWord, lang)
 
 	var prefix string
 	err := r.runWithCacheReadRetry(ctx, guildID, "find_prefix", func(c context.Context) error {
@@ -226,36 +395,93 @@ func (r *CacheRepository) GenerateRhyme(ctx context.Context, guildID, rhymeWord
 		return "", err
 	}
 
-	if suffix == "" {
-		return r.generateFrom(ctx, guildID, prefix, maxLength)
+	if key == "" {
+		return r.generateFrom(ctx, guildID, prefix, maxLength, sampling)
 	}
 
+	args := append([]any{prefix, maxLength, key, word}, sampling.args()...)
 	var out string
 	err = r.runWithCacheReadRetry(ctx, guildID, "generate_rhyme", func(c context.Context) error {
 		var e error
-		out, e = r.fcallString(c, "generate_rhyme", []string{guildID}, prefix, maxLength, suffix)
+		out, e = r.fcallString(c, "generate_rhyme", []string{guildID}, args...)
 		return e
 	})
 	return out, err
 }
 
 // GenerateRhymeFiltered is the filtered counterpart of GenerateRhyme.
-func (r *CacheRepository) GenerateRhymeFiltered(ctx context.Context, guildID, rhymeWord string, maxLength int) (string, error) {
-	raw, err := r.GenerateRhyme(ctx, guildID, rhymeWord, maxLength)
+func (r *CacheRepository) GenerateRhymeFiltered(ctx context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error) {
+	raw, err := r.GenerateRhyme(ctx, guildID, rhymeWord, lang, maxLength, sampling)
 	if err != nil {
 		return "", err
 	}
 	return FilterText(raw, false), nil
 }
 
-func extractRhymeSuffix(word string) string {
-	w := strings.ToLower(strings.TrimSpace(word))
-	if w == "" {
-		return ""
+// ErrCrossoverClustered is returned by GenerateCrossover on a cluster, where
+// different guilds' chains live in different slots and no single FCALL can
+// read them all.
+var ErrCrossoverClustered = errors.New("crossover is unavailable on a cache cluster")
+
+// GenerateCrossover generates text from a weighted blend of several guild
+// chains. The start prefix is drawn from one chain picked by weight; the Lua
+// side mixes the per-chain successor distributions at every step.
+// Output is filtered like GenerateFiltered.
+func (r *CacheRepository) GenerateCrossover(ctx context.Context, guildIDs []string, weights []float64, maxLength int, sampling Sampling) (string, error) {
+	if len(guildIDs) == 0 || len(guildIDs) != len(weights) {
+		return "", fmt.Errorf("crossover: %d chains with %d weights", len(guildIDs), len(weights))
+	}
+	if r.rdb.Mode() == valkey.ClientModeCluster {
+		return "", ErrCrossoverClustered
+	}
+	start := guildIDs[pickWeightedIndex(weights)]
+	opKey := strings.Join(guildIDs, "+")
+
+	var prefix string
+	err := r.runWithCacheReadRetry(ctx, start, "find_prefix", func(c context.Context) error {
+		var e error
+		prefix, e = r.fcallString(c, "find_prefix", []string{start}, "")
+		return e
+	})
+	if err != nil || prefix == "" {
+		return "", err
+	}
+
+	args := []any{prefix, maxLength}
+	for _, w := range weights {
+		args = append(args, strconv.FormatFloat(w, 'f', -1, 64))
 	}
-	runes := []rune(w)
-	n := min(len(runes), 3)
-	return string(runes[len(runes)-n:])
+	args = append(args, sampling.args()...)
+	var out string
+	err = r.runWithCacheReadRetry(ctx, opKey, "generate_crossover", func(c context.Context) error {
+		var e error
+		out, e = r.fcallString(c, "generate_crossover", guildIDs, args...)
+		return e
+	})
+	if err != nil {
+		return "", err
+	}
+	return FilterText(out, false), nil
+}
+
+// pickWeightedIndex returns an index into weights with probability
+// proportional to its (non-negative) weight; 0 when all weights are zero.
+func pickWeightedIndex(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += max(0, w)
+	}
+	if total <= 0 {
+		return 0
+	}
+	target := rand.Float64() * total
+	for i, w := range weights {
+		target -= max(0, w)
+		if target < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
 }
 
 // GetStats returns (uniquePrefixes, messageCount, estimatedBytes) for a guild.
@@ -346,6 +572,121 @@ func (r *CacheRepository) CapBranching(ctx context.Context, guildID string, maxB
 	return removed, nil
 }
 
+// Decay drives the paginated decay_batch Lua function, multiplying every
+// transition weight of the guild chain by factor (0 <= factor < 1) and
+// dropping those that reach zero. Returns the number of transitions removed.
+func (r *CacheRepository) Decay(ctx context.Context, guildID string, factor float64) (removed int64, err error) {
+	if factor < 0 || factor >= 1 {
+		return 0, nil
+	}
+
+	const batchSize = 200
+	cursor := "0"
+	f := strconv.FormatFloat(factor, 'f', -1, 64)
+
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWriteFCall(ctx, guildID, "decay_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "decay_batch", []string{guildID}, f, cursor, batchSize)
+			return e
+		})
+		if err != nil {
+			return removed, fmt.Errorf("decay_batch: %w", err)
+		}
+		nextCursor, n, err := parseCursorCount(raw)
+		if err != nil {
+			return removed, fmt.Errorf("decay_batch: %w", err)
+		}
+		removed += n
+		cursor = nextCursor
+		if cursor == "0" {
+			break
+		}
+	}
+
+	return removed, nil
+}
+
+// BackfillStartIndex drives the paginated backfill_start_index Lua function,
+// building the weighted start-prefix index for a guild trained before it existed.
+// Chains trained before sentence markers have no opening to index, so every
+// state is indexed for them instead. Safe to re-run; returns the number of
+// start prefixes indexed.
+func (r *CacheRepository) BackfillStartIndex(ctx context.Context, guildID string) (indexed int64, err error) {
+	for _, mode := range []string{"bos", "all"} {
+		if indexed, err = r.backfillStartIndex(ctx, guildID, mode); err != nil || indexed > 0 {
+			return indexed, err
+		}
+	}
+	return 0, nil
+}
+
+func (r *CacheRepository) backfillStartIndex(ctx context.Context, guildID, mode string) (indexed int64, err error) {
+	const batchSize = 200
+	cursor := "0"
+
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWriteFCall(ctx, guildID, "backfill_start_index", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "backfill_start_index", []string{guildID}, cursor, batchSize, mode)
+			return e
+		})
+		if err != nil {
+			return indexed, fmt.Errorf("backfill_start_index: %w", err)
+		}
+		nextCursor, n, err := parseCursorCount(raw)
+		if err != nil {
+			return indexed, fmt.Errorf("backfill_start_index: %w", err)
+		}
+		indexed += n
+		cursor = nextCursor
+		if cursor == "0" {
+			break
+		}
+	}
+
+	return indexed, nil
+}
+
+// MigrateKeyLayout drives the paginated migrate_key_layout Lua function,
+// moving a guild's keys, sub-chains included, from the untagged layout to the
+// ChainKey one. Must run against a standalone node. Safe to re-run; returns
+// the number of keys moved.
+func (r *CacheRepository) MigrateKeyLayout(ctx context.Context, guildID string) (moved int64, err error) {
+	const batchSize = 200
+	namespace, cursor := int64(1), "0"
+
+	for namespace != 0 {
+		var raw []valkey.ValkeyMessage
+		err := r.runWriteFCall(ctx, guildID, "migrate_key_layout", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "migrate_key_layout", []string{guildID}, namespace, cursor, batchSize)
+			return e
+		})
+		if err != nil {
+			return moved, fmt.Errorf("migrate_key_layout: %w", err)
+		}
+		if len(raw) < 3 {
+			return moved, fmt.Errorf("migrate_key_layout: unexpected response len %d", len(raw))
+		}
+		if namespace, err = raw[0].AsInt64(); err != nil {
+			return moved, fmt.Errorf("migrate_key_layout: namespace: %w", err)
+		}
+		if cursor, err = raw[1].ToString(); err != nil {
+			return moved, fmt.Errorf("migrate_key_layout: cursor: %w", err)
+		}
+		n, err := raw[2].AsInt64()
+		if err != nil {
+			return moved, fmt.Errorf("migrate_key_layout: count: %w", err)
+		}
+		moved += n
+	}
+
+	return moved, nil
+}
+
 // GetGuildSize returns the current estimated byte count (cheap counter read).
 // For an exact figure use ReconcileBytes.
 func (r *CacheRepository) GetGuildSize(ctx context.Context, guildID string) (uint64, error) {
@@ -376,7 +717,7 @@ func (r *CacheRepository) GetMediaCounts(ctx context.Context, guildID string) (g
 }
 
 func jackboxGuildKey(guildID string) string {
-	return "guild:" + guildID + ":jackbox"
+	return "guild:" + ChainKey(guildID) + ":jackbox"
 }
 
 func (r *CacheRepository) SetJackboxState(ctx context.Context, guildID, appTag string) error {
@@ -435,18 +776,24 @@ func (r *CacheRepository) AddMedia(ctx context.Context, guildID, url string) err
 }
 
 // GenerateFiltered generates text and strips URLs, pings, and noisy characters.
-func (r *CacheRepository) GenerateFiltered(ctx context.Context, guildID string, maxLength int) (string, error) {
-	unfiltered, err := r.Generate(ctx, guildID, maxLength)
+func (r *CacheRepository) GenerateFiltered(ctx context.Context, guildID string, maxLength int, sampling Sampling) (string, error) {
+	unfiltered, err := r.Generate(ctx, guildID, maxLength, sampling)
 	if err != nil {
 		return "", err
 	}
 	return FilterText(unfiltered, false), nil
 }
 
+// buildFCall declares keys, which are always chain IDs, in their ChainKey
+// form so the call is routed to the slot holding the chains' keys.
 func (r *CacheRepository) buildFCall(function string, keys []string, args ...string) valkey.Completed {
 	arb := r.rdb.B().Arbitrary("FCALL", function, strconv.Itoa(len(keys)))
 	if len(keys) > 0 {
-		arb = arb.Keys(keys...)
+		tagged := make([]string, len(keys))
+		for i, k := range keys {
+			tagged[i] = ChainKey(k)
+		}
+		arb = arb.Keys(tagged...)
 	}
 	if len(args) > 0 {
 		arb = arb.Args(args...)
@@ -576,18 +923,34 @@ func writeJoinedTokens(b *strings.Builder, tokens []string, start, count int) {
 }
 
 // buildPairs converts a token slice into NUL-delimited "prefix\0next_word" strings
-// ready to be sent as ARGV to train_batch.
+// ready to be sent as ARGV to train_batch. The message is wrapped in BOS/EOS
+// markers so its opening prefix and its ending are recorded as well.
+// Besides the (nGramSize-1)-token prefixes, every shorter prefix down to one
+// token is recorded, so generation can interpolate across orders (see
+// next_distribution in cache_markov.lua). Shorter prefixes opening with BOS
+// are left out: generation starts from a full-length opening prefix and BOS
+// never appears later in a window.
 func buildPairs(tokens []string, nGramSize int) []string {
-	last := len(tokens) - nGramSize
+	seq := make([]string, 0, len(tokens)+2)
+	seq = append(seq, tokenBOS)
+	seq = append(seq, tokens...)
+	seq = append(seq, tokenEOS)
+
+	last := len(seq) - nGramSize
 	if last < 0 {
 		return nil
 	}
-	pairs := make([]string, 0, last+1)
+	pairs := make([]string, 0, (last+1)*max(1, nGramSize-1))
 	var b strings.Builder
-	for i := 0; i <= last; i++ {
-		b.Reset()
-		writeJoinedTokens(&b, tokens, i, nGramSize-1)
-		pairs = append(pairs, b.String()+"\x00"+tokens[i+nGramSize-1])
+	for i := 1; i < len(seq); i++ {
+		for k := min(nGramSize-1, i); k >= 1; k-- {
+			if k < nGramSize-1 && seq[i-k] == tokenBOS {
+				continue
+			}
+			b.Reset()
+			writeJoinedTokens(&b, seq, i-k, k)
+			pairs = append(pairs, b.String()+"\x00"+seq[i])
+		}
 	}
 	return pairs
 }
@@ -596,7 +959,7 @@ func tokenize(text string) []string {
 	fields := strings.Fields(text)
 	out := make([]string, 0, len(fields))
 	for _, f := range fields {
-		if len(f) > 0 {
+		if len(f) > 0 && f != tokenBOS && f != tokenEOS {
 			out = append(out, f)
 		}
 	}
@@ -617,7 +980,7 @@ func classifyURL(url string) string {
 }
 
 // parseCursorCount decodes the {cursor_string, integer_count} pair that
-// reconcile_bytes_batch and cap_branching_batch return.
+// reconcile_bytes_batch, cap_branching_batch and backfill_start_index return.
 // Lua returns the cursor as a bulk string and the count as an integer,
 // so the slice elements have mixed types — string and int64.
 func parseCursorCount(raw []valkey.ValkeyMessage) (cursor string, count int64, err error) {
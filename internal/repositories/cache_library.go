@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"rolando/cache"
+	"rolando/internal/logger"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// LibraryVersion identifies a revision of cache_markov.lua: API changes on
+// incompatible changes, Version on every change.
+type LibraryVersion struct {
+	API     int64
+	Version int64
+}
+
+func (v LibraryVersion) String() string {
+	return fmt.Sprintf("api %d, version %d", v.API, v.Version)
+}
+
+var ErrLibraryIncompatible = errors.New("incompatible cache function library")
+
+var (
+	reLibraryAPI     = regexp.MustCompile(`(?m)^local LIBRARY_API\s*=\s*(\d+)`)
+	reLibraryVersion = regexp.MustCompile(`(?m)^local LIBRARY_VERSION\s*=\s*(\d+)`)
+)
+
+// EmbeddedLibrary is the version of the library built into the binary, read
+// from its LIBRARY_API and LIBRARY_VERSION constants.
+var EmbeddedLibrary = mustParseLibraryVersion(cache.MarkovLibrary)
+
+func mustParseLibraryVersion(src string) LibraryVersion {
+	parse := func(re *regexp.Regexp) int64 {
+		m := re.FindStringSubmatch(src)
+		if m == nil {
+			panic("cache_markov.lua: missing " + re.String())
+		}
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		return n
+	}
+	return LibraryVersion{API: parse(reLibraryAPI), Version: parse(reLibraryVersion)}
+}
+
+// loadedLibrary asks one node for the version of its library. ok is false
+// when the library is missing or predates library_version.
+func loadedLibrary(ctx context.Context, node valkey.Client) (v LibraryVersion, ok bool, err error) {
+	vals, err := node.Do(ctx, node.B().FcallRo().Function("library_version").Numkeys(0).Build()).AsIntSlice()
+	if err != nil {
+		if verr, isValkeyErr := valkey.IsValkeyErr(err); isValkeyErr && strings.Contains(strings.ToLower(verr.Error()), "function not found") {
+			return v, false, nil
+		}
+		return v, false, err
+	}
+	if len(vals) < 2 {
+		return v, false, fmt.Errorf("library_version: unexpected response len %d", len(vals))
+	}
+	return LibraryVersion{API: vals[0], Version: vals[1]}, true, nil
+}
+
+// EnsureLibrary checks that every node of the cache service runs the
+// embedded function library. With load set, a missing or different library
+// is replaced with FUNCTION LOAD REPLACE. Otherwise a library with another
+// API fails with ErrLibraryIncompatible, while another version of the same
+// API is only logged. Replicas refusing the load get it from their primary.
+func EnsureLibrary(ctx context.Context, rdb valkey.Client, load bool) error {
+	nodes := map[string]valkey.Client{"cache service": rdb}
+	if rdb.Mode() == valkey.ClientModeCluster {
+		nodes = rdb.Nodes()
+	}
+	want := EmbeddedLibrary
+
+	for addr, node := range nodes {
+		got, ok, err := loadedLibrary(ctx, node)
+		if err != nil {
+			return fmt.Errorf("check cache library on %s: %w", addr, err)
+		}
+		if ok && got == want {
+			continue
+		}
+
+		if load {
+			err := node.Do(ctx, node.B().FunctionLoad().Replace().FunctionCode(cache.MarkovLibrary).Build()).Error()
+			if verr, isValkeyErr := valkey.IsValkeyErr(err); isValkeyErr && strings.HasPrefix(verr.Error(), "READONLY") {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("load cache library on %s: %w", addr, err)
+			}
+			logger.Infof("Loaded cache library (%s) on %s", want, addr)
+			continue
+		}
+
+		switch {
+		case !ok:
+			return fmt.Errorf("%w: %s has no versioned library, this build needs %s; load cache/cache_markov.lua or enable CACHE_LOAD_LIBRARY", ErrLibraryIncompatible, addr, want)
+		case got.API != want.API:
+			return fmt.Errorf("%w: %s runs %s, this build needs %s; load cache/cache_markov.lua or enable CACHE_LOAD_LIBRARY", ErrLibraryIncompatible, addr, got, want)
+		default:
+			logger.Warnf("Cache library on %s is %s, this build ships %s", addr, got, want)
+		}
+	}
+	return nil
+}
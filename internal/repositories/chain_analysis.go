@@ -0,0 +1,264 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// ChainAnalysis is the result of a full structural pass over a guild chain.
+// It is expensive on large chains, so stores keep the latest one around with
+// its ComputedAt timestamp.
+type ChainAnalysis struct {
+	States       int64   `json:"states"`      // distinct prefixes
+	Transitions  int64   `json:"transitions"` // distinct (prefix, next) pairs
+	Weight       int64   `json:"weight"`      // sum of all transition counts
+	AvgBranching float64 `json:"avg_branching"`
+	// AvgEntropy is the mean Shannon entropy of the states' successor
+	// distributions, in bits: 0 means fully predictable.
+	AvgEntropy float64 `json:"avg_entropy"`
+	// DeadEndRatio is the share of non-EOS transitions leading to a prefix
+	// with no state of its own, where generation has to back off.
+	DeadEndRatio       float64           `json:"dead_end_ratio"`
+	BranchingHistogram []HistogramBucket `json:"branching_histogram"`
+	TopTokens          []RankedEntry     `json:"top_tokens"`
+	TopPrefixes        []RankedEntry     `json:"top_prefixes"`
+	ComputedAt         time.Time         `json:"computed_at"`
+}
+
+// HistogramBucket counts the states whose branching factor is in [Min, Max];
+// Max is 0 for the open-ended last bucket.
+type HistogramBucket struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Count int64 `json:"count"`
+}
+
+type RankedEntry struct {
+	Text  string `json:"text"`
+	Count int64  `json:"count"`
+}
+
+// analysisBuckets must match ANALYSIS_BUCKETS in cache_markov.lua: bucket i
+// holds branching factors in (2^(i-1), 2^i], the first one exactly 1.
+const analysisBuckets = 9
+
+func newHistogram() []HistogramBucket {
+	h := make([]HistogramBucket, analysisBuckets)
+	for i := range h {
+		h[i].Max = 1 << i
+		if i > 0 {
+			h[i].Min = 1<<(i-1) + 1
+		} else {
+			h[i].Min = 1
+		}
+	}
+	h[analysisBuckets-1].Max = 0
+	return h
+}
+
+func histogramBucket(branches int) int {
+	b := 0
+	for b < analysisBuckets-1 && branches > 1<<b {
+		b++
+	}
+	return b
+}
+
+// displayTokens renders a stored prefix for humans, spelling out the sentence
+// start marker so openings stay distinguishable.
+func displayTokens(prefix string) string {
+	return strings.ReplaceAll(prefix, tokenBOS, "<s>")
+}
+
+// analysisAccumulator merges per-page results into a ChainAnalysis.
+type analysisAccumulator struct {
+	a                    ChainAnalysis
+	entropy              float64
+	successors, deadEnds int64
+	topN                 int
+}
+
+func newAnalysisAccumulator(topN int) *analysisAccumulator {
+	return &analysisAccumulator{a: ChainAnalysis{BranchingHistogram: newHistogram()}, topN: topN}
+}
+
+func (acc *analysisAccumulator) addPrefixes(entries []RankedEntry) {
+	acc.a.TopPrefixes = topRanked(append(acc.a.TopPrefixes, entries...), acc.topN)
+}
+
+func (acc *analysisAccumulator) result() *ChainAnalysis {
+	a := acc.a
+	if a.States > 0 {
+		a.AvgBranching = float64(a.Transitions) / float64(a.States)
+		a.AvgEntropy = acc.entropy / float64(a.States)
+	}
+	if acc.successors > 0 {
+		a.DeadEndRatio = float64(acc.deadEnds) / float64(acc.successors)
+	}
+	if a.TopTokens == nil {
+		a.TopTokens = []RankedEntry{}
+	}
+	if a.TopPrefixes == nil {
+		a.TopPrefixes = []RankedEntry{}
+	}
+	a.ComputedAt = time.Now().UTC()
+	return &a
+}
+
+func topRanked(entries []RankedEntry, n int) []RankedEntry {
+	slices.SortStableFunc(entries, func(x, y RankedEntry) int {
+		return cmp.Or(cmp.Compare(y.Count, x.Count), cmp.Compare(x.Text, y.Text))
+	})
+	return entries[:min(n, len(entries))]
+}
+
+func analysisKey(guildID string) string {
+	return "analysis:" + ChainKey(guildID)
+}
+
+// AnalyzeChain drives the paginated analyze_batch Lua function over the
+// guild's forward chain, ranking the topN most frequent tokens and prefixes,
+// and caches the result for GetChainAnalysis.
+func (r *CacheRepository) AnalyzeChain(ctx context.Context, guildID string, topN int) (*ChainAnalysis, error) {
+	const batchSize = 200
+	cursor := "0"
+	acc := newAnalysisAccumulator(topN)
+
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWithCacheReadRetry(ctx, guildID, "analyze_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "analyze_batch", []string{guildID}, cursor, batchSize, topN)
+			return e
+		})
+		if err != nil {
+			return nil, fmt.Errorf("analyze_batch: %w", err)
+		}
+		next, err := acc.addPage(raw)
+		if err != nil {
+			return nil, fmt.Errorf("analyze_batch: %w", err)
+		}
+		cursor = next
+		if cursor == "0" {
+			break
+		}
+	}
+
+	a := acc.result()
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	err = r.runWriteFCall(ctx, guildID, "analysis_set", func(c context.Context) error {
+		return r.rdb.Do(c, r.rdb.B().Set().Key(analysisKey(guildID)).Value(string(data)).Build()).Error()
+	})
+	return a, err
+}
+
+// addPage folds one analyze_batch reply into the accumulator and returns the
+// next cursor.
+func (acc *analysisAccumulator) addPage(raw []valkey.ValkeyMessage) (string, error) {
+	if len(raw) < 10 {
+		return "", fmt.Errorf("unexpected response len %d", len(raw))
+	}
+	cursor, err := raw[0].ToString()
+	if err != nil {
+		return "", fmt.Errorf("cursor: %w", err)
+	}
+	var counts [5]int64
+	for i, idx := range []int{1, 2, 3, 5, 6} {
+		if counts[i], err = raw[idx].AsInt64(); err != nil {
+			return "", fmt.Errorf("field %d: %w", idx, err)
+		}
+	}
+	entropy, err := raw[4].ToString()
+	if err != nil {
+		return "", fmt.Errorf("entropy: %w", err)
+	}
+	e, err := strconv.ParseFloat(entropy, 64)
+	if err != nil {
+		return "", fmt.Errorf("entropy: %w", err)
+	}
+	acc.a.States += counts[0]
+	acc.a.Transitions += counts[1]
+	acc.a.Weight += counts[2]
+	acc.successors += counts[3]
+	acc.deadEnds += counts[4]
+	acc.entropy += e
+
+	histogram, err := raw[7].AsIntSlice()
+	if err != nil {
+		return "", fmt.Errorf("histogram: %w", err)
+	}
+	for i, n := range histogram {
+		if i < analysisBuckets {
+			acc.a.BranchingHistogram[i].Count += n
+		}
+	}
+
+	prefixes, err := rankedPairs(raw[8])
+	if err != nil {
+		return "", fmt.Errorf("top prefixes: %w", err)
+	}
+	acc.addPrefixes(prefixes)
+	tokens, err := rankedPairs(raw[9])
+	if err != nil {
+		return "", fmt.Errorf("top tokens: %w", err)
+	}
+	if len(tokens) > 0 {
+		acc.a.TopTokens = tokens
+	}
+	return cursor, nil
+}
+
+// rankedPairs parses a flat {text, count, ...} reply. Counts are integers
+// for prefixes and strings for ZREVRANGE WITHSCORES; AsInt64 reads both.
+func rankedPairs(msg valkey.ValkeyMessage) ([]RankedEntry, error) {
+	arr, err := msg.ToArray()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RankedEntry, 0, len(arr)/2)
+	for i := 0; i+1 < len(arr); i += 2 {
+		text, err := arr[i].ToString()
+		if err != nil {
+			return nil, err
+		}
+		count, err := arr[i+1].AsInt64()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RankedEntry{Text: displayTokens(text), Count: count})
+	}
+	return out, nil
+}
+
+// GetChainAnalysis returns the analysis cached by the last AnalyzeChain, or
+// nil when the guild was never analyzed (or was cleared since).
+func (r *CacheRepository) GetChainAnalysis(ctx context.Context, guildID string) (*ChainAnalysis, error) {
+	var data string
+	err := r.runWithCacheReadRetry(ctx, guildID, "analysis_get", func(c context.Context) error {
+		s, e := r.rdb.Do(c, r.rdb.B().Get().Key(analysisKey(guildID)).Build()).ToString()
+		if valkey.IsValkeyNil(e) {
+			return nil
+		}
+		data = s
+		return e
+	})
+	if err != nil || data == "" {
+		return nil, err
+	}
+	var a ChainAnalysis
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return nil, fmt.Errorf("analysis: %w", err)
+	}
+	return &a, nil
+}
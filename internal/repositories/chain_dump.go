@@ -0,0 +1,504 @@
+package repositories
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// ChainDumpFormat and ChainDumpVersion identify the portable chain dump.
+// Bump the version whenever a record changes meaning; ImportChain refuses
+// dumps newer than it understands.
+//
+// Version 2 state records cover every n-gram order. Version 1 dumps only
+// carry the highest order, so importing one would leave the lower orders
+// that interpolation backs off to empty; they are rejected (see
+// minChainDumpVersion) and have to be re-exported.
+const (
+	ChainDumpFormat     = "rolando-chain"
+	ChainDumpVersion    = 2
+	minChainDumpVersion = 2
+)
+
+// Dump record types. A dump is newline-delimited JSON: one header, then
+// config, stats, state and media records in any number, then one end record.
+const (
+	dumpRecordHeader = "header"
+	dumpRecordConfig = "config"
+	dumpRecordStats  = "stats"
+	dumpRecordState  = "state"
+	dumpRecordMedia  = "media"
+	dumpRecordEnd    = "end"
+)
+
+// dumpMediaKinds are the media sets carried by a dump (see classifyURL).
+var dumpMediaKinds = []string{"gif", "image", "video", "generic"}
+
+// chainDumpRecord is one line of a chain dump. Only the fields relevant to
+// Type are set.
+type chainDumpRecord struct {
+	Type string `json:"type"`
+
+	// header
+	Format     string     `json:"format,omitempty"`
+	Version    int        `json:"version,omitempty"`
+	ChainID    string     `json:"chain_id,omitempty"`
+	ExportedAt *time.Time `json:"exported_at,omitempty"`
+
+	// config
+	Config *ChainConfig `json:"config,omitempty"`
+
+	// stats
+	Messages int64 `json:"messages,omitempty"`
+
+	// state: forward transitions of one prefix; reverse transitions and the
+	// start index are rebuilt on import
+	Prefix string           `json:"prefix,omitempty"`
+	Next   map[string]int64 `json:"next,omitempty"`
+
+	// media
+	Kind string   `json:"kind,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+
+	// end
+	States int64 `json:"states,omitempty"`
+	Media  int64 `json:"media,omitempty"`
+}
+
+// ImportOptions controls how ImportChain applies a dump.
+type ImportOptions struct {
+	// Replace wipes the target chain before importing; otherwise the dump's
+	// counts are added on top of the existing chain.
+	Replace bool
+	// MaxSizeBytes and MaxBranches are the target chain's limits (0 = unlimited).
+	// The import never evicts: it stops at the size limit.
+	MaxSizeBytes int
+	MaxBranches  int
+	// EvictionPolicy is the target chain's, so the imported states enter its
+	// age index when it evicts the oldest states.
+	EvictionPolicy string
+	// Accept, if set, is handed the dump's config before anything is written
+	// and can veto the import by returning an error.
+	Accept func(dumped *ChainConfig) error
+	// AllowEmpty lets a replacing import apply a dump with no states, media
+	// or messages, which would otherwise fail with ErrEmptyChainDump rather
+	// than wipe the chain.
+	AllowEmpty bool
+}
+
+// ErrEmptyChainDump is returned when a replacing import would swap the chain
+// for an empty dump without ImportOptions.AllowEmpty.
+var ErrEmptyChainDump = errors.New("chain dump is empty")
+
+// ImportResult summarises an applied dump.
+type ImportResult struct {
+	States      int64 `json:"states"`
+	Transitions int64 `json:"transitions"`
+	Media       int64 `json:"media"`
+	Messages    int64 `json:"messages"`
+	// Truncated is set when the size limit stopped the import early, in
+	// which case the dump's message count is not credited.
+	Truncated bool `json:"truncated"`
+}
+
+// chainDumpWriter encodes a dump record by record, tallying the end record.
+type chainDumpWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+	end chainDumpRecord
+}
+
+// newChainDumpWriter writes the header, config (if any) and stats records.
+func newChainDumpWriter(w io.Writer, chainID string, cfg *ChainConfig, messages int64) (*chainDumpWriter, error) {
+	bw := bufio.NewWriter(w)
+	dw := &chainDumpWriter{bw: bw, enc: json.NewEncoder(bw), end: chainDumpRecord{Type: dumpRecordEnd}}
+
+	now := time.Now().UTC()
+	if err := dw.enc.Encode(chainDumpRecord{
+		Type:       dumpRecordHeader,
+		Format:     ChainDumpFormat,
+		Version:    ChainDumpVersion,
+		ChainID:    chainID,
+		ExportedAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+	if cfg != nil {
+		if err := dw.enc.Encode(chainDumpRecord{Type: dumpRecordConfig, Config: cfg}); err != nil {
+			return nil, err
+		}
+	}
+	if err := dw.enc.Encode(chainDumpRecord{Type: dumpRecordStats, Messages: messages}); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+func (dw *chainDumpWriter) writeState(prefix string, next map[string]int64) error {
+	if len(next) == 0 {
+		return nil
+	}
+	dw.end.States++
+	return dw.enc.Encode(chainDumpRecord{Type: dumpRecordState, Prefix: prefix, Next: next})
+}
+
+func (dw *chainDumpWriter) writeMedia(kind string, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	dw.end.Media += int64(len(urls))
+	return dw.enc.Encode(chainDumpRecord{Type: dumpRecordMedia, Kind: kind, URLs: urls})
+}
+
+// close writes the end record and flushes.
+func (dw *chainDumpWriter) close() error {
+	if err := dw.enc.Encode(dw.end); err != nil {
+		return err
+	}
+	return dw.bw.Flush()
+}
+
+// chainDumpSink applies a decoded dump to one store.
+type chainDumpSink struct {
+	// clear wipes the target chain (replace mode).
+	clear func() error
+	// train ingests weighted "prefix\0next\0count" pairs with train_batch
+	// semantics and reports false when the size limit kept any of them out.
+	train func(pairs []string) (bool, error)
+	// addMedia adds URLs to one media set.
+	addMedia func(kind string, urls []string) error
+	// countMessages credits n messages to the chain's stats and reports false
+	// when the size limit refused them.
+	countMessages func(n int64) (bool, error)
+}
+
+// readChainDump decodes a dump from src and feeds it to sink in batches.
+// The dump is validated up to its config record, and opts.Accept consulted,
+// before anything is written.
+func readChainDump(src io.Reader, opts ImportOptions, sink chainDumpSink) (*ImportResult, error) {
+	const maxPairsPerCall = 4096 // same bound as trainBatch
+
+	dec := json.NewDecoder(bufio.NewReader(src))
+	res := &ImportResult{}
+
+	var header chainDumpRecord
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("read dump header: %w", err)
+	}
+	if header.Type != dumpRecordHeader || header.Format != ChainDumpFormat {
+		return nil, errors.New("not a chain dump")
+	}
+	if header.Version < minChainDumpVersion {
+		return nil, fmt.Errorf("chain dump version %d predates multi-order states; export the chain again", header.Version)
+	}
+	if header.Version > ChainDumpVersion {
+		return nil, fmt.Errorf("unsupported chain dump version %d", header.Version)
+	}
+
+	// The config record (if any) comes right after the header; hold on to
+	// the first record that is not one so the main loop can process it.
+	var pending *chainDumpRecord
+	var dumped *ChainConfig
+	var first chainDumpRecord
+	switch err := dec.Decode(&first); {
+	case errors.Is(err, io.EOF):
+		return nil, errors.New("truncated chain dump")
+	case err != nil:
+		return nil, fmt.Errorf("read dump: %w", err)
+	case first.Type == dumpRecordConfig:
+		dumped = first.Config
+	default:
+		pending = &first
+	}
+	if opts.Accept != nil {
+		if err := opts.Accept(dumped); err != nil {
+			return nil, err
+		}
+	}
+
+	// In replace mode the chain is wiped right before the first write, so a
+	// dump that turns out empty or cut short leaves it untouched.
+	cleared := !opts.Replace
+	clear := func() error {
+		if cleared {
+			return nil
+		}
+		cleared = true
+		return sink.clear()
+	}
+
+	pairs := make([]string, 0, 512)
+	flush := func() error {
+		if len(pairs) == 0 || res.Truncated {
+			pairs = pairs[:0]
+			return nil
+		}
+		if err := clear(); err != nil {
+			return err
+		}
+		written, err := sink.train(pairs)
+		pairs = pairs[:0]
+		if err != nil {
+			return err
+		}
+		if !written {
+			res.Truncated = true
+		}
+		return nil
+	}
+
+	sawEnd := false
+	for !sawEnd {
+		var rec chainDumpRecord
+		if pending != nil {
+			rec, pending = *pending, nil
+		} else if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return res, fmt.Errorf("read dump: %w", err)
+		}
+
+		switch rec.Type {
+		case dumpRecordStats:
+			res.Messages += rec.Messages
+		case dumpRecordState:
+			if res.Truncated || rec.Prefix == "" {
+				continue
+			}
+			// Heaviest transitions first, so a branching cap keeps the same
+			// successors it would have kept had the counts been trained live.
+			next := make([]string, 0, len(rec.Next))
+			for word, n := range rec.Next {
+				if n > 0 {
+					next = append(next, word)
+				}
+			}
+			slices.SortFunc(next, func(a, b string) int {
+				return cmp.Compare(rec.Next[b], rec.Next[a])
+			})
+			for _, word := range next {
+				pairs = append(pairs, rec.Prefix+"\x00"+word+"\x00"+strconv.FormatInt(rec.Next[word], 10))
+			}
+			res.States++
+			res.Transitions += int64(len(next))
+			if len(pairs) >= maxPairsPerCall {
+				if err := flush(); err != nil {
+					return res, err
+				}
+			}
+		case dumpRecordMedia:
+			if !slices.Contains(dumpMediaKinds, rec.Kind) || len(rec.URLs) == 0 {
+				continue
+			}
+			if err := clear(); err != nil {
+				return res, err
+			}
+			if err := sink.addMedia(rec.Kind, rec.URLs); err != nil {
+				return res, err
+			}
+			res.Media += int64(len(rec.URLs))
+		case dumpRecordEnd:
+			sawEnd = true
+		}
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+	if !sawEnd {
+		return res, errors.New("truncated chain dump")
+	}
+	if opts.Replace && !opts.AllowEmpty && res.States == 0 && res.Media == 0 && res.Messages == 0 {
+		return res, ErrEmptyChainDump
+	}
+	if err := clear(); err != nil {
+		return res, err
+	}
+
+	// Message count is credited once, after the transitions it accounts for.
+	if res.Messages > 0 && !res.Truncated {
+		counted, err := sink.countMessages(res.Messages)
+		if err != nil {
+			return res, err
+		}
+		res.Truncated = !counted
+	}
+	return res, nil
+}
+
+// ExportChain streams the guild chain (forward transitions, media sets and
+// message count) plus cfg as a versioned dump to w. Channel and author
+// sub-chains are derived from stored messages and are not exported.
+func (r *CacheRepository) ExportChain(ctx context.Context, guildID string, cfg *ChainConfig, w io.Writer) error {
+	_, messages, _, err := r.GetStats(ctx, guildID)
+	if err != nil {
+		return fmt.Errorf("get_stats_markov: %w", err)
+	}
+	dw, err := newChainDumpWriter(w, guildID, cfg, messages)
+	if err != nil {
+		return err
+	}
+
+	const stateBatchSize = 200
+	cursor := "0"
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWithCacheReadRetry(ctx, guildID, "export_states_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "export_states_batch", []string{guildID}, cursor, stateBatchSize)
+			return e
+		})
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		nextCursor, rows, err := parseCursorRows(raw)
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		for _, row := range rows {
+			if len(row) < 3 {
+				continue
+			}
+			next := make(map[string]int64, (len(row)-1)/2)
+			for i := 1; i+1 < len(row); i += 2 {
+				n, err := strconv.ParseInt(row[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					continue
+				}
+				next[row[i]] = n
+			}
+			if err := dw.writeState(row[0], next); err != nil {
+				return err
+			}
+		}
+		cursor = nextCursor
+		if cursor == "0" {
+			break
+		}
+	}
+
+	const mediaBatchSize = 500
+	for _, kind := range dumpMediaKinds {
+		cursor := "0"
+		for {
+			var raw []valkey.ValkeyMessage
+			err := r.runWithCacheReadRetry(ctx, guildID, "export_media_batch", func(c context.Context) error {
+				var e error
+				raw, e = r.fcallArray(c, "export_media_batch", []string{guildID}, kind, cursor, mediaBatchSize)
+				return e
+			})
+			if err != nil {
+				return fmt.Errorf("export_media_batch: %w", err)
+			}
+			if len(raw) < 2 {
+				return fmt.Errorf("export_media_batch: unexpected response len %d", len(raw))
+			}
+			if cursor, err = raw[0].ToString(); err != nil {
+				return fmt.Errorf("export_media_batch: cursor: %w", err)
+			}
+			urls, err := raw[1].AsStrSlice()
+			if err != nil {
+				return fmt.Errorf("export_media_batch: members: %w", err)
+			}
+			if err := dw.writeMedia(kind, urls); err != nil {
+				return err
+			}
+			if cursor == "0" {
+				break
+			}
+		}
+	}
+
+	return dw.close()
+}
+
+// ImportChain reads a dump produced by ExportChain from src and trains it into
+// the guild chain in batches, honouring opts' size and branching limits.
+func (r *CacheRepository) ImportChain(ctx context.Context, guildID string, src io.Reader, opts ImportOptions) (*ImportResult, error) {
+	return readChainDump(src, opts, chainDumpSink{
+		clear: func() error {
+			if err := r.ClearGuild(ctx, guildID); err != nil {
+				return fmt.Errorf("clear_guild: %w", err)
+			}
+			return nil
+		},
+		train: func(pairs []string) (bool, error) {
+			limit := SizeLimit{MaxBytes: opts.MaxSizeBytes, Policy: opts.EvictionPolicy}
+			args := append(limit.trainArgs(opts.MaxBranches, 0), pairs...)
+			var written int64
+			err := r.runWriteFCall(ctx, guildID, "train_batch", func(c context.Context) error {
+				var e error
+				written, e = r.doFCall(c, "train_batch", []string{guildID}, args).AsInt64()
+				return e
+			})
+			if err != nil {
+				return false, fmt.Errorf("train_batch: %w", err)
+			}
+			return written == 1, nil
+		},
+		addMedia: func(kind string, urls []string) error {
+			cmds := make([]valkey.Completed, 0, len(urls))
+			for _, url := range urls {
+				cmds = append(cmds, r.buildFCall("add_media", []string{guildID}, kind, url))
+			}
+			err := r.runWriteFCall(ctx, guildID, "add_media_pipeline", func(c context.Context) error {
+				for _, resp := range r.rdb.DoMulti(c, cmds...) {
+					if err := resp.Error(); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("add_media: %w", err)
+			}
+			return nil
+		},
+		countMessages: func(n int64) (bool, error) {
+			limit := SizeLimit{MaxBytes: opts.MaxSizeBytes, Policy: opts.EvictionPolicy}
+			var written int64
+			err := r.runWriteFCall(ctx, guildID, "train_batch", func(c context.Context) error {
+				var e error
+				written, e = r.doFCall(c, "train_batch", []string{guildID}, limit.trainArgs(opts.MaxBranches, int(n))).AsInt64()
+				return e
+			})
+			if err != nil {
+				return false, fmt.Errorf("train_batch: %w", err)
+			}
+			return written == 1, nil
+		},
+	})
+}
+
+// parseCursorRows decodes the {next_cursor, {{...}, ...}} shape returned by
+// export_states_batch.
+func parseCursorRows(raw []valkey.ValkeyMessage) (cursor string, rows [][]string, err error) {
+	if len(raw) < 2 {
+		return "", nil, fmt.Errorf("unexpected response len %d", len(raw))
+	}
+	cursor, err = raw[0].ToString()
+	if err != nil {
+		return "", nil, fmt.Errorf("cursor: %w", err)
+	}
+	items, err := raw[1].ToArray()
+	if err != nil {
+		return "", nil, fmt.Errorf("rows: %w", err)
+	}
+	rows = make([][]string, 0, len(items))
+	for _, item := range items {
+		row, err := item.AsStrSlice()
+		if err != nil {
+			return "", nil, fmt.Errorf("row: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	return cursor, rows, nil
+}
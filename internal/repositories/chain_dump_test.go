@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// dumpContent decodes a dump into its header version and its state and
+// media records, in a stable order. The chain ID and export time are left
+// out so dumps of different chains compare equal.
+func dumpContent(t *testing.T, dump []byte) (version int, records []string) {
+	t.Helper()
+	sc := bufio.NewScanner(bytes.NewReader(dump))
+	for sc.Scan() {
+		var rec chainDumpRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("decode dump record %q: %v", sc.Text(), err)
+		}
+		switch rec.Type {
+		case dumpRecordHeader:
+			version = rec.Version
+		case dumpRecordState:
+			records = append(records, fmt.Sprintf("state %q %v", rec.Prefix, rec.Next))
+		case dumpRecordMedia:
+			slices.Sort(rec.URLs)
+			records = append(records, fmt.Sprintf("media %s %q", rec.Kind, rec.URLs))
+		case dumpRecordStats, dumpRecordEnd:
+			records = append(records, string(sc.Bytes()))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("scan dump: %v", err)
+	}
+	slices.Sort(records)
+	return version, records
+}
+
+func TestChainStoreDumpRoundTrip(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		src := testGuild(t, s)
+		messages := []string{"the cat sat on the mat", "the cat ran off", "a dog sat"}
+		if err := s.TrainBatch(ctx, src, messages, 3, SizeLimit{}, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+			t.Fatalf("TrainBatch: %v", err)
+		}
+		if err := s.AddMedia(ctx, src, "https://example.com/a.gif"); err != nil {
+			t.Fatalf("AddMedia: %v", err)
+		}
+
+		var exported bytes.Buffer
+		if err := s.ExportChain(ctx, src, &ChainConfig{NGramSize: 3}, &exported); err != nil {
+			t.Fatalf("ExportChain: %v", err)
+		}
+		dst := testGuild(t, s)
+		res, err := s.ImportChain(ctx, dst, bytes.NewReader(exported.Bytes()), ImportOptions{Replace: true})
+		if err != nil {
+			t.Fatalf("ImportChain: %v", err)
+		}
+		if res.Truncated || res.Messages != int64(len(messages)) || res.Media != 1 {
+			t.Errorf("import result = %+v, want %d messages and 1 media, not truncated", res, len(messages))
+		}
+
+		var reexported bytes.Buffer
+		if err := s.ExportChain(ctx, dst, nil, &reexported); err != nil {
+			t.Fatalf("ExportChain: %v", err)
+		}
+		version, want := dumpContent(t, exported.Bytes())
+		if version != ChainDumpVersion {
+			t.Errorf("dump version = %d, want %d", version, ChainDumpVersion)
+		}
+		if _, got := dumpContent(t, reexported.Bytes()); !slices.Equal(got, want) {
+			t.Errorf("re-exported dump = %q, want %q", got, want)
+		}
+		if got, want := stats(t, s, dst), stats(t, s, src); got.Prefixes != want.Prefixes || got.Messages != want.Messages {
+			t.Errorf("imported stats = %+v, want %+v", got, want)
+		}
+		return want
+	})
+}
+
+func TestChainStoreImportTruncatedBySizeLimit(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		src := testGuild(t, s)
+		messages := make([]string, 50)
+		for i := range messages {
+			messages[i] = fmt.Sprintf("w%d says n%d", i, i)
+		}
+		if err := s.TrainBatch(ctx, src, messages, 2, SizeLimit{}, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+			t.Fatalf("TrainBatch: %v", err)
+		}
+		var dump bytes.Buffer
+		if err := s.ExportChain(ctx, src, nil, &dump); err != nil {
+			t.Fatalf("ExportChain: %v", err)
+		}
+
+		const maxBytes = 2048
+		dst := testGuild(t, s)
+		res, err := s.ImportChain(ctx, dst, &dump, ImportOptions{Replace: true, MaxSizeBytes: maxBytes})
+		if err != nil {
+			t.Fatalf("ImportChain: %v", err)
+		}
+		got := stats(t, s, dst)
+		if !res.Truncated || got.Messages != 0 {
+			t.Errorf("import = %+v with %d messages, want truncated without messages", res, got.Messages)
+		}
+		// The limit is checked before every pair, so the import stops within
+		// one pair of it; every pair here has weight 1.
+		if got.Bytes > maxBytes+512 {
+			t.Errorf("imported %d bytes, limit %d", got.Bytes, maxBytes)
+		}
+		// Where the import stops depends on the export order, which the
+		// stores don't share.
+		return []any{res.Truncated, got.Messages}
+	})
+}
+
+func TestChainStoreReplaceWithEmptyDump(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		var empty bytes.Buffer
+		if err := s.ExportChain(ctx, testGuild(t, s), nil, &empty); err != nil {
+			t.Fatalf("ExportChain: %v", err)
+		}
+		dst := testGuild(t, s)
+		if err := s.TrainBatch(ctx, dst, []string{"the cat sat on the mat"}, 2, SizeLimit{}, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+			t.Fatalf("TrainBatch: %v", err)
+		}
+		before := stats(t, s, dst)
+
+		_, err := s.ImportChain(ctx, dst, bytes.NewReader(empty.Bytes()), ImportOptions{Replace: true})
+		if !errors.Is(err, ErrEmptyChainDump) {
+			t.Fatalf("ImportChain error = %v, want ErrEmptyChainDump", err)
+		}
+		if got := stats(t, s, dst); got != before {
+			t.Errorf("stats after refused import = %+v, want %+v", got, before)
+		}
+
+		if _, err := s.ImportChain(ctx, dst, bytes.NewReader(empty.Bytes()), ImportOptions{Replace: true, AllowEmpty: true}); err != nil {
+			t.Fatalf("ImportChain with AllowEmpty: %v", err)
+		}
+		after := stats(t, s, dst)
+		if after.Prefixes != 0 || after.Messages != 0 {
+			t.Errorf("stats after forced import = %+v, want an empty chain", after)
+		}
+		return []int64{before.Prefixes, before.Messages, after.Prefixes, after.Messages}
+	})
+}
+
+func TestReadChainDumpVersion(t *testing.T) {
+	tests := []struct {
+		version int
+		wantErr string
+	}{
+		{0, "predates multi-order states"},
+		{1, "predates multi-order states"},
+		{ChainDumpVersion, ""},
+		{ChainDumpVersion + 1, "unsupported chain dump version"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.version), func(t *testing.T) {
+			var dump strings.Builder
+			enc := json.NewEncoder(&dump)
+			for _, rec := range []chainDumpRecord{
+				{Type: dumpRecordHeader, Format: ChainDumpFormat, Version: tt.version},
+				{Type: dumpRecordStats, Messages: 1},
+				{Type: dumpRecordState, Prefix: "a", Next: map[string]int64{"b": 1}},
+				{Type: dumpRecordEnd, States: 1},
+			} {
+				if err := enc.Encode(rec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := NewMemoryStore().ImportChain(context.Background(), "g", strings.NewReader(dump.String()), ImportOptions{})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("ImportChain: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("ImportChain error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
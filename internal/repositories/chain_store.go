@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ChainStore holds the Markov chains, media sets and transient guild flags.
+// CacheRepository is the production store, backed by the cache service and
+// cache_markov.lua; MemoryStore is an in-process store with the same
+// semantics for single-node development and tests.
+type ChainStore interface {
+	// Training
+	Train(ctx context.Context, guildID, message string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error
+	TrainBatch(ctx context.Context, guildID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error
+	TrainChannelBatch(ctx context.Context, guildID, channelID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error
+	TrainAuthorBatch(ctx context.Context, guildID, userID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error
+	TrainLanguageBatch(ctx context.Context, guildID, lang string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error
+	Delete(ctx context.Context, guildID, message string, nGramSize int, tok Tokenizer) error
+	ClearGuild(ctx context.Context, guildID string) error
+	ClearChannelChains(ctx context.Context, guildID string) error
+	ClearLanguageChains(ctx context.Context, guildID string) error
+	DropAuthorChain(ctx context.Context, guildID, userID string) error
+	SubChains(ctx context.Context, guildID string) ([]string, error)
+
+	// Generation
+	Generate(ctx context.Context, guildID string, maxLength int, sampling Sampling) (string, error)
+	GenerateFiltered(ctx context.Context, guildID string, maxLength int, sampling Sampling) (string, error)
+	GenerateFromSeed(ctx context.Context, guildID, seed string, maxLength int, sampling Sampling, tok Tokenizer) (string, error)
+	GenerateRhyme(ctx context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error)
+	GenerateRhymeFiltered(ctx context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error)
+	GenerateCrossover(ctx context.Context, guildIDs []string, weights []float64, maxLength int, sampling Sampling) (string, error)
+	GenerateConstrained(ctx context.Context, guildID string, c Constraints, sampling Sampling, tok Tokenizer) (string, error)
+
+	// Stats and maintenance
+	GetStats(ctx context.Context, guildID string) (uniquePrefixes, messageCount int64, estimatedBytes uint64, err error)
+	GetGuildSize(ctx context.Context, guildID string) (uint64, error)
+	GetEvictions(ctx context.Context, guildID string) (int64, error)
+	ReconcileBytes(ctx context.Context, guildID string) (uint64, error)
+	CapBranching(ctx context.Context, guildID string, maxBranches int) (removed int64, err error)
+	Decay(ctx context.Context, guildID string, factor float64) (removed int64, err error)
+	AnalyzeChain(ctx context.Context, guildID string, topN int) (*ChainAnalysis, error)
+	GetChainAnalysis(ctx context.Context, guildID string) (*ChainAnalysis, error)
+
+	// Media
+	AddMedia(ctx context.Context, guildID, url string) error
+	RemoveMedia(ctx context.Context, guildID, kind, url string) error
+	GetRandomMedia(ctx context.Context, guildID, kind string) (string, error)
+	GetMediaCounts(ctx context.Context, guildID string) (gifs, images, videos int64, err error)
+
+	// Flags
+	SetFetching(ctx context.Context, guildID string) error
+	ClearFetching(ctx context.Context, guildID string) error
+	IsFetching(ctx context.Context, guildID string) (bool, error)
+	SetJackboxState(ctx context.Context, guildID, appTag string) error
+	ClearJackboxState(ctx context.Context, guildID string) error
+	GetJackboxState(ctx context.Context, guildID string) (string, error)
+
+	// Conversations
+	GetConversation(ctx context.Context, guildID, channelID string) (turns int64, history []string, err error)
+	PushConversation(ctx context.Context, guildID, channelID string, ttl time.Duration, keep int, entries ...string) (turns int64, err error)
+
+	// Novelty index
+	IndexNovelty(ctx context.Context, guildID string, messages []string, runLength int, tok Tokenizer) error
+	UnindexNovelty(ctx context.Context, guildID, message string, runLength int, tok Tokenizer) error
+	FindCopiedRun(ctx context.Context, guildID, text string, runLength int, tok Tokenizer) (int, error)
+	ClearNovelty(ctx context.Context, guildID string) error
+
+	// Rhyme index
+	IndexRhymes(ctx context.Context, guildID string, messages []string, lang string, tok Tokenizer) error
+	UnindexRhymes(ctx context.Context, guildID, message, lang string, tok Tokenizer) error
+	ReindexRhymes(ctx context.Context, guildID, lang string) error
+
+	// Keyword index
+	IndexKeywords(ctx context.Context, guildID string, messages []string, tok Tokenizer) error
+	UnindexKeywords(ctx context.Context, guildID, message string, tok Tokenizer) error
+	ReindexKeywords(ctx context.Context, guildID string) error
+	PickKeywords(ctx context.Context, guildID, text string, limit int, tok Tokenizer) ([]string, error)
+
+	// Portability
+	ExportChain(ctx context.Context, guildID string, cfg *ChainConfig, w io.Writer) error
+	ImportChain(ctx context.Context, guildID string, src io.Reader, opts ImportOptions) (*ImportResult, error)
+}
+
+var (
+	_ ChainStore = (*CacheRepository)(nil)
+	_ ChainStore = (*MemoryStore)(nil)
+)
@@ -0,0 +1,352 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// testCacheURLEnv names the cache service the Lua store tests run against
+// (make test-cache starts one). Without it only MemoryStore is tested, and
+// the run says so.
+const testCacheURLEnv = "TEST_CACHE_URL"
+
+var testGuildSeq atomic.Int64
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testCacheURLEnv) == "" {
+		fmt.Fprintf(os.Stderr, "WARNING: %s is not set: the Lua store is skipped and NOT compared with MemoryStore\n", testCacheURLEnv)
+	}
+	os.Exit(m.Run())
+}
+
+// testStores returns the stores every scenario runs on: MemoryStore always,
+// and CacheRepository when testCacheURLEnv points at a cache service (nil
+// otherwise, so the scenario shows up as skipped).
+func testStores(t *testing.T) map[string]ChainStore {
+	t.Helper()
+	stores := map[string]ChainStore{"memory": NewMemoryStore(), "lua": nil}
+	url := os.Getenv(testCacheURLEnv)
+	if url == "" {
+		return stores
+	}
+	opt, err := valkey.ParseURL(url)
+	if err != nil {
+		t.Fatalf("parse %s: %v", testCacheURLEnv, err)
+	}
+	rdb, err := valkey.NewClient(opt)
+	if err != nil {
+		t.Fatalf("connect to %s: %v", url, err)
+	}
+	t.Cleanup(rdb.Close)
+	if err := EnsureLibrary(context.Background(), rdb, true); err != nil {
+		t.Fatalf("load cache library: %v", err)
+	}
+	stores["lua"] = NewCacheRepository(rdb)
+	return stores
+}
+
+// testGuild returns a guild ID no other test uses, wiped when the test ends.
+// The IDs all have the same length, since key names count towards the byte
+// estimates the stores are compared on.
+func testGuild(t *testing.T, s ChainStore) string {
+	t.Helper()
+	id := fmt.Sprintf("test-%d-%06d", time.Now().UnixNano(), testGuildSeq.Add(1))
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_ = s.ClearGuild(ctx, id)
+		_ = s.ClearNovelty(ctx, id)
+	})
+	return id
+}
+
+// runOnStores runs scenario on every store and fails when the stores
+// disagree on its result.
+func runOnStores(t *testing.T, scenario func(t *testing.T, s ChainStore) any) {
+	t.Helper()
+	results := map[string]any{}
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if s == nil {
+				t.Skipf("%s not set", testCacheURLEnv)
+			}
+			results[name] = scenario(t, s)
+		})
+	}
+	if got, want := results["lua"], results["memory"]; got != nil && !reflect.DeepEqual(got, want) {
+		t.Errorf("stores disagree: lua = %+v, memory = %+v", got, want)
+	}
+}
+
+type storeStats struct {
+	Prefixes, Messages int64
+	Bytes              uint64
+}
+
+func stats(t *testing.T, s ChainStore, guildID string) storeStats {
+	t.Helper()
+	prefixes, messages, size, err := s.GetStats(context.Background(), guildID)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	return storeStats{prefixes, messages, size}
+}
+
+func TestChainStoreTrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []string
+		nGramSize int
+		tokenizer string
+	}{
+		{"bigrams", []string{"the cat sat", "the cat ran", "a dog sat"}, 2, TokenizerWhitespace},
+		{"trigrams", []string{"the cat sat on the mat", "the cat ran off"}, 3, TokenizerWhitespace},
+		{"punct", []string{"hello, world!", "hello there."}, 2, TokenizerPunct},
+		{"cjk", []string{"我喜欢猫", "我喜欢狗"}, 2, TokenizerCJK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runOnStores(t, func(t *testing.T, s ChainStore) any {
+				ctx := context.Background()
+				g := testGuild(t, s)
+				if err := s.TrainBatch(ctx, g, tt.messages, tt.nGramSize, SizeLimit{}, 0, NewTokenizer(tt.tokenizer)); err != nil {
+					t.Fatalf("TrainBatch: %v", err)
+				}
+				got := stats(t, s, g)
+				if got.Messages != int64(len(tt.messages)) {
+					t.Errorf("messages = %d, want %d", got.Messages, len(tt.messages))
+				}
+				if got.Prefixes == 0 || got.Bytes == 0 {
+					t.Errorf("stats = %+v, want prefixes and bytes", got)
+				}
+				return got
+			})
+		})
+	}
+}
+
+func TestChainStoreGenerateSinglePath(t *testing.T) {
+	tests := []struct {
+		message   string
+		nGramSize int
+		smoothing float64
+	}{
+		{"one two three four five", 2, 0},
+		{"one two three four five", 3, 0},
+		{"one two three four five", 3, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("n=%d/smoothing=%g", tt.nGramSize, tt.smoothing), func(t *testing.T) {
+			runOnStores(t, func(t *testing.T, s ChainStore) any {
+				ctx := context.Background()
+				g := testGuild(t, s)
+				if err := s.Train(ctx, g, tt.message, tt.nGramSize, SizeLimit{}, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+					t.Fatalf("Train: %v", err)
+				}
+				got, err := s.Generate(ctx, g, 20, Sampling{Smoothing: tt.smoothing})
+				if err != nil {
+					t.Fatalf("Generate: %v", err)
+				}
+				if got != tt.message {
+					t.Errorf("Generate = %q, want %q", got, tt.message)
+				}
+				return got
+			})
+		})
+	}
+}
+
+func TestChainStoreDeleteUndoesTrain(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		tok := NewTokenizer(TokenizerWhitespace)
+		kept, dropped := "the cat sat on the mat", "the dog ran off"
+
+		g := testGuild(t, s)
+		if err := s.TrainBatch(ctx, g, []string{kept, dropped}, 2, SizeLimit{}, 0, tok); err != nil {
+			t.Fatalf("TrainBatch: %v", err)
+		}
+		if err := s.Delete(ctx, g, dropped, 2, tok); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		want := testGuild(t, s)
+		if err := s.Train(ctx, want, kept, 2, SizeLimit{}, 0, tok); err != nil {
+			t.Fatalf("Train: %v", err)
+		}
+		// Deleting leaves the message count alone.
+		got, w := stats(t, s, g), stats(t, s, want)
+		if got.Prefixes != w.Prefixes || got.Bytes != w.Bytes {
+			t.Errorf("stats after delete = %+v, want %+v", got, w)
+		}
+		return got
+	})
+}
+
+func TestChainStoreSizeLimitFreezes(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		g := testGuild(t, s)
+		messages := make([]string, 50)
+		for i := range messages {
+			messages[i] = fmt.Sprintf("w%d says n%d", i, i)
+		}
+		limit := SizeLimit{MaxBytes: 2048, Policy: EvictionFreeze}
+		for _, msg := range messages {
+			if err := s.Train(ctx, g, msg, 2, limit, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+				t.Fatalf("Train: %v", err)
+			}
+		}
+		got := stats(t, s, g)
+		if got.Messages == 0 || got.Messages >= int64(len(messages)) {
+			t.Errorf("messages = %d, want some but not all of %d", got.Messages, len(messages))
+		}
+		return got
+	})
+}
+
+func TestChainStoreCapBranching(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		g := testGuild(t, s)
+		messages := []string{"go left", "go left", "go left", "go right", "go up"}
+		if err := s.TrainBatch(ctx, g, messages, 2, SizeLimit{}, 0, NewTokenizer(TokenizerWhitespace)); err != nil {
+			t.Fatalf("TrainBatch: %v", err)
+		}
+		removed, err := s.CapBranching(ctx, g, 1)
+		if err != nil {
+			t.Fatalf("CapBranching: %v", err)
+		}
+		// "go" loses right and up, and so do the reverse transitions into
+		// the end of sentence marker.
+		if removed != 4 {
+			t.Errorf("removed = %d, want 4", removed)
+		}
+		got, err := s.Generate(ctx, g, 10, Sampling{})
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		if got != "go left" {
+			t.Errorf("Generate = %q, want %q", got, "go left")
+		}
+		return []any{removed, stats(t, s, g)}
+	})
+}
+
+func TestChainStoreConversation(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		g := testGuild(t, s)
+		for i := range 3 {
+			if _, err := s.PushConversation(ctx, g, "chan", time.Minute, 4, fmt.Sprintf("q%d", i), fmt.Sprintf("a%d", i)); err != nil {
+				t.Fatalf("PushConversation: %v", err)
+			}
+		}
+		turns, history, err := s.GetConversation(ctx, g, "chan")
+		if err != nil {
+			t.Fatalf("GetConversation: %v", err)
+		}
+		if want := []string{"q1", "a1", "q2", "a2"}; turns != 3 || !slices.Equal(history, want) {
+			t.Errorf("conversation = %d %q, want 3 %q", turns, history, want)
+		}
+		return []any{turns, history}
+	})
+}
+
+func TestChainStoreMedia(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		g := testGuild(t, s)
+		for _, url := range []string{
+			"https://example.com/a.gif",
+			"https://example.com/b.png",
+			"https://example.com/c.png",
+			"https://example.com/d.mp4",
+		} {
+			if err := s.AddMedia(ctx, g, url); err != nil {
+				t.Fatalf("AddMedia: %v", err)
+			}
+		}
+		gifs, images, videos, err := s.GetMediaCounts(ctx, g)
+		if err != nil {
+			t.Fatalf("GetMediaCounts: %v", err)
+		}
+		if gifs != 1 || images != 2 || videos != 1 {
+			t.Errorf("media counts = %d %d %d, want 1 2 1", gifs, images, videos)
+		}
+		return []int64{gifs, images, videos}
+	})
+}
+
+func TestChainStoreNovelty(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool // a copied run is found
+	}{
+		{"so the quick brown fox jumps high", true},
+		{"the slow brown dog sleeps", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			runOnStores(t, func(t *testing.T, s ChainStore) any {
+				ctx := context.Background()
+				g := testGuild(t, s)
+				tok := NewTokenizer(TokenizerWhitespace)
+				if err := s.IndexNovelty(ctx, g, []string{"the quick brown fox jumps over"}, 4, tok); err != nil {
+					t.Fatalf("IndexNovelty: %v", err)
+				}
+				start, err := s.FindCopiedRun(ctx, g, tt.text, 4, tok)
+				if err != nil {
+					t.Fatalf("FindCopiedRun: %v", err)
+				}
+				if got := start >= 0; got != tt.want {
+					t.Errorf("FindCopiedRun(%q) = %d, want found=%t", tt.text, start, tt.want)
+				}
+				return start
+			})
+		})
+	}
+}
+
+func TestChainStoreSubChains(t *testing.T) {
+	runOnStores(t, func(t *testing.T, s ChainStore) any {
+		ctx := context.Background()
+		g := testGuild(t, s)
+		tok := NewTokenizer(TokenizerWhitespace)
+		messages := []string{"the cat sat", "a dog ran"}
+		limit := SizeLimit{GroupMaxBytes: 1 << 20}
+		for _, err := range []error{
+			s.TrainBatch(ctx, g, messages, 2, SizeLimit{}, 0, tok),
+			s.TrainChannelBatch(ctx, g, "c1", messages, 2, limit, 0, tok),
+			s.TrainLanguageBatch(ctx, g, "en", messages, 2, limit, 0, tok),
+			s.TrainAuthorBatch(ctx, g, "u1", messages, 2, limit, 0, tok),
+			s.TrainAuthorBatch(ctx, g, "u2", messages, 2, limit, 0, tok),
+			s.DropAuthorChain(ctx, g, "u2"),
+		} {
+			if err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+		}
+		ids, err := s.SubChains(ctx, g)
+		if err != nil {
+			t.Fatalf("SubChains: %v", err)
+		}
+		want := []string{LanguageChainID(g, "en"), ChannelChainID(g, "c1"), AuthorChainID(g, "u1")}
+		if !slices.Equal(ids, want) {
+			t.Errorf("SubChains = %q, want %q", ids, want)
+		}
+		// The guild ID differs between stores.
+		rel := make([]string, len(ids))
+		for i, id := range ids {
+			rel[i] = strings.TrimPrefix(id, g)
+		}
+		return rel
+	})
+}
@@ -1,11 +1,16 @@
 package repositories
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"time"
 
+	"rolando/internal/data"
+
 	"github.com/glebarez/sqlite"
 	"github.com/valkey-io/valkey-go"
 	"gorm.io/gorm"
@@ -20,8 +25,21 @@ type ChainConfig struct {
 	ReactionRate      int        `gorm:"default:30"      json:"reaction_rate"`
 	VcJoinRate        int        `gorm:"default:100"     json:"vc_join_rate"`
 	MaxSizeMb         int        `gorm:"default:25" json:"max_size_mb"`
+	EvictionPolicy    string     `gorm:"default:'freeze'" json:"eviction_policy"`
 	NGramSize         int        `gorm:"default:2"  json:"n_gram_size"`
 	MarkovMaxBranches int        `gorm:"default:256"  json:"markov_max_branches"`
+	Temperature       float64    `gorm:"default:1"       json:"temperature"`
+	TopK              int        `gorm:"default:0"       json:"top_k"`
+	TopP              float64    `gorm:"default:1"       json:"top_p"`
+	Smoothing         float64    `gorm:"default:0"       json:"smoothing"`
+	ChainScope        string     `gorm:"default:'guild'" json:"chain_scope"`
+	DecayHalfLifeDays int        `gorm:"default:0"       json:"decay_half_life_days"`
+	DecayedAt         *time.Time `gorm:"default:null"    json:"decayed_at"`
+	NoveltyRunLength  int        `gorm:"default:0"       json:"novelty_run_length"`
+	ConversationTurns int        `gorm:"default:5"       json:"conversation_turns"`
+	Tokenizer         string     `gorm:"default:'whitespace'" json:"tokenizer"`
+	LanguageChains    bool       `gorm:"default:false"   json:"language_chains"`
+	AllowCrossover    bool       `gorm:"default:false"   json:"allow_crossover"`
 	TTSLanguage       string     `gorm:"default:'en'"    json:"tts_language"`
 	Pings             bool       `gorm:"default:true"    json:"pings"`
 	TrainedAt         *time.Time `gorm:"default:null"    json:"trained_at"`
@@ -29,13 +47,75 @@ type ChainConfig struct {
 	Premium           bool       `gorm:"default:false"   json:"premium"`
 }
 
+// Chain scopes: which chain live messages are generated from.
+const (
+	// ChainScopeGuild trains and generates from the guild-wide chain only.
+	ChainScopeGuild = "guild"
+	// ChainScopeChannel additionally keeps one sub-chain per channel and
+	// generates from it first, falling back to the guild chain.
+	ChainScopeChannel = "channel"
+)
+
+// ChannelScoped reports whether per-channel sub-chains are enabled.
+func (c *ChainConfig) ChannelScoped() bool {
+	return c.ChainScope == ChainScopeChannel
+}
+
+// DecayFactor returns the weight multiplier that applies the configured
+// half-life over elapsed, or 1 when decay is disabled.
+func (c *ChainConfig) DecayFactor(elapsed time.Duration) float64 {
+	if c.DecayHalfLifeDays <= 0 || elapsed <= 0 {
+		return 1
+	}
+	halfLife := time.Duration(c.DecayHalfLifeDays) * 24 * time.Hour
+	return math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
+
+// NoveltyGuarded reports whether generated text is checked for runs of
+// NoveltyRunLength tokens copied from a single stored message.
+func (c *ChainConfig) NoveltyGuarded() bool {
+	return c.NoveltyRunLength > 0
+}
+
+// TextTokenizer returns the tokenizer messages are split with for this chain.
+func (c *ChainConfig) TextTokenizer() Tokenizer {
+	return NewTokenizer(c.Tokenizer)
+}
+
+// Language returns the chain's language, one of data.Langs. It follows the
+// TTS language and falls back to English, also when that is automatic.
+func (c *ChainConfig) Language() string {
+	if slices.Contains(data.Langs, c.TTSLanguage) {
+		return c.TTSLanguage
+	}
+	return "en"
+}
+
+// AutoLanguage reports whether voice chat picks its language per utterance
+// instead of using a fixed TTS language.
+func (c *ChainConfig) AutoLanguage() bool {
+	return c.TTSLanguage == data.LangAuto
+}
+
 // MaxSizeBytes returns the configured size limit in bytes (0 = unlimited).
 func (c *ChainConfig) MaxSizeBytes() int {
 	return c.MaxSizeMb * 1024 * 1024
 }
 
+// SizeLimit returns the size limit training honours, with the eviction
+// policy applied once the chain reaches it.
+func (c *ChainConfig) SizeLimit() SizeLimit {
+	return SizeLimit{MaxBytes: c.MaxSizeBytes(), Policy: c.EvictionPolicy}
+}
+
+// Sampling returns the generation "chaos" settings for this chain.
+func (c *ChainConfig) Sampling() Sampling {
+	return Sampling{Temperature: c.Temperature, TopK: c.TopK, TopP: c.TopP, Smoothing: c.Smoothing}
+}
+
 // ChainsRepository persists ChainConfig in SQLite and caches it in the cache service.
 // Cache is always tried first; SQLite is the source of truth for durability.
+// A nil cache client (in-memory chain store) disables config caching.
 type ChainsRepository struct {
 	DB  *gorm.DB
 	rdb valkey.Client
@@ -64,6 +144,10 @@ func (repo *ChainsRepository) CreateChain(id, name string) (*ChainConfig, error)
 		Pings:       true,
 		MaxSizeMb:   25,
 		TTSLanguage: "en",
+		Temperature: 1,
+		TopP:        1,
+		ChainScope:  ChainScopeGuild,
+		Tokenizer:   TokenizerWhitespace,
 	}
 	if err := repo.DB.Create(chain).Error; err != nil {
 		return nil, err
@@ -124,6 +208,37 @@ func (repo *ChainsRepository) UpdateChain(id string, fields map[string]any) (*Ch
 	return &chain, nil
 }
 
+// AcceptDumpConfig checks a chain dump's config against the target chain
+// before import. Merging requires the same n-gram size and tokenizer;
+// replacing adopts the dump's directly, without the rebuild UpdateChainMeta
+// would start.
+func (repo *ChainsRepository) AcceptDumpConfig(target, dumped *ChainConfig, replace bool) error {
+	if dumped == nil {
+		return nil
+	}
+	fields := map[string]any{}
+	if dumped.NGramSize > 0 && dumped.NGramSize != target.NGramSize {
+		if !replace {
+			return fmt.Errorf("dump uses n_gram_size %d but chain uses %d; import with replace instead", dumped.NGramSize, target.NGramSize)
+		}
+		fields["n_gram_size"] = dumped.NGramSize
+	}
+	// Dumps from before tokenizers were selectable have none and were
+	// whitespace-split.
+	dumpedTokenizer := cmp.Or(dumped.Tokenizer, TokenizerWhitespace)
+	if IsTokenizer(dumpedTokenizer) && dumpedTokenizer != cmp.Or(target.Tokenizer, TokenizerWhitespace) {
+		if !replace {
+			return fmt.Errorf("dump uses tokenizer %q but chain uses %q; import with replace instead", dumpedTokenizer, target.Tokenizer)
+		}
+		fields["tokenizer"] = dumpedTokenizer
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	_, err := repo.UpdateChain(target.ID, fields)
+	return err
+}
+
 // DeleteChain removes the chain from SQLite and evicts the cache entry.
 func (repo *ChainsRepository) DeleteChain(id string) error {
 	if err := repo.DB.Delete(&ChainConfig{}, "id = ?", id).Error; err != nil {
@@ -155,7 +270,16 @@ func (repo *ChainsRepository) CountChains() (int64, error) {
 
 const configCacheTTL = 0 // no TTL — cache is invalidated explicitly on writes
 
+// ConfigKey is the cache hash holding a chain's config, shared with the Lua
+// library (config_key).
+func ConfigKey(id string) string {
+	return "config:" + ChainKey(id)
+}
+
 func (repo *ChainsRepository) warmCache(ctx context.Context, c *ChainConfig) {
+	if repo.rdb == nil {
+		return
+	}
 	args := chainConfigToArgs(c)
 	if len(args) == 0 {
 		return
@@ -164,18 +288,24 @@ func (repo *ChainsRepository) warmCache(ctx context.Context, c *ChainConfig) {
 	for i, v := range args {
 		sargs[i] = fmt.Sprint(v)
 	}
-	key := "config:" + c.ID
+	key := ConfigKey(c.ID)
 	cmd := repo.rdb.B().Arbitrary("HSET").Keys(key).Args(sargs...).Build()
 	_ = repo.rdb.Do(ctx, cmd).Error()
 }
 
 func (repo *ChainsRepository) evictCache(ctx context.Context, id string) {
-	cmd := repo.rdb.B().Del().Key("config:" + id).Build()
+	if repo.rdb == nil {
+		return
+	}
+	cmd := repo.rdb.B().Del().Key(ConfigKey(id)).Build()
 	_ = repo.rdb.Do(ctx, cmd).Error()
 }
 
 func (repo *ChainsRepository) getFromCache(ctx context.Context, id string) (*ChainConfig, error) {
-	cmd := repo.rdb.B().Hgetall().Key("config:" + id).Build()
+	if repo.rdb == nil {
+		return nil, fmt.Errorf("cache miss")
+	}
+	cmd := repo.rdb.B().Hgetall().Key(ConfigKey(id)).Build()
 	vals, err := repo.rdb.Do(ctx, cmd).AsStrMap()
 	if err != nil || len(vals) == 0 {
 		return nil, fmt.Errorf("cache miss")
@@ -192,6 +322,10 @@ func chainConfigToArgs(c *ChainConfig) []any {
 	if c.TrainedAt != nil {
 		trainedAt = c.TrainedAt.UTC().Format(time.RFC3339)
 	}
+	decayedAt := ""
+	if c.DecayedAt != nil {
+		decayedAt = c.DecayedAt.UTC().Format(time.RFC3339)
+	}
 	pings := "0"
 	if c.Pings {
 		pings = "1"
@@ -200,6 +334,14 @@ func chainConfigToArgs(c *ChainConfig) []any {
 	if c.Premium {
 		premium = "1"
 	}
+	languageChains := "0"
+	if c.LanguageChains {
+		languageChains = "1"
+	}
+	allowCrossover := "0"
+	if c.AllowCrossover {
+		allowCrossover = "1"
+	}
 	return []any{
 		"id", c.ID,
 		"name", c.Name,
@@ -207,8 +349,21 @@ func chainConfigToArgs(c *ChainConfig) []any {
 		"reaction_rate", strconv.Itoa(c.ReactionRate),
 		"vc_join_rate", strconv.Itoa(c.VcJoinRate),
 		"max_size_mb", strconv.Itoa(c.MaxSizeMb),
+		"eviction_policy", c.EvictionPolicy,
 		"n_gram_size", strconv.Itoa(c.NGramSize),
 		"markov_max_branches", strconv.Itoa(c.MarkovMaxBranches),
+		"temperature", strconv.FormatFloat(c.Temperature, 'f', -1, 64),
+		"top_k", strconv.Itoa(c.TopK),
+		"top_p", strconv.FormatFloat(c.TopP, 'f', -1, 64),
+		"smoothing", strconv.FormatFloat(c.Smoothing, 'f', -1, 64),
+		"chain_scope", c.ChainScope,
+		"decay_half_life_days", strconv.Itoa(c.DecayHalfLifeDays),
+		"decayed_at", decayedAt,
+		"novelty_run_length", strconv.Itoa(c.NoveltyRunLength),
+		"conversation_turns", strconv.Itoa(c.ConversationTurns),
+		"tokenizer", c.Tokenizer,
+		"language_chains", languageChains,
+		"allow_crossover", allowCrossover,
 		"tts_language", c.TTSLanguage,
 		"pings", pings,
 		"trained_at", trainedAt,
@@ -224,6 +379,18 @@ func chainConfigFromMap(m map[string]string) (*ChainConfig, error) {
 	c.ID = m["id"]
 	c.Name = m["name"]
 	c.TTSLanguage = m["tts_language"]
+	c.ChainScope = m["chain_scope"]
+	if c.ChainScope == "" {
+		c.ChainScope = ChainScopeGuild
+	}
+	c.Tokenizer = m["tokenizer"]
+	if c.Tokenizer == "" {
+		c.Tokenizer = TokenizerWhitespace
+	}
+	c.EvictionPolicy = m["eviction_policy"]
+	if c.EvictionPolicy == "" {
+		c.EvictionPolicy = EvictionFreeze
+	}
 
 	if c.ReplyRate, err = strconv.Atoi(m["reply_rate"]); err != nil {
 		return nil, fmt.Errorf("reply_rate: %w", err)
@@ -245,9 +412,52 @@ func chainConfigFromMap(m map[string]string) (*ChainConfig, error) {
 			return nil, fmt.Errorf("markov_max_branches: %w", err)
 		}
 	}
+	c.Temperature, c.TopP = 1, 1
+	if s := m["temperature"]; s != "" {
+		if c.Temperature, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("temperature: %w", err)
+		}
+	}
+	if s := m["top_k"]; s != "" {
+		if c.TopK, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("top_k: %w", err)
+		}
+	}
+	if s := m["top_p"]; s != "" {
+		if c.TopP, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("top_p: %w", err)
+		}
+	}
+	if s := m["smoothing"]; s != "" {
+		if c.Smoothing, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("smoothing: %w", err)
+		}
+	}
+
+	if s := m["decay_half_life_days"]; s != "" {
+		if c.DecayHalfLifeDays, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("decay_half_life_days: %w", err)
+		}
+	}
+
+	if s := m["novelty_run_length"]; s != "" {
+		if c.NoveltyRunLength, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("novelty_run_length: %w", err)
+		}
+	}
+	// Configs cached before conversations existed have no conversation_turns;
+	// they get the column default rather than conversations switched off.
+	c.ConversationTurns = 5
+	if s := m["conversation_turns"]; s != "" {
+		if c.ConversationTurns, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("conversation_turns: %w", err)
+		}
+	}
 
 	c.Pings = m["pings"] == "1"
 	c.Premium = m["premium"] == "1"
+	c.LanguageChains = m["language_chains"] == "1"
+	c.AllowCrossover = m["allow_crossover"] == "1"
 
 	if s := m["trained_at"]; s != "" {
 		t, err := time.Parse(time.RFC3339, s)
@@ -256,6 +466,13 @@ func chainConfigFromMap(m map[string]string) (*ChainConfig, error) {
 		}
 		c.TrainedAt = &t
 	}
+	if s := m["decayed_at"]; s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("decayed_at: %w", err)
+		}
+		c.DecayedAt = &t
+	}
 	if s := m["updated_at"]; s != "" {
 		t, err := time.Parse(time.RFC3339, s)
 		if err != nil {
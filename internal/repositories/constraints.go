@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Constraints bound constrained generation. Zero values leave a bound off.
+type Constraints struct {
+	MinWords int
+	MaxWords int
+	MaxChars int
+	// Required words must all appear in the output, Banned words never.
+	Required []string
+	Banned   []string
+	// EndOnSentence only accepts output ending on a sentence end the chain
+	// learned, instead of one cut at the word or character budget.
+	EndOnSentence bool
+	// Filtered strips URLs, pings and noisy characters like GenerateFiltered
+	// before the output is checked.
+	Filtered bool
+}
+
+// constrainedAttempts is how many start prefixes GenerateConstrained tries.
+const constrainedAttempts = 4
+
+// isWordToken must match is_word_token in cache_markov.lua: a token holding
+// an ASCII letter or digit, or any non-ASCII character.
+func isWordToken(token string) bool {
+	return strings.IndexFunc(token, func(r rune) bool {
+		return r >= utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+// wordTokens tokenizes words like training text, keeping the word tokens.
+func wordTokens(words []string, tok Tokenizer) []string {
+	var out []string
+	for _, w := range words {
+		for _, t := range tok.Tokenize(w) {
+			if !isMarker(t) && isWordToken(t) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// args encodes the constraints for generate_constrained after the start prefix.
+func (c Constraints) args(required, banned []string, sampling Sampling) []any {
+	endOnSentence := 0
+	if c.EndOnSentence {
+		endOnSentence = 1
+	}
+	args := []any{c.MinWords, c.MaxWords, c.MaxChars, endOnSentence}
+	args = append(args, sampling.args()...)
+	args = append(args, len(required))
+	for _, t := range required {
+		args = append(args, t)
+	}
+	for _, t := range banned {
+		args = append(args, t)
+	}
+	return args
+}
+
+// accepts re-checks generated text against the constraints, since filtering
+// may have dropped tokens after generation.
+func (c Constraints) accepts(text string, required, banned []string) bool {
+	tokens := strings.Fields(text)
+	words := 0
+	seen := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		if isWordToken(t) {
+			words++
+		}
+		seen[t] = true
+	}
+	if words == 0 || words < c.MinWords || (c.MaxWords > 0 && words > c.MaxWords) {
+		return false
+	}
+	if c.MaxChars > 0 && utf8.RuneCountInString(text) > c.MaxChars {
+		return false
+	}
+	for _, t := range required {
+		if !seen[t] {
+			return false
+		}
+	}
+	for _, t := range banned {
+		if seen[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// constrainedSeed picks the find_prefix seed for an attempt: with required
+// words, every other attempt starts from a prefix containing one of them.
+func constrainedSeed(required []string, attempt int) string {
+	if len(required) == 0 || attempt%2 == 1 {
+		return ""
+	}
+	return required[rand.IntN(len(required))]
+}
+
+// GenerateConstrained generates text satisfying c. The Lua side enforces the
+// constraints while sampling and backtracks out of dead ends; a few start
+// prefixes are tried before giving up with "". Words are tokenized like
+// training text, and the output is space-joined tokens like Generate's.
+func (r *CacheRepository) GenerateConstrained(ctx context.Context, guildID string, c Constraints, sampling Sampling, tok Tokenizer) (string, error) {
+	required, banned := wordTokens(c.Required, tok), wordTokens(c.Banned, tok)
+	for attempt := range constrainedAttempts {
+		var prefix string
+		err := r.runWithCacheReadRetry(ctx, guildID, "find_prefix", func(cctx context.Context) error {
+			var e error
+			prefix, e = r.fcallString(cctx, "find_prefix", []string{guildID}, constrainedSeed(required, attempt))
+			return e
+		})
+		if err != nil || prefix == "" {
+			return "", err
+		}
+
+		args := append([]any{prefix}, c.args(required, banned, sampling)...)
+		var out string
+		err = r.runWithCacheReadRetry(ctx, guildID, "generate_constrained", func(cctx context.Context) error {
+			var e error
+			out, e = r.fcallString(cctx, "generate_constrained", []string{guildID}, args...)
+			return e
+		})
+		if err != nil {
+			return "", fmt.Errorf("generate_constrained: %w", err)
+		}
+		if c.Filtered {
+			out = FilterText(out, false)
+		}
+		if c.accepts(out, required, banned) {
+			return out, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// A conversation is the latest back-and-forth between members and the bot in
+// one channel: the messages exchanged, oldest first, and how many times the
+// bot answered. It lives under the channel sub-chain's id and is forgotten
+// once idle for the TTL given when it was last pushed to.
+
+// GetConversation returns how many times the bot answered in the channel's
+// conversation and its remembered messages, oldest first. Both are empty
+// when there is no conversation going on.
+func (r *CacheRepository) GetConversation(ctx context.Context, guildID, channelID string) (turns int64, history []string, err error) {
+	id := ChannelChainID(guildID, channelID)
+	err = r.runWithCacheReadRetry(ctx, id, "conversation_get", func(c context.Context) error {
+		raw, e := r.fcallArray(c, "conversation_get", []string{id})
+		if e != nil {
+			return e
+		}
+		if len(raw) == 0 {
+			return fmt.Errorf("unexpected response len %d", len(raw))
+		}
+		if turns, e = raw[0].AsInt64(); e != nil {
+			return e
+		}
+		history = make([]string, 0, len(raw)-1)
+		for _, msg := range raw[1:] {
+			entry, e := msg.ToString()
+			if e != nil {
+				return e
+			}
+			history = append(history, entry)
+		}
+		return nil
+	})
+	return turns, history, err
+}
+
+// PushConversation appends entries to the channel's conversation, keeping the
+// latest keep, and counts one answer from the bot. The conversation expires
+// after ttl without a push. Returns the number of answers so far.
+func (r *CacheRepository) PushConversation(ctx context.Context, guildID, channelID string, ttl time.Duration, keep int, entries ...string) (int64, error) {
+	id := ChannelChainID(guildID, channelID)
+	args := make([]string, 0, 2+len(entries))
+	args = append(args, strconv.Itoa(max(1, int(ttl.Seconds()))), strconv.Itoa(keep))
+	args = append(args, entries...)
+	var turns int64
+	err := r.runWriteFCall(ctx, id, "conversation_push", func(c context.Context) error {
+		var e error
+		turns, e = r.doFCall(c, "conversation_push", []string{id}, args).AsInt64()
+		return e
+	})
+	return turns, err
+}
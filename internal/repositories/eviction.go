@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"rolando/internal/logger"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Eviction policies: what training does once a chain reaches its size limit.
+const (
+	// EvictionFreeze stops training; the chain keeps what it learned so far.
+	EvictionFreeze = "freeze"
+	// EvictionLeastUsed evicts the prefixes with the lowest total weight.
+	EvictionLeastUsed = "least_used"
+	// EvictionOldest evicts the prefixes that went the longest without being
+	// trained. Their training times are kept in an age index while the
+	// policy is selected.
+	EvictionOldest = "oldest"
+)
+
+// IsEvictionPolicy reports whether name is a known eviction policy.
+func IsEvictionPolicy(name string) bool {
+	switch name {
+	case EvictionFreeze, EvictionLeastUsed, EvictionOldest:
+		return true
+	}
+	return false
+}
+
+// EvictionLowWater is the share of the size limit an eviction pass brings a
+// chain back under, leaving room to train before the next pass.
+const EvictionLowWater = 0.8
+
+// SizeLimit caps a chain's estimated size and picks what training does once
+// the chain reaches it.
+type SizeLimit struct {
+	MaxBytes int    // 0 = unlimited
+	Policy   string // one of the eviction policies, freeze when empty
+	// GroupMaxBytes caps the summed size of the guild's author, channel, or
+	// language sub-chains when training one of them (0 = unlimited). Reaching it freezes the
+	// whole group: eviction only ever frees room in the chain being trained.
+	GroupMaxBytes int
+}
+
+// evicts reports whether reaching the limit starts an eviction pass.
+func (l SizeLimit) evicts() bool {
+	return l.MaxBytes > 0 && (l.Policy == EvictionLeastUsed || l.Policy == EvictionOldest)
+}
+
+func (l SizeLimit) lowWater() int64 {
+	return int64(float64(l.MaxBytes) * EvictionLowWater)
+}
+
+// trackAgesArg is train_batch's track_ages argument for an eviction policy.
+func trackAgesArg(policy string) string {
+	if policy == EvictionOldest {
+		return "1"
+	}
+	return "0"
+}
+
+// trainArgs returns the leading train_batch arguments, before the pairs.
+func (l SizeLimit) trainArgs(maxBranches, messageCount int) []string {
+	return []string{strconv.Itoa(l.MaxBytes), strconv.Itoa(maxBranches), strconv.Itoa(messageCount), trackAgesArg(l.Policy),
+		strconv.Itoa(l.GroupMaxBytes)}
+}
+
+// trainOrEvict sends one train_batch call. When the chain is already at its
+// size limit and the limit evicts, an eviction pass makes room and the batch
+// is retried once. Training that arrives while the guild is being evicted is
+// dropped, as with the freeze policy.
+func (r *CacheRepository) trainOrEvict(ctx context.Context, guildID string, args []string, limit SizeLimit) error {
+	train := func() (int64, error) {
+		var written int64
+		err := r.runWriteFCall(ctx, guildID, "train_batch", func(c context.Context) error {
+			var e error
+			written, e = r.doFCall(c, "train_batch", []string{guildID}, args).AsInt64()
+			return e
+		})
+		return written, err
+	}
+
+	written, err := train()
+	if err != nil || written != 0 || !limit.evicts() {
+		return err
+	}
+	if _, running := r.evicting.LoadOrStore(guildID, struct{}{}); running {
+		return nil
+	}
+	defer r.evicting.Delete(guildID)
+
+	evicted, err := r.evict(ctx, guildID, limit)
+	if err != nil {
+		return fmt.Errorf("evict_batch: %w", err)
+	}
+	logger.Infof("Evicted %d states (%s) from %s to make room for training", evicted, limit.Policy, guildID)
+	_, err = train()
+	return err
+}
+
+// evict drives the paginated evict_batch Lua function until the chain is
+// under the limit's low-water mark. The least_used policy starts from the
+// states of weight 1 and raises the weight bound after each full pass that
+// did not free enough.
+func (r *CacheRepository) evict(ctx context.Context, guildID string, limit SizeLimit) (evicted int64, err error) {
+	const batchSize = 200
+
+	cursor := "0"
+	maxWeight := int64(1)
+	var lightestKept int64 // lightest state kept by the current least_used pass
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWriteFCall(ctx, guildID, "evict_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "evict_batch", []string{guildID}, limit.Policy, limit.lowWater(), cursor, batchSize, maxWeight)
+			return e
+		})
+		if err != nil {
+			return evicted, err
+		}
+		if len(raw) < 4 {
+			return evicted, fmt.Errorf("unexpected response len %d", len(raw))
+		}
+		nextCursor, n, err := parseCursorCount(raw)
+		if err != nil {
+			return evicted, err
+		}
+		bytes, _ := raw[2].AsInt64()
+		if lightest, _ := raw[3].AsInt64(); lightest > 0 && (lightestKept == 0 || lightest < lightestKept) {
+			lightestKept = lightest
+		}
+		evicted += n
+
+		cursor = nextCursor
+		if cursor != "0" {
+			continue
+		}
+		// A least_used pass over every state ended above the low-water mark:
+		// retry with a higher bound, unless nothing is left to evict.
+		if limit.Policy != EvictionLeastUsed || bytes <= limit.lowWater() || lightestKept == 0 {
+			return evicted, nil
+		}
+		maxWeight = max(2*maxWeight, lightestKept)
+		lightestKept = 0
+	}
+}
+
+// GetEvictions returns how many states eviction passes removed from a guild
+// chain since it was last cleared.
+func (r *CacheRepository) GetEvictions(ctx context.Context, guildID string) (int64, error) {
+	var res []int64
+	err := r.runWithCacheReadRetry(ctx, guildID, "get_stats_markov", func(c context.Context) error {
+		var e error
+		res, e = r.fcallInt64Slice(c, "get_stats_markov", []string{guildID})
+		return e
+	})
+	if err != nil || len(res) < 4 {
+		return 0, err
+	}
+	return res[3], nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// The keyword index keeps, per guild, how many trained messages contain each
+// word token (its document frequency) and how many messages were indexed.
+// PickKeywords uses it to find the rarest words of a message, the ones most
+// likely to say what the message is about, among those the chain knows.
+
+// maxKeywordCandidates bounds how many distinct words of a message
+// PickKeywords scores.
+const maxKeywordCandidates = 64
+
+// keywordCounts returns how many of messages hold at least one word token,
+// and in how many of them each word token appears.
+func keywordCounts(messages []string, tok Tokenizer) (docs int64, df map[string]int64) {
+	df = make(map[string]int64)
+	for _, msg := range messages {
+		seen := make(map[string]bool)
+		for _, t := range tok.Tokenize(msg) {
+			if isMarker(t) || !isWordToken(t) || seen[t] {
+				continue
+			}
+			seen[t] = true
+			df[t]++
+		}
+		if len(seen) > 0 {
+			docs++
+		}
+	}
+	return docs, df
+}
+
+// keywordCandidates returns the distinct word tokens of text with their
+// occurrences, in order of first appearance. URLs and pings are stripped
+// first, so mentioning the bot is not a keyword.
+func keywordCandidates(text string, tok Tokenizer) (tokens []string, occurrences map[string]int64) {
+	occurrences = make(map[string]int64)
+	for _, t := range tok.Tokenize(FilterText(text, false)) {
+		if isMarker(t) || !isWordToken(t) {
+			continue
+		}
+		if occurrences[t] == 0 {
+			if len(tokens) >= maxKeywordCandidates {
+				continue
+			}
+			tokens = append(tokens, t)
+		}
+		occurrences[t]++
+	}
+	return tokens, occurrences
+}
+
+// IndexKeywords adds messages to the guild's keyword index.
+func (r *CacheRepository) IndexKeywords(ctx context.Context, guildID string, messages []string, tok Tokenizer) error {
+	docs, df := keywordCounts(messages, tok)
+	return r.keywordAdd(ctx, guildID, docs, df, 1)
+}
+
+// UnindexKeywords removes one message from the guild's keyword index.
+func (r *CacheRepository) UnindexKeywords(ctx context.Context, guildID, message string, tok Tokenizer) error {
+	docs, df := keywordCounts([]string{message}, tok)
+	return r.keywordAdd(ctx, guildID, docs, df, -1)
+}
+
+func (r *CacheRepository) keywordAdd(ctx context.Context, guildID string, docs int64, df map[string]int64, sign int64) error {
+	const maxPairsPerCall = 2048
+
+	args := make([]string, 0, 1+2*256)
+	args = append(args, strconv.FormatInt(sign*docs, 10))
+	flush := func() error {
+		if len(args) == 1 && args[0] == "0" {
+			return nil
+		}
+		err := r.runWriteFCall(ctx, guildID, "keyword_add", func(c context.Context) error {
+			return r.doFCall(c, "keyword_add", []string{guildID}, args).Error()
+		})
+		args = append(args[:0], "0")
+		return err
+	}
+	for t, n := range df {
+		args = append(args, t, strconv.FormatInt(sign*n, 10))
+		if len(args) >= 1+2*maxPairsPerCall {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// ReindexKeywords rebuilds the guild's keyword index from its chain, for
+// chains loaded from a dump. Messages are gone by then, so a token's
+// document frequency is approximated by how often it was trained as a
+// successor, and the message count comes from the chain's stats.
+func (r *CacheRepository) ReindexKeywords(ctx context.Context, guildID string) error {
+	if err := r.runWriteFCall(ctx, guildID, "keyword_clear", func(c context.Context) error {
+		return r.fcallErr(c, "keyword_clear", []string{guildID})
+	}); err != nil {
+		return err
+	}
+	_, messages, _, err := r.GetStats(ctx, guildID)
+	if err != nil {
+		return err
+	}
+	if err := r.keywordAdd(ctx, guildID, messages, nil, 1); err != nil {
+		return err
+	}
+
+	const stateBatchSize = 200
+	cursor := "0"
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWithCacheReadRetry(ctx, guildID, "export_states_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "export_states_batch", []string{guildID}, cursor, stateBatchSize)
+			return e
+		})
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		nextCursor, rows, err := parseCursorRows(raw)
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		df := make(map[string]int64)
+		for _, row := range rows {
+			for i := 1; i+1 < len(row); i += 2 {
+				n, err := strconv.ParseInt(row[i+1], 10, 64)
+				if err != nil || n <= 0 || isMarker(row[i]) || !isWordToken(row[i]) {
+					continue
+				}
+				df[row[i]] += n
+			}
+		}
+		if err := r.keywordAdd(ctx, guildID, 0, df, 1); err != nil {
+			return err
+		}
+		cursor = nextCursor
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// PickKeywords returns up to limit word tokens of text that the guild chain
+// has a state for, rarest in the guild first. Text is tokenized like
+// training text. Returns nil when no word of text is known.
+func (r *CacheRepository) PickKeywords(ctx context.Context, guildID, text string, limit int, tok Tokenizer) ([]string, error) {
+	tokens, occurrences := keywordCandidates(text, tok)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	args := make([]string, 0, 1+2*len(tokens))
+	args = append(args, strconv.Itoa(max(1, limit)))
+	for _, t := range tokens {
+		args = append(args, t, strconv.FormatInt(occurrences[t], 10))
+	}
+	var keywords []string
+	err := r.runWithCacheReadRetry(ctx, guildID, "pick_keywords", func(c context.Context) error {
+		var e error
+		keywords, e = r.doFCall(c, "pick_keywords", []string{guildID}, args).AsStrSlice()
+		return e
+	})
+	return keywords, err
+}
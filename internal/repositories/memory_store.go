@@ -0,0 +1,1940 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"rolando/internal/utils"
+)
+
+// MemoryStore is an in-process ChainStore. It ports cache_markov.lua to Go
+// (sentence markers, start index, reverse transitions, n-gram backoff,
+// sampling controls, branching cap and byte estimation) so a single-node dev
+// bot and tests behave like production without a cache service. Nothing is
+// persisted; a restart starts from empty chains.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	chains   map[string]*memoryChain // keyed by chain ID, sub-chains included
+	fetching map[string]bool
+	jackbox  map[string]string
+	// conversations are keyed by channel sub-chain ID.
+	conversations map[string]*memoryConversation
+}
+
+// memoryConversation mirrors conversation:<id> and its turns counter.
+type memoryConversation struct {
+	history []string
+	turns   int64
+	expires time.Time
+}
+
+// memoryChain mirrors the keys cache_markov.lua keeps for one chain ID.
+type memoryChain struct {
+	nGramSize int                         // last trained n-gram size (0 = infer from the prefix)
+	states    map[string]map[string]int64 // markov:<id>:state:<prefix>
+	rstates   map[string]map[string]int64 // markov:<id>:rstate:<suffix>
+	starts    map[string]int64            // markov:<id>:starts
+	ages      map[string]int64            // markov:<id>:ages (nil unless evicting the oldest)
+	media     map[string]map[string]struct{}
+	novelty   map[string]int64            // novelty:<id>
+	rhymes    map[string]map[string]int64 // rhyme:<id>:<rhyme_key>
+	keywords  map[string]int64            // keywords:<id>
+	docs      int64                       // keywords:<id>:docs
+	analysis  *ChainAnalysis              // analysis:<id>
+	prefixes  int64
+	messages  int64
+	bytes     int64
+	evicted   int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chains:        make(map[string]*memoryChain),
+		fetching:      make(map[string]bool),
+		jackbox:       make(map[string]string),
+		conversations: make(map[string]*memoryConversation),
+	}
+}
+
+// chain returns the chain for id, creating it when create is set. Callers
+// must hold mu (for writing when create is set).
+func (m *MemoryStore) chain(id string, create bool) *memoryChain {
+	c := m.chains[id]
+	if c == nil && create {
+		c = &memoryChain{
+			states:   make(map[string]map[string]int64),
+			rstates:  make(map[string]map[string]int64),
+			starts:   make(map[string]int64),
+			media:    make(map[string]map[string]struct{}),
+			novelty:  make(map[string]int64),
+			rhymes:   make(map[string]map[string]int64),
+			keywords: make(map[string]int64),
+		}
+		m.chains[id] = c
+	}
+	return c
+}
+
+// Key names are only used for byte estimation; they match the Lua layout.
+func memStateKey(id, prefix string) string  { return "markov:" + ChainKey(id) + ":state:" + prefix }
+func memRStateKey(id, suffix string) string { return "markov:" + ChainKey(id) + ":rstate:" + suffix }
+
+// ---------- training ----------
+
+// Train ingests a single message into the chain for the given guild.
+// URLs are classified and stored in media sets instead.
+func (m *MemoryStore) Train(ctx context.Context, guildID, message string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	for _, url := range utils.ExtractUrls(message) {
+		if err := m.AddMedia(ctx, guildID, url); err != nil {
+			return err
+		}
+	}
+
+	tokens := tok.Tokenize(message)
+	if len(tokens) < nGramSize {
+		return nil
+	}
+	pairs := buildPairs(tokens, nGramSize)
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chain(guildID, true).nGramSize = nGramSize
+	m.trainOrEvict(guildID, pairs, 1, limit, maxBranches)
+	return nil
+}
+
+// TrainBatch ingests multiple messages into the guild chain.
+func (m *MemoryStore) TrainBatch(ctx context.Context, guildID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return m.trainBatch(ctx, guildID, messages, true, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainChannelBatch ingests messages into a channel sub-chain, without media.
+func (m *MemoryStore) TrainChannelBatch(ctx context.Context, guildID, channelID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return m.trainBatch(ctx, ChannelChainID(guildID, channelID), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainAuthorBatch ingests one member's messages into their author sub-chain, without media.
+func (m *MemoryStore) TrainAuthorBatch(ctx context.Context, guildID, userID string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return m.trainBatch(ctx, AuthorChainID(guildID, userID), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+// TrainLanguageBatch ingests messages into a language sub-chain, without media.
+func (m *MemoryStore) TrainLanguageBatch(ctx context.Context, guildID, lang string, messages []string, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	return m.trainBatch(ctx, LanguageChainID(guildID, lang), messages, false, nGramSize, limit, maxBranches, tok)
+}
+
+func (m *MemoryStore) trainBatch(ctx context.Context, id string, messages []string, withMedia bool, nGramSize int, limit SizeLimit, maxBranches int, tok Tokenizer) error {
+	const maxPairsPerCall = 4096 // flush at the same points as CacheRepository
+
+	pairs := make([]string, 0, 512)
+	var msgCount int64
+
+	flush := func() {
+		if len(pairs) == 0 {
+			return
+		}
+		m.mu.Lock()
+		m.chain(id, true).nGramSize = nGramSize
+		m.trainOrEvict(id, pairs, msgCount, limit, maxBranches)
+		m.mu.Unlock()
+		pairs = pairs[:0]
+		msgCount = 0
+	}
+
+	for _, msg := range messages {
+		if withMedia {
+			for _, url := range utils.ExtractUrls(msg) {
+				if err := m.AddMedia(ctx, id, url); err != nil {
+					return err
+				}
+			}
+		}
+
+		tokens := tok.Tokenize(msg)
+		if len(tokens) < nGramSize {
+			continue
+		}
+		pairs = append(pairs, buildPairs(tokens, nGramSize)...)
+		msgCount++
+
+		if len(pairs) >= maxPairsPerCall {
+			flush()
+		}
+	}
+	flush()
+	return nil
+}
+
+// trainOrEvict is trainPairs, making room with an eviction pass and retrying
+// once when the chain is at its size limit and the limit evicts. Callers must
+// hold mu for writing.
+func (m *MemoryStore) trainOrEvict(id string, pairs []string, messageCount int64, limit SizeLimit, maxBranches int) {
+	if m.trainPairs(id, pairs, messageCount, limit, maxBranches) != 0 || !limit.evicts() {
+		return
+	}
+	m.chain(id, true).evict(id, limit)
+	m.trainPairs(id, pairs, messageCount, limit, maxBranches)
+}
+
+// trainPairs is train_batch: pairs are "prefix\0next" or weighted
+// "prefix\0next\0count". Returns 1 when written, 2 when the size limit was
+// reached midway and the remaining pairs dropped, 0 when the size limit was
+// already reached and -1 when the group budget was. Callers must hold mu for
+// writing.
+func (m *MemoryStore) trainPairs(id string, pairs []string, messageCount int64, limit SizeLimit, maxBranches int) int64 {
+	c := m.chain(id, true)
+	if limit.MaxBytes > 0 && c.bytes >= int64(limit.MaxBytes) {
+		return 0
+	}
+	if limit.GroupMaxBytes > 0 && m.groupBytes(id) >= int64(limit.GroupMaxBytes) {
+		return -1
+	}
+
+	var added, newPrefixes int64
+	trackAges := limit.Policy == EvictionOldest
+	if !trackAges && c.ages != nil {
+		for prefix := range c.ages {
+			added -= int64(len(prefix)) + 24
+		}
+		c.ages = nil
+	}
+	if trackAges && c.ages == nil {
+		c.ages = make(map[string]int64)
+	}
+	now := time.Now().Unix()
+	result := int64(1)
+	for _, pair := range pairs {
+		if limit.MaxBytes > 0 && c.bytes+added >= int64(limit.MaxBytes) {
+			result = 2
+			break
+		}
+		prefix, nextWord, ok := strings.Cut(pair, "\x00")
+		if !ok {
+			continue
+		}
+		weight := int64(1)
+		if word, count, weighted := strings.Cut(nextWord, "\x00"); weighted {
+			nextWord = word
+			weight, _ = strconv.ParseInt(count, 10, 64)
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		h := c.states[prefix]
+		isNew := h == nil
+		if isNew {
+			h = make(map[string]int64)
+			c.states[prefix] = h
+		}
+		h[nextWord] += weight
+		if isStartPrefix(prefix) {
+			added += c.indexStartAdd(prefix, weight)
+		}
+		if isNew {
+			newPrefixes++
+			added += int64(len(memStateKey(id, prefix))) + 64
+		}
+		added += int64(len(nextWord)+16) * weight
+		added += c.addReverse(id, prefix, nextWord, maxBranches, weight)
+		added -= c.pruneForward(id, prefix, maxBranches)
+		if trackAges {
+			if _, ok := c.ages[prefix]; !ok {
+				added += int64(len(prefix)) + 24
+			}
+			c.ages[prefix] = now
+		}
+	}
+
+	c.prefixes += newPrefixes
+	if messageCount > 0 {
+		c.messages += messageCount
+	}
+	c.bytes = max(0, c.bytes+added)
+	return result
+}
+
+// groupBytes is the group counter of train_batch: the summed size of the
+// author, channel or language sub-chains of id's guild, or 0 when id is none
+// of them.
+func (m *MemoryStore) groupBytes(id string) int64 {
+	i := strings.IndexAny(id, "/#@")
+	if i < 0 {
+		return 0
+	}
+	var total int64
+	for other, c := range m.chains {
+		if strings.HasPrefix(other, id[:i+1]) {
+			total += c.bytes
+		}
+	}
+	return total
+}
+
+// evict is evict_batch run to completion, ordering the states exactly: by
+// total weight for least_used, or for oldest by last training time, with
+// states missing from the age index first.
+func (c *memoryChain) evict(id string, limit SizeLimit) {
+	lowWater := limit.lowWater()
+	if c.bytes <= lowWater {
+		return
+	}
+	type candidate struct {
+		prefix string
+		score  int64
+	}
+	candidates := make([]candidate, 0, len(c.states))
+	for prefix, h := range c.states {
+		var score int64
+		if limit.Policy == EvictionOldest {
+			score = c.ages[prefix]
+		} else {
+			for _, w := range h {
+				score += w
+			}
+		}
+		candidates = append(candidates, candidate{prefix, score})
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.score, b.score), strings.Compare(a.prefix, b.prefix))
+	})
+
+	for _, cand := range candidates {
+		if c.bytes <= lowWater {
+			break
+		}
+		c.bytes = max(0, c.bytes-c.evictState(id, cand.prefix))
+		c.prefixes = max(0, c.prefixes-1)
+		c.evicted++
+	}
+}
+
+// evictState is evict_state: it deletes one forward state with its reverse
+// transitions, start index entry and age index entry, returning the bytes
+// freed.
+func (c *memoryChain) evictState(id, prefix string) int64 {
+	freed := c.unindexAge(prefix)
+	var total int64
+	for word, w := range c.states[prefix] {
+		total += w
+		freed += int64(len(word)+16)*w + c.removeReverse(id, prefix, word, w)
+	}
+	if isStartPrefix(prefix) {
+		freed += c.indexStartSub(prefix, total)
+	}
+	delete(c.states, prefix)
+	return freed + int64(len(memStateKey(id, prefix))) + 64
+}
+
+// unindexAge drops a prefix from the age index, returning the bytes freed.
+func (c *memoryChain) unindexAge(prefix string) int64 {
+	if _, ok := c.ages[prefix]; !ok {
+		return 0
+	}
+	delete(c.ages, prefix)
+	return int64(len(prefix)) + 24
+}
+
+// Delete removes a message's contribution from the chain, forward and reverse.
+func (m *MemoryStore) Delete(ctx context.Context, guildID, message string, nGramSize int, tok Tokenizer) error {
+	for _, url := range utils.ExtractUrls(message) {
+		if err := m.RemoveMedia(ctx, guildID, classifyURL(url), url); err != nil {
+			return err
+		}
+	}
+
+	tokens := tok.Tokenize(message)
+	if len(tokens) < nGramSize {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return nil
+	}
+	for _, pair := range buildPairs(tokens, nGramSize) {
+		prefix, next, _ := strings.Cut(pair, "\x00")
+		c.deletePair(guildID, prefix, next)
+	}
+	return nil
+}
+
+// deletePair is delete_markov.
+func (c *memoryChain) deletePair(id, prefix, nextWord string) {
+	h := c.states[prefix]
+	if h[nextWord] <= 0 {
+		return
+	}
+	h[nextWord]--
+
+	freed := int64(len(nextWord)+16) + c.removeReverse(id, prefix, nextWord, 1)
+	if isStartPrefix(prefix) {
+		freed += c.indexStartSub(prefix, 1)
+	}
+	if h[nextWord] <= 0 {
+		delete(h, nextWord)
+		if len(h) == 0 {
+			delete(c.states, prefix)
+			c.prefixes--
+			freed += int64(len(memStateKey(id, prefix))) + 64 + c.unindexAge(prefix)
+		}
+	}
+	c.bytes = max(0, c.bytes-freed)
+}
+
+// ClearGuild wipes a guild chain, its channel, author and language sub-chains
+// and its media.
+func (m *MemoryStore) ClearGuild(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.chains {
+		if id == guildID || strings.HasPrefix(id, guildID+"/") || strings.HasPrefix(id, guildID+"@") ||
+			strings.HasPrefix(id, guildID+"#") {
+			delete(m.chains, id)
+		}
+	}
+	for id := range m.conversations {
+		if strings.HasPrefix(id, guildID+"/") {
+			delete(m.conversations, id)
+		}
+	}
+	return nil
+}
+
+// ClearChannelChains wipes every channel sub-chain of a guild.
+func (m *MemoryStore) ClearChannelChains(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.chains {
+		if strings.HasPrefix(id, guildID+"/") {
+			delete(m.chains, id)
+		}
+	}
+	return nil
+}
+
+// ClearLanguageChains wipes every language sub-chain of a guild.
+func (m *MemoryStore) ClearLanguageChains(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.chains {
+		if strings.HasPrefix(id, guildID+"#") {
+			delete(m.chains, id)
+		}
+	}
+	return nil
+}
+
+// DropAuthorChain deletes a member's author sub-chain in a guild.
+func (m *MemoryStore) DropAuthorChain(_ context.Context, guildID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chains, AuthorChainID(guildID, userID))
+	return nil
+}
+
+// SubChains returns the IDs of a guild's channel, language and author
+// sub-chains that hold anything, sorted.
+func (m *MemoryStore) SubChains(_ context.Context, guildID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ids []string
+	for id, c := range m.chains {
+		rest, ok := strings.CutPrefix(id, guildID)
+		if ok && len(rest) > 1 && strings.ContainsRune("/#@", rune(rest[0])) && c.bytes > 0 {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// ---------- transition helpers ----------
+
+func isStartPrefix(prefix string) bool {
+	return strings.HasPrefix(prefix, tokenBOS)
+}
+
+func isMarker(token string) bool {
+	return token == tokenBOS || token == tokenEOS
+}
+
+// pruneTransitions keeps at most maxF successors, dropping the lightest first
+// (ties by name). Returns the dropped successors with their weights. maxF <= 0
+// disables it.
+func pruneTransitions(h map[string]int64, maxF int) map[string]int64 {
+	if maxF <= 0 || len(h) <= maxF {
+		return nil
+	}
+	words := make([]string, 0, len(h))
+	for w := range h {
+		words = append(words, w)
+	}
+	slices.SortFunc(words, func(a, b string) int {
+		if c := cmp.Compare(h[a], h[b]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	dropped := make(map[string]int64, len(words)-maxF)
+	for _, w := range words[:len(words)-maxF] {
+		dropped[w] = h[w]
+		delete(h, w)
+	}
+	return dropped
+}
+
+// edgesBytes is what estimated_bytes counted for edges.
+func edgesBytes(edges map[string]int64) int64 {
+	var bytes int64
+	for w, n := range edges {
+		bytes += int64(len(w)+16) * n
+	}
+	return bytes
+}
+
+// pruneForward is prune_forward: caps the forward state of prefix, dropping
+// the reverse twins and start weight of the pruned edges. Returns the bytes
+// freed.
+func (c *memoryChain) pruneForward(id, prefix string, maxF int) int64 {
+	edges := pruneTransitions(c.states[prefix], maxF)
+	if len(edges) == 0 {
+		return 0
+	}
+	freed := edgesBytes(edges)
+	var dropped int64
+	for w, n := range edges {
+		dropped += n
+		freed += c.removeReverse(id, prefix, w, n)
+	}
+	if isStartPrefix(prefix) {
+		freed += c.indexStartSub(prefix, dropped)
+	}
+	return freed
+}
+
+func (c *memoryChain) indexStartAdd(prefix string, weight int64) int64 {
+	_, exists := c.starts[prefix]
+	c.starts[prefix] += weight
+	if !exists {
+		return int64(len(prefix)) + 16
+	}
+	return 0
+}
+
+func (c *memoryChain) indexStartSub(prefix string, weight int64) int64 {
+	if _, exists := c.starts[prefix]; !exists {
+		return 0
+	}
+	c.starts[prefix] -= weight
+	if c.starts[prefix] <= 0 {
+		delete(c.starts, prefix)
+		return int64(len(prefix)) + 16
+	}
+	return 0
+}
+
+// reversePair maps a forward transition to its reverse one: the last n-1
+// tokens of the n-gram and the token that preceded them.
+func reversePair(prefix, nextWord string) (suffix, prevWord string) {
+	first, rest, ok := strings.Cut(prefix, " ")
+	if !ok {
+		return nextWord, prefix
+	}
+	return rest + " " + nextWord, first
+}
+
+// forwardPair is the inverse of reversePair.
+func forwardPair(suffix, prevWord string) (prefix, nextWord string) {
+	i := strings.LastIndexByte(suffix, ' ')
+	if i < 0 {
+		return prevWord, suffix
+	}
+	return prevWord + " " + suffix[:i], suffix[i+1:]
+}
+
+func (c *memoryChain) addReverse(id, prefix, nextWord string, maxBranches int, weight int64) int64 {
+	suffix, prevWord := reversePair(prefix, nextWord)
+	h := c.rstates[suffix]
+	isNew := h == nil
+	if isNew {
+		h = make(map[string]int64)
+		c.rstates[suffix] = h
+	}
+	h[prevWord] += weight
+	pruned := pruneTransitions(h, maxBranches)
+
+	added := int64(len(prevWord)+16)*weight - edgesBytes(pruned)
+	if isNew {
+		added += int64(len(memRStateKey(id, suffix))) + 64
+	}
+	return added
+}
+
+func (c *memoryChain) removeReverse(id, prefix, nextWord string, weight int64) int64 {
+	suffix, prevWord := reversePair(prefix, nextWord)
+	h := c.rstates[suffix]
+	if h[prevWord] <= 0 {
+		return 0
+	}
+	removed := min(weight, h[prevWord])
+	freed := (int64(len(prevWord)) + 16) * removed
+	h[prevWord] -= removed
+	if h[prevWord] <= 0 {
+		delete(h, prevWord)
+		if len(h) == 0 {
+			delete(c.rstates, suffix)
+			freed += int64(len(memRStateKey(id, suffix))) + 64
+		}
+	}
+	return freed
+}
+
+// ---------- generation ----------
+
+// Generate produces text of up to maxLength tokens from a random starting prefix.
+func (m *MemoryStore) Generate(_ context.Context, guildID string, maxLength int, sampling Sampling) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return "", nil
+	}
+	tokens, _ := c.generateTokens(c.findPrefix(), maxLength, sampling.normalized())
+	return joinOutput(tokens), nil
+}
+
+// GenerateFiltered generates text and strips URLs, pings, and noisy characters.
+func (m *MemoryStore) GenerateFiltered(ctx context.Context, guildID string, maxLength int, sampling Sampling) (string, error) {
+	unfiltered, err := m.Generate(ctx, guildID, maxLength, sampling)
+	if err != nil {
+		return "", err
+	}
+	return FilterText(unfiltered, false), nil
+}
+
+// GenerateFromSeed produces a sentence containing the given seed by walking
+// the reverse transitions back to a sentence start, then generating forward.
+// Returns "" when the chain has never seen the seed.
+func (m *MemoryStore) GenerateFromSeed(_ context.Context, guildID, seed string, maxLength int, sampling Sampling, tok Tokenizer) (string, error) {
+	seed = strings.Join(tok.Tokenize(seed), " ")
+	if seed == "" {
+		return "", nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return "", nil
+	}
+	anchor := c.findSeededPrefix(seed)
+	if anchor == "" {
+		return "", nil
+	}
+	s := sampling.normalized()
+
+	left := strings.Fields(anchor)
+	window := c.window(len(left))
+
+	walked := 0
+	for range maxLength / 2 {
+		backoff := left[:min(window, len(left))]
+		var prev map[string]int64
+		for len(backoff) > 0 {
+			if h := c.rstates[strings.Join(backoff, " ")]; len(h) > 0 {
+				prev = h
+				break
+			}
+			backoff = backoff[:len(backoff)-1]
+		}
+		if prev == nil {
+			break
+		}
+		chosen, ok := pickNext(prev, s)
+		if !ok || chosen == tokenBOS {
+			break
+		}
+		left = append([]string{chosen}, left...)
+		walked++
+	}
+
+	tail := left[max(0, len(left)-window):]
+	forward, _ := c.generateTokens(strings.Join(tail, " "), maxLength-walked, s)
+	if len(forward) > len(tail) {
+		left = append(left, forward[len(tail):]...)
+	}
+	return joinOutput(left), nil
+}
+
+// GenerateRhyme generates text whose last token rhymes with rhymeWord, like
+// generate_rhyme: one forward pass recording successors listed in the rhyme
+// index, then a swap at the latest position at or above maxLength/2.
+func (m *MemoryStore) GenerateRhyme(_ context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return "", nil
+	}
+	prefix := c.findPrefix()
+	if prefix == "" {
+		return "", nil
+	}
+	s := sampling.normalized()
+
+	key, word := rhymeTarget(rhymeWord, lang)
+	rhymes := make(map[string]int64)
+	for t, w := range c.rhymes[key] {
+		if w > 0 && strings.ToLower(t) != word {
+			rhymes[t] = w
+		}
+	}
+	if len(rhymes) == 0 {
+		tokens, _ := c.generateTokens(prefix, maxLength, s)
+		return joinOutput(tokens), nil
+	}
+
+	generated := strings.Fields(prefix)
+	window := c.window(len(generated))
+	current := prefix
+	candidates := make(map[int][]weightedWord)
+
+	for range maxLength {
+		next := c.nextDistribution(current, s.Smoothing)
+		if next == nil {
+			break
+		}
+		chosen, ok := pickNext(next, s)
+		if !ok || chosen == tokenEOS {
+			break
+		}
+		generated = append(generated, chosen)
+		pos := len(generated)
+
+		for w, n := range next {
+			if n > 0 && rhymes[w] > 0 {
+				candidates[pos] = append(candidates[pos], weightedWord{w, n})
+			}
+		}
+		current = strings.Join(generated[max(0, len(generated)-window):], " ")
+	}
+
+	for swapPos := len(generated); swapPos >= max(1, maxLength/2); swapPos-- {
+		if pick, ok := pickWeighted(candidates[swapPos]); ok {
+			generated[swapPos-1] = pick
+			return joinOutput(generated[:swapPos]), nil
+		}
+	}
+
+	// No rhyming successor anywhere: close the line with a rhyming token
+	// from the index.
+	last := len(generated) - 1
+	if last >= 0 && rhymes[generated[last]] == 0 {
+		options := make([]weightedWord, 0, len(rhymes))
+		for w, n := range rhymes {
+			options = append(options, weightedWord{w, n})
+		}
+		slices.SortFunc(options, func(a, b weightedWord) int { return strings.Compare(a.word, b.word) })
+		if pick, ok := pickWeighted(options); ok {
+			if isMarker(generated[last]) {
+				generated[last] = pick
+			} else {
+				generated = append(generated, pick)
+			}
+		}
+	}
+	return joinOutput(generated), nil
+}
+
+type weightedWord struct {
+	word   string
+	weight int64
+}
+
+// pickWeighted draws one word in proportion to its weight, like
+// pick_next_weighted. ok is false when the options carry no weight.
+func pickWeighted(options []weightedWord) (string, bool) {
+	var sum int64
+	for _, o := range options {
+		sum += o.weight
+	}
+	if sum <= 0 {
+		return "", false
+	}
+	target := rand.Int64N(sum) + 1
+	var cumulative int64
+	for _, o := range options {
+		cumulative += o.weight
+		if target <= cumulative {
+			return o.word, true
+		}
+	}
+	return "", false
+}
+
+// GenerateRhymeFiltered is the filtered counterpart of GenerateRhyme.
+func (m *MemoryStore) GenerateRhymeFiltered(ctx context.Context, guildID, rhymeWord, lang string, maxLength int, sampling Sampling) (string, error) {
+	raw, err := m.GenerateRhyme(ctx, guildID, rhymeWord, lang, maxLength, sampling)
+	if err != nil {
+		return "", err
+	}
+	return FilterText(raw, false), nil
+}
+
+// GenerateCrossover is generate_crossover: each chain backs off on its own,
+// and the normalised successor distributions are mixed by weight at every
+// step. The start prefix comes from one chain picked by weight.
+func (m *MemoryStore) GenerateCrossover(_ context.Context, guildIDs []string, weights []float64, maxLength int, sampling Sampling) (string, error) {
+	if len(guildIDs) == 0 || len(guildIDs) != len(weights) {
+		return "", fmt.Errorf("crossover: %d chains with %d weights", len(guildIDs), len(weights))
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chains := make([]*memoryChain, len(guildIDs))
+	for i, id := range guildIDs {
+		chains[i] = m.chain(id, false)
+	}
+	start := chains[pickWeightedIndex(weights)]
+	if start == nil {
+		return "", nil
+	}
+	prefix := start.findPrefix()
+	if prefix == "" {
+		return "", nil
+	}
+	s := sampling.normalized()
+
+	generated := strings.Fields(prefix)
+	nGramSize := len(generated) + 1
+	for _, c := range chains {
+		if c != nil {
+			nGramSize = max(nGramSize, c.nGramSize)
+		}
+	}
+	window := max(1, nGramSize-1)
+	current := prefix
+
+	for range maxLength {
+		mixed := make(map[string]float64)
+		for i, c := range chains {
+			if c == nil || weights[i] <= 0 {
+				continue
+			}
+			next := c.nextDistribution(current, s.Smoothing)
+			var total int64
+			for _, w := range next {
+				total += max(0, w)
+			}
+			if total <= 0 {
+				continue
+			}
+			for word, w := range next {
+				if w > 0 {
+					mixed[word] += float64(w) / float64(total) * weights[i]
+				}
+			}
+		}
+		if len(mixed) == 0 {
+			break
+		}
+		// pickNext expects integer counts, like pick_next.
+		next := make(map[string]int64, len(mixed))
+		for word, share := range mixed {
+			next[word] = max(1, int64(share*crossoverScale))
+		}
+		chosen, ok := pickNext(next, s)
+		if !ok || chosen == tokenEOS {
+			break
+		}
+		generated = append(generated, chosen)
+		current = strings.Join(generated[max(0, len(generated)-window):], " ")
+	}
+	return FilterText(joinOutput(generated), false), nil
+}
+
+// crossoverScale must match CROSSOVER_SCALE in cache_markov.lua.
+const crossoverScale = 1000000
+
+// GenerateConstrained tries a few start prefixes with generateConstrained,
+// like CacheRepository.GenerateConstrained over generate_constrained.
+func (m *MemoryStore) GenerateConstrained(_ context.Context, guildID string, c Constraints, sampling Sampling, tok Tokenizer) (string, error) {
+	required, banned := wordTokens(c.Required, tok), wordTokens(c.Banned, tok)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chain := m.chain(guildID, false)
+	if chain == nil {
+		return "", nil
+	}
+	s := sampling.normalized()
+	for attempt := range constrainedAttempts {
+		var prefix string
+		if seed := constrainedSeed(required, attempt); seed != "" {
+			prefix = chain.findSeededPrefix(seed)
+		}
+		if prefix == "" {
+			prefix = chain.findPrefix()
+		}
+		if prefix == "" {
+			return "", nil
+		}
+		out := chain.generateConstrained(prefix, c, required, banned, s)
+		if c.Filtered {
+			out = FilterText(out, false)
+		}
+		if c.accepts(out, required, banned) {
+			return out, nil
+		}
+	}
+	return "", nil
+}
+
+// constrainedStepBudget and constrainedMaxTokens must match
+// CONSTRAINED_STEP_BUDGET and CONSTRAINED_MAX_TOKENS in cache_markov.lua.
+const (
+	constrainedStepBudget = 400
+	constrainedMaxTokens  = 200
+)
+
+// generateConstrained is generate_constrained: successors breaking a
+// constraint are never sampled, a missing required token is taken as soon as
+// it is offered, and dead ends undo the last token and exclude it at that
+// position. Returns "" when nothing satisfying was found within the budget.
+func (c *memoryChain) generateConstrained(prefix string, cons Constraints, required, banned []string, s Sampling) string {
+	need := make(map[string]int, len(required))
+	missing := 0
+	for _, t := range required {
+		if _, ok := need[t]; !ok {
+			need[t] = 0
+			missing++
+		}
+	}
+	ban := make(map[string]bool, len(banned))
+	for _, t := range banned {
+		ban[t] = true
+	}
+
+	var generated []string
+	words, chars := 0, 0
+	push := func(t string) {
+		generated = append(generated, t)
+		if isMarker(t) {
+			return
+		}
+		if isWordToken(t) {
+			words++
+		}
+		if chars > 0 {
+			chars++
+		}
+		chars += utf8.RuneCountInString(t)
+		if n, ok := need[t]; ok {
+			if n == 0 {
+				missing--
+			}
+			need[t] = n + 1
+		}
+	}
+	pop := func() string {
+		t := generated[len(generated)-1]
+		generated = generated[:len(generated)-1]
+		if isMarker(t) {
+			return t
+		}
+		if isWordToken(t) {
+			words--
+		}
+		chars -= utf8.RuneCountInString(t)
+		if chars > 0 {
+			chars--
+		}
+		if n, ok := need[t]; ok {
+			need[t] = n - 1
+			if n == 1 {
+				missing++
+			}
+		}
+		return t
+	}
+
+	for _, t := range strings.Fields(prefix) {
+		if ban[t] {
+			return ""
+		}
+		push(t)
+	}
+	if (cons.MaxWords > 0 && words > cons.MaxWords) || (cons.MaxChars > 0 && chars > cons.MaxChars) {
+		return ""
+	}
+	base := len(generated)
+	window := c.window(base)
+
+	canEnd := func() bool { return words >= cons.MinWords && missing == 0 }
+	fits := func(t string) bool {
+		if isWordToken(t) && cons.MaxWords > 0 && words+1 > cons.MaxWords {
+			return false
+		}
+		sep := 0
+		if chars > 0 {
+			sep = 1
+		}
+		return cons.MaxChars <= 0 || chars+sep+utf8.RuneCountInString(t) <= cons.MaxChars
+	}
+
+	// excluded[d] holds the tokens already tried and undone at depth d.
+	excluded := make(map[int]map[string]bool)
+
+	for range constrainedStepBudget {
+		depth := len(generated) - base + 1
+		if excluded[depth] == nil {
+			excluded[depth] = make(map[string]bool)
+		}
+
+		var chosen string
+		next := c.nextDistribution(strings.Join(generated[max(0, len(generated)-window):], " "), s.Smoothing)
+		switch {
+		case next == nil:
+			// The chain ends here, as a sentence would.
+			if canEnd() {
+				return joinOutput(generated)
+			}
+		case depth <= constrainedMaxTokens:
+			candidates := make(map[string]int64, len(next))
+			for word, w := range next {
+				if excluded[depth][word] {
+					continue
+				}
+				var allowed bool
+				if word == tokenEOS {
+					allowed = canEnd()
+				} else {
+					allowed = !isMarker(word) && !ban[word] && fits(word)
+				}
+				if !allowed {
+					continue
+				}
+				if n, ok := need[word]; ok && n == 0 {
+					chosen = word
+					break
+				}
+				candidates[word] = w
+			}
+			if chosen == "" && len(candidates) > 0 {
+				chosen, _ = pickNext(candidates, s)
+			}
+			if chosen == "" && !cons.EndOnSentence && canEnd() {
+				// Out of budget with everything satisfied: a clean cut.
+				return joinOutput(generated)
+			}
+		case !cons.EndOnSentence && canEnd():
+			return joinOutput(generated)
+		}
+
+		switch {
+		case chosen == tokenEOS:
+			return joinOutput(generated)
+		case chosen != "":
+			push(chosen)
+		default:
+			if len(generated) == base {
+				return ""
+			}
+			delete(excluded, depth)
+			excluded[depth-1][pop()] = true
+		}
+	}
+	return ""
+}
+
+// findPrefix is find_prefix without a seed: a weighted opening from the start
+// index, else any BOS state, else any state. Returns "" for an empty chain.
+func (c *memoryChain) findPrefix() string {
+	var total int64
+	for _, w := range c.starts {
+		total += max(0, w)
+	}
+	if total > 0 {
+		target := rand.Int64N(total) + 1
+		var cumulative int64
+		for prefix, w := range c.starts {
+			cumulative += max(0, w)
+			if target <= cumulative {
+				return prefix
+			}
+		}
+	}
+
+	var starts, all []string
+	for prefix := range c.states {
+		all = append(all, prefix)
+		if isStartPrefix(prefix) {
+			starts = append(starts, prefix)
+		}
+	}
+	if len(starts) > 0 {
+		return starts[rand.IntN(len(starts))]
+	}
+	if len(all) > 0 {
+		return all[rand.IntN(len(all))]
+	}
+	return ""
+}
+
+// findSeededPrefix picks a random forward prefix containing seed, preferring
+// an exact match. Returns "" when no state mentions it.
+func (c *memoryChain) findSeededPrefix(seed string) string {
+	if _, ok := c.states[seed]; ok {
+		return seed
+	}
+	matching := make([]string, 0, 16)
+	for prefix := range c.states {
+		if prefix != "" && strings.Contains(prefix, seed) {
+			matching = append(matching, prefix)
+			if len(matching) >= 200 {
+				break
+			}
+		}
+	}
+	if len(matching) == 0 {
+		return ""
+	}
+	return matching[rand.IntN(len(matching))]
+}
+
+// window returns n_gram_size - 1, inferring n from the start prefix's
+// length when the chain has no trained size.
+func (c *memoryChain) window(startTokens int) int {
+	n := c.nGramSize
+	if n <= 0 {
+		n = startTokens + 1
+	}
+	return max(1, n-1)
+}
+
+// nextDistribution is next_distribution: the successors of prefix's longest
+// known suffix, or with smoothing the known suffixes interpolated with
+// absolute discounting. Returns nil when no suffix is known.
+func (c *memoryChain) nextDistribution(prefix string, smoothing float64) map[string]int64 {
+	backoff := strings.Fields(prefix)
+	if smoothing <= 0 {
+		for len(backoff) > 0 {
+			if h := c.states[strings.Join(backoff, " ")]; len(h) > 0 {
+				return h
+			}
+			backoff = backoff[1:]
+		}
+		return nil
+	}
+
+	type level struct {
+		next       map[string]int64
+		total      int64
+		successors int
+	}
+	var levels []level // longest suffix first
+	for ; len(backoff) > 0; backoff = backoff[1:] {
+		l := level{next: c.states[strings.Join(backoff, " ")]}
+		for _, w := range l.next {
+			if w > 0 {
+				l.total += w
+				l.successors++
+			}
+		}
+		if l.total > 0 {
+			levels = append(levels, l)
+		}
+	}
+	switch len(levels) {
+	case 0:
+		return nil
+	case 1:
+		return levels[0].next
+	}
+
+	probs := make(map[string]float64)
+	for i := len(levels) - 1; i >= 0; i-- {
+		l := levels[i]
+		discount := smoothing
+		if i == len(levels)-1 {
+			discount = 0
+		}
+		lower := discount * float64(l.successors) / float64(l.total)
+		for word := range probs {
+			probs[word] *= lower
+		}
+		for word, w := range l.next {
+			if w > 0 {
+				probs[word] += max(float64(w)-discount, 0) / float64(l.total)
+			}
+		}
+	}
+	// pickNext expects integer counts, like pick_next.
+	next := make(map[string]int64, len(probs))
+	for word, p := range probs {
+		next[word] = max(1, int64(p*interpolationScale))
+	}
+	return next
+}
+
+// interpolationScale must match INTERPOLATION_SCALE in cache_markov.lua.
+const interpolationScale = 1000000
+
+// generateTokens is do_generate_tokens: generation stops early when EOS is
+// sampled and the tokens may still contain BOS (render with joinOutput).
+func (c *memoryChain) generateTokens(startPrefix string, maxLength int, s Sampling) ([]string, int) {
+	if startPrefix == "" {
+		return nil, 1
+	}
+	generated := strings.Fields(startPrefix)
+	window := c.window(len(generated))
+	current := startPrefix
+
+	for range maxLength {
+		next := c.nextDistribution(current, s.Smoothing)
+		if next == nil {
+			break
+		}
+		chosen, ok := pickNext(next, s)
+		if !ok || chosen == tokenEOS {
+			break
+		}
+		generated = append(generated, chosen)
+		current = strings.Join(generated[max(0, len(generated)-window):], " ")
+	}
+	return generated, window
+}
+
+// normalized clamps sampling settings the way parse_sampling does.
+func (s Sampling) normalized() Sampling {
+	if s.Temperature <= 0 {
+		s.Temperature = 1
+	}
+	s.Temperature = max(s.Temperature, 0.05)
+	s.TopK = max(s.TopK, 0)
+	if s.TopP <= 0 || s.TopP > 1 {
+		s.TopP = 1
+	}
+	if s.Smoothing < 0 || s.Smoothing >= 1 {
+		s.Smoothing = 0
+	}
+	return s
+}
+
+// pickNext is pick_next: a draw proportional to raw counts, or to counts
+// shaped by temperature, top-k and top-p. ok is false when nothing carries weight.
+func pickNext(next map[string]int64, s Sampling) (string, bool) {
+	if s.Temperature == 1 && s.TopK == 0 && s.TopP >= 1 {
+		var total int64
+		for _, w := range next {
+			total += w
+		}
+		if total <= 0 {
+			return "", false
+		}
+		target := rand.Int64N(total) + 1
+		var cumulative int64
+		for word, w := range next {
+			cumulative += w
+			if target <= cumulative {
+				return word, true
+			}
+		}
+		return "", false
+	}
+
+	type row struct {
+		word   string
+		weight float64
+	}
+	rows := make([]row, 0, len(next))
+	counts := make(map[string]int64, len(next))
+	for word, w := range next {
+		if w > 0 {
+			rows = append(rows, row{word, float64(w)})
+			counts[word] = w
+		}
+	}
+	if len(rows) == 0 {
+		return "", false
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		if c := cmp.Compare(counts[b.word], counts[a.word]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.word, b.word)
+	})
+	if s.TopK > 0 && len(rows) > s.TopK {
+		rows = rows[:s.TopK]
+	}
+
+	invT := 1 / s.Temperature
+	var total float64
+	for i := range rows {
+		rows[i].weight = math.Pow(rows[i].weight, invT)
+		total += rows[i].weight
+	}
+	if s.TopP < 1 {
+		keep := total * s.TopP
+		var cumulative float64
+		for i, r := range rows {
+			cumulative += r.weight
+			if cumulative >= keep {
+				rows = rows[:i+1]
+				total = cumulative
+				break
+			}
+		}
+	}
+
+	target := rand.Float64() * total
+	var cumulative float64
+	for _, r := range rows {
+		cumulative += r.weight
+		if target < cumulative {
+			return r.word, true
+		}
+	}
+	return rows[len(rows)-1].word, true
+}
+
+// joinOutput concatenates generated tokens, dropping sentence markers.
+func joinOutput(tokens []string) string {
+	out := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if !isMarker(t) {
+			out = append(out, t)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// ---------- stats & maintenance ----------
+
+// GetStats returns (uniquePrefixes, messageCount, estimatedBytes) for a guild.
+func (m *MemoryStore) GetStats(_ context.Context, guildID string) (uniquePrefixes, messageCount int64, estimatedBytes uint64, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, 0, 0, nil
+	}
+	return c.prefixes, c.messages, uint64(c.bytes), nil
+}
+
+// GetEvictions returns how many states eviction passes removed from a chain.
+func (m *MemoryStore) GetEvictions(_ context.Context, guildID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, nil
+	}
+	return c.evicted, nil
+}
+
+// GetGuildSize returns the current estimated byte count.
+func (m *MemoryStore) GetGuildSize(ctx context.Context, guildID string) (uint64, error) {
+	_, _, size, err := m.GetStats(ctx, guildID)
+	return size, err
+}
+
+// ReconcileBytes recomputes the byte counter from the chain itself, using
+// the same per-entry estimate training adds, and stores it.
+func (m *MemoryStore) ReconcileBytes(_ context.Context, guildID string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, nil
+	}
+	var total int64
+	sum := func(key string, h map[string]int64) {
+		total += int64(len(key)) + 64
+		for word, w := range h {
+			total += int64(len(word)+16) * w
+		}
+	}
+	for prefix, h := range c.states {
+		sum(memStateKey(guildID, prefix), h)
+	}
+	for suffix, h := range c.rstates {
+		sum(memRStateKey(guildID, suffix), h)
+	}
+	for prefix := range c.starts {
+		total += int64(len(prefix)) + 16
+	}
+	c.bytes = total
+	return uint64(total), nil
+}
+
+// CapBranching trims every forward and reverse state to maxBranches
+// successors. maxBranches <= 0 is a no-op.
+func (m *MemoryStore) CapBranching(_ context.Context, guildID string, maxBranches int) (removed int64, err error) {
+	if maxBranches <= 0 {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, nil
+	}
+	var freed int64
+	for prefix, h := range c.states {
+		before := len(h)
+		freed += c.pruneForward(guildID, prefix, maxBranches)
+		removed += int64(before - len(h))
+	}
+	for _, h := range c.rstates {
+		before := len(h)
+		freed += edgesBytes(pruneTransitions(h, maxBranches))
+		removed += int64(before - len(h))
+	}
+	c.bytes = max(0, c.bytes-freed)
+	return removed, nil
+}
+
+// Decay multiplies every forward transition weight by factor (0 <= factor < 1)
+// with stochastic rounding, dropping those that reach zero. Reverse
+// transitions follow their forward twin, as in decay_batch. Returns the
+// number of transitions removed.
+func (m *MemoryStore) Decay(_ context.Context, guildID string, factor float64) (removed int64, err error) {
+	if factor < 0 || factor >= 1 {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, nil
+	}
+
+	var freed int64
+	for prefix, h := range c.states {
+		var lost int64
+		for word, w := range h {
+			scaled := int64(math.Floor(float64(w)*factor + rand.Float64()))
+			if scaled >= w {
+				continue
+			}
+			reverseLost := w - scaled
+			if scaled <= 0 {
+				scaled = 0
+				reverseLost = math.MaxInt64
+				delete(h, word)
+				removed++
+			} else {
+				h[word] = scaled
+			}
+			lost += w - scaled
+			freed += (w - scaled) * int64(len(word)+16)
+			freed += c.removeReverse(guildID, prefix, word, reverseLost)
+		}
+		if lost > 0 && isStartPrefix(prefix) {
+			freed += c.indexStartSub(prefix, lost)
+		}
+		if len(h) == 0 {
+			delete(c.states, prefix)
+			c.prefixes = max(0, c.prefixes-1)
+			freed += int64(len(memStateKey(guildID, prefix))) + 64
+			freed += c.unindexAge(prefix)
+		}
+	}
+	for suffix, h := range c.rstates {
+		for prevWord := range h {
+			prefix, nextWord := forwardPair(suffix, prevWord)
+			if _, ok := c.states[prefix][nextWord]; !ok {
+				freed += c.removeReverse(guildID, prefix, nextWord, math.MaxInt64)
+			}
+		}
+	}
+	c.bytes = max(0, c.bytes-freed)
+	return removed, nil
+}
+
+// AnalyzeChain is analyze_batch over the whole chain in one pass; the result
+// is kept on the chain for GetChainAnalysis.
+func (m *MemoryStore) AnalyzeChain(_ context.Context, guildID string, topN int) (*ChainAnalysis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	acc := newAnalysisAccumulator(topN)
+	c := m.chain(guildID, false)
+	if c == nil {
+		return acc.result(), nil
+	}
+
+	tokens := make(map[string]int64)
+	prefixes := make([]RankedEntry, 0, len(c.states))
+	for prefix, h := range c.states {
+		if len(h) == 0 {
+			continue
+		}
+		var total int64
+		for _, w := range h {
+			total += w
+		}
+		shifted := strings.Fields(prefix)[1:]
+		for word, w := range h {
+			if total > 0 && w > 0 {
+				p := float64(w) / float64(total)
+				acc.entropy -= p * math.Log2(p)
+			}
+			if word == tokenEOS {
+				continue
+			}
+			acc.successors++
+			if len(c.states[strings.Join(append(slices.Clip(shifted), word), " ")]) == 0 {
+				acc.deadEnds++
+			}
+			tokens[word] += w
+		}
+		acc.a.BranchingHistogram[histogramBucket(len(h))].Count++
+		acc.a.States++
+		acc.a.Transitions += int64(len(h))
+		acc.a.Weight += total
+		prefixes = append(prefixes, RankedEntry{Text: displayTokens(prefix), Count: total})
+	}
+	acc.addPrefixes(prefixes)
+	ranked := make([]RankedEntry, 0, len(tokens))
+	for word, w := range tokens {
+		ranked = append(ranked, RankedEntry{Text: displayTokens(word), Count: w})
+	}
+	acc.a.TopTokens = topRanked(ranked, topN)
+
+	c.analysis = acc.result()
+	a := *c.analysis
+	return &a, nil
+}
+
+// GetChainAnalysis returns the last AnalyzeChain result, or nil.
+func (m *MemoryStore) GetChainAnalysis(_ context.Context, guildID string) (*ChainAnalysis, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil || c.analysis == nil {
+		return nil, nil
+	}
+	a := *c.analysis
+	return &a, nil
+}
+
+// ---------- media ----------
+
+// AddMedia adds a URL to a media set.
+func (m *MemoryStore) AddMedia(_ context.Context, guildID, url string) error {
+	kind := classifyURL(url)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, true)
+	if c.media[kind] == nil {
+		c.media[kind] = make(map[string]struct{})
+	}
+	c.media[kind][url] = struct{}{}
+	return nil
+}
+
+// RemoveMedia removes a specific URL from a media set.
+func (m *MemoryStore) RemoveMedia(_ context.Context, guildID, kind, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.chain(guildID, false); c != nil {
+		delete(c.media[kind], url)
+	}
+	return nil
+}
+
+// GetRandomMedia returns a random URL of the given kind ("gif", "image", "video").
+func (m *MemoryStore) GetRandomMedia(_ context.Context, guildID, kind string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil || len(c.media[kind]) == 0 {
+		return "", nil
+	}
+	i := rand.IntN(len(c.media[kind]))
+	for url := range c.media[kind] {
+		if i == 0 {
+			return url, nil
+		}
+		i--
+	}
+	return "", nil
+}
+
+// GetMediaCounts returns (gifs, images, videos) counts for a guild.
+func (m *MemoryStore) GetMediaCounts(_ context.Context, guildID string) (gifs, images, videos int64, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return 0, 0, 0, nil
+	}
+	return int64(len(c.media["gif"])), int64(len(c.media["image"])), int64(len(c.media["video"])), nil
+}
+
+// ---------- flags ----------
+
+// SetFetching sets a flag indicating that the guild is currently fetching messages.
+func (m *MemoryStore) SetFetching(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetching[guildID] = true
+	return nil
+}
+
+// ClearFetching removes the fetching flag for the guild.
+func (m *MemoryStore) ClearFetching(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.fetching, guildID)
+	return nil
+}
+
+// IsFetching returns whether the guild is currently fetching messages.
+func (m *MemoryStore) IsFetching(_ context.Context, guildID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fetching[guildID], nil
+}
+
+func (m *MemoryStore) SetJackboxState(_ context.Context, guildID, appTag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jackbox[guildID] = appTag
+	return nil
+}
+
+func (m *MemoryStore) ClearJackboxState(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jackbox, guildID)
+	return nil
+}
+
+func (m *MemoryStore) GetJackboxState(_ context.Context, guildID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.jackbox[guildID], nil
+}
+
+// ---------- conversations ----------
+
+// GetConversation returns the channel's conversation (see
+// CacheRepository.GetConversation).
+func (m *MemoryStore) GetConversation(_ context.Context, guildID, channelID string) (int64, []string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conv := m.conversations[ChannelChainID(guildID, channelID)]
+	if conv == nil || time.Now().After(conv.expires) {
+		return 0, []string{}, nil
+	}
+	return conv.turns, slices.Clone(conv.history), nil
+}
+
+// PushConversation appends to the channel's conversation and counts one
+// answer (see CacheRepository.PushConversation).
+func (m *MemoryStore) PushConversation(_ context.Context, guildID, channelID string, ttl time.Duration, keep int, entries ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := ChannelChainID(guildID, channelID)
+	now := time.Now()
+	conv := m.conversations[id]
+	if conv == nil || now.After(conv.expires) {
+		conv = &memoryConversation{}
+		m.conversations[id] = conv
+	}
+	conv.history = append(conv.history, entries...)
+	if keep = max(1, keep); len(conv.history) > keep {
+		conv.history = slices.Clone(conv.history[len(conv.history)-keep:])
+	}
+	conv.turns++
+	conv.expires = now.Add(max(time.Second, ttl))
+	return conv.turns, nil
+}
+
+// ---------- novelty index ----------
+
+// IndexNovelty adds messages to the guild's novelty index.
+func (m *MemoryStore) IndexNovelty(_ context.Context, guildID string, messages []string, runLength int, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, true)
+	for _, msg := range messages {
+		for _, fp := range noveltyFingerprints(msg, runLength, tok) {
+			c.novelty[fp]++
+		}
+	}
+	return nil
+}
+
+// UnindexNovelty removes one copy of a message from the guild's novelty index.
+func (m *MemoryStore) UnindexNovelty(_ context.Context, guildID, message string, runLength int, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return nil
+	}
+	for _, fp := range noveltyFingerprints(message, runLength, tok) {
+		if c.novelty[fp]--; c.novelty[fp] <= 0 {
+			delete(c.novelty, fp)
+		}
+	}
+	return nil
+}
+
+// FindCopiedRun checks generated text against the guild's novelty index
+// (see CacheRepository.FindCopiedRun).
+func (m *MemoryStore) FindCopiedRun(_ context.Context, guildID, text string, runLength int, tok Tokenizer) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	fps := noveltyFingerprints(text, runLength, tok)
+	if c == nil || len(fps) == 0 {
+		return -1, nil
+	}
+	matches := make([]bool, len(fps))
+	for i, fp := range fps {
+		_, matches[i] = c.novelty[fp]
+	}
+	return copiedRunStart(matches), nil
+}
+
+// ClearNovelty drops the guild's novelty index.
+func (m *MemoryStore) ClearNovelty(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.chain(guildID, false); c != nil {
+		clear(c.novelty)
+	}
+	return nil
+}
+
+// ---------- rhyme index ----------
+
+// IndexRhymes adds the tokens of messages to the guild's rhyme index.
+func (m *MemoryStore) IndexRhymes(_ context.Context, guildID string, messages []string, lang string, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chain(guildID, true).addRhymes(rhymeCounts(messages, lang, tok), 1)
+	return nil
+}
+
+// UnindexRhymes removes the tokens of one message from the guild's rhyme index.
+func (m *MemoryStore) UnindexRhymes(_ context.Context, guildID, message, lang string, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.chain(guildID, false); c != nil {
+		c.addRhymes(rhymeCounts([]string{message}, lang, tok), -1)
+	}
+	return nil
+}
+
+// ReindexRhymes rebuilds the guild's rhyme index for lang from the successors
+// of its forward transitions, weighted by their counts.
+func (m *MemoryStore) ReindexRhymes(_ context.Context, guildID, lang string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return nil
+	}
+	clear(c.rhymes)
+	counts := make(map[string]map[string]int64)
+	for _, next := range c.states {
+		for t, n := range next {
+			if n > 0 {
+				addRhyme(counts, t, lang, n)
+			}
+		}
+	}
+	c.addRhymes(counts, 1)
+	return nil
+}
+
+func (c *memoryChain) addRhymes(counts map[string]map[string]int64, sign int64) {
+	for key, tokens := range counts {
+		row := c.rhymes[key]
+		if row == nil {
+			row = make(map[string]int64)
+			c.rhymes[key] = row
+		}
+		for t, n := range tokens {
+			if row[t] += sign * n; row[t] <= 0 {
+				delete(row, t)
+			}
+		}
+		if len(row) == 0 {
+			delete(c.rhymes, key)
+		}
+	}
+}
+
+// ---------- keyword index ----------
+
+// IndexKeywords adds messages to the guild's keyword index.
+func (m *MemoryStore) IndexKeywords(_ context.Context, guildID string, messages []string, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	docs, df := keywordCounts(messages, tok)
+	m.chain(guildID, true).addKeywords(docs, df, 1)
+	return nil
+}
+
+// UnindexKeywords removes one message from the guild's keyword index.
+func (m *MemoryStore) UnindexKeywords(_ context.Context, guildID, message string, tok Tokenizer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.chain(guildID, false); c != nil {
+		docs, df := keywordCounts([]string{message}, tok)
+		c.addKeywords(docs, df, -1)
+	}
+	return nil
+}
+
+// ReindexKeywords rebuilds the guild's keyword index from its chain (see
+// CacheRepository.ReindexKeywords).
+func (m *MemoryStore) ReindexKeywords(_ context.Context, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		return nil
+	}
+	clear(c.keywords)
+	c.docs = 0
+	df := make(map[string]int64)
+	for _, next := range c.states {
+		for t, n := range next {
+			if n > 0 && !isMarker(t) && isWordToken(t) {
+				df[t] += n
+			}
+		}
+	}
+	c.addKeywords(c.messages, df, 1)
+	return nil
+}
+
+// PickKeywords is pick_keywords: up to limit word tokens of text the chain
+// has a state for, rarest in the guild first.
+func (m *MemoryStore) PickKeywords(_ context.Context, guildID, text string, limit int, tok Tokenizer) ([]string, error) {
+	tokens, occurrences := keywordCandidates(text, tok)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil || len(tokens) == 0 {
+		return nil, nil
+	}
+	type scored struct {
+		token string
+		score float64
+	}
+	var ranked []scored
+	for _, t := range tokens {
+		df := c.keywords[t]
+		if _, ok := c.states[t]; !ok || df <= 0 {
+			continue
+		}
+		ranked = append(ranked, scored{t, float64(occurrences[t]) * math.Log(1+float64(c.docs)/float64(df))})
+	}
+	slices.SortFunc(ranked, func(a, b scored) int {
+		if n := cmp.Compare(b.score, a.score); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.token, b.token)
+	})
+	keywords := make([]string, 0, min(max(1, limit), len(ranked)))
+	for _, r := range ranked[:cap(keywords)] {
+		keywords = append(keywords, r.token)
+	}
+	return keywords, nil
+}
+
+func (c *memoryChain) addKeywords(docs int64, df map[string]int64, sign int64) {
+	c.docs = max(0, c.docs+sign*docs)
+	for t, n := range df {
+		if c.keywords[t] += sign * n; c.keywords[t] <= 0 {
+			delete(c.keywords, t)
+		}
+	}
+}
+
+// ---------- portability ----------
+
+// ExportChain writes the guild chain as a versioned dump to w (see
+// CacheRepository.ExportChain).
+func (m *MemoryStore) ExportChain(_ context.Context, guildID string, cfg *ChainConfig, w io.Writer) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.chain(guildID, false)
+	if c == nil {
+		c = &memoryChain{}
+	}
+	dw, err := newChainDumpWriter(w, guildID, cfg, c.messages)
+	if err != nil {
+		return err
+	}
+	for prefix, h := range c.states {
+		if err := dw.writeState(prefix, h); err != nil {
+			return err
+		}
+	}
+	for _, kind := range dumpMediaKinds {
+		urls := make([]string, 0, len(c.media[kind]))
+		for url := range c.media[kind] {
+			urls = append(urls, url)
+		}
+		if err := dw.writeMedia(kind, urls); err != nil {
+			return err
+		}
+	}
+	return dw.close()
+}
+
+// ImportChain applies a dump produced by ExportChain to the guild chain,
+// honouring opts' size and branching limits.
+func (m *MemoryStore) ImportChain(ctx context.Context, guildID string, src io.Reader, opts ImportOptions) (*ImportResult, error) {
+	return readChainDump(src, opts, chainDumpSink{
+		clear: func() error {
+			return m.ClearGuild(ctx, guildID)
+		},
+		train: func(pairs []string) (bool, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			limit := SizeLimit{MaxBytes: opts.MaxSizeBytes, Policy: opts.EvictionPolicy}
+			return m.trainPairs(guildID, pairs, 0, limit, opts.MaxBranches) == 1, nil
+		},
+		addMedia: func(kind string, urls []string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			c := m.chain(guildID, true)
+			if c.media[kind] == nil {
+				c.media[kind] = make(map[string]struct{})
+			}
+			for _, url := range urls {
+				c.media[kind][url] = struct{}{}
+			}
+			return nil
+		},
+		countMessages: func(n int64) (bool, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			limit := SizeLimit{MaxBytes: opts.MaxSizeBytes, Policy: opts.EvictionPolicy}
+			return m.trainPairs(guildID, nil, n, limit, opts.MaxBranches) == 1, nil
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestNextDistribution(t *testing.T) {
+	c := &memoryChain{states: map[string]map[string]int64{
+		"a b": {"c": 3},
+		"b":   {"c": 1, "d": 1},
+	}}
+	tests := []struct {
+		name      string
+		prefix    string
+		smoothing float64
+		want      map[string]int64
+	}{
+		{"backoff uses the longest suffix", "a b", 0, map[string]int64{"c": 3}},
+		{"backoff skips unknown suffixes", "x b", 0, map[string]int64{"c": 1, "d": 1}},
+		{"unknown prefix", "z", 0, nil},
+		// P(c) = (3-0.5)/3 + 0.5*1/3 * 1/2, P(d) = 0.5*1/3 * 1/2
+		{"interpolation mixes the orders", "a b", 0.5, map[string]int64{"c": 916666, "d": 83333}},
+		{"interpolation of one order keeps its counts", "x b", 0.5, map[string]int64{"c": 1, "d": 1}},
+		{"interpolation of an unknown prefix", "z", 0.5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.nextDistribution(tt.prefix, tt.smoothing); !maps.Equal(got, tt.want) {
+				t.Errorf("nextDistribution(%q, %g) = %v, want %v", tt.prefix, tt.smoothing, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNextDistributionKeepsRareSuccessors checks that interpolation never
+// rounds a known lower-order successor away.
+func TestNextDistributionKeepsRareSuccessors(t *testing.T) {
+	c := &memoryChain{states: map[string]map[string]int64{
+		"a b": {"c": 1000000},
+		"b":   {"c": 1000000, "d": 1},
+	}}
+	got := c.nextDistribution("a b", 0.1)
+	if got["d"] < 1 {
+		t.Errorf("nextDistribution dropped d: %v", got)
+	}
+	if got["c"] <= got["d"] {
+		t.Errorf("nextDistribution = %v, want c far above d", got)
+	}
+}
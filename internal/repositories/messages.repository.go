@@ -15,6 +15,9 @@ import (
 type Message struct {
 	ID        uint      `gorm:"primaryKey"`
 	GuildID   string    `gorm:"index"`
+	ChannelID string    `gorm:"index"` // empty for messages stored before channel tracking
+	AuthorID  string    `gorm:"index"` // empty for messages stored before author tracking
+	MessageID string    `gorm:"index"` // Discord message ID, shared by its attachments; empty for messages stored before ID tracking
 	Content   string    `gorm:"type:text"`
 	CreatedAt time.Time `gorm:"index"`
 }
@@ -83,14 +86,18 @@ func (repo *MessagesRepository) AppendMessage(guildID, content string) error {
 	return nil
 }
 
-// AddMessagesToGuild inserts multiple messages at once using batch inserts
-func (repo *MessagesRepository) AddMessagesToGuild(guildID string, messages []string) error {
+// AddMessagesToGuild inserts multiple messages from one channel at once using batch inserts.
+// Only Content, AuthorID and MessageID are read from messages.
+func (repo *MessagesRepository) AddMessagesToGuild(guildID, channelID string, messages []Message) error {
 	// Prepare a slice of Message objects
 	var messageRecords []Message
-	for _, content := range messages {
+	for _, m := range messages {
 		messageRecords = append(messageRecords, Message{
-			GuildID: guildID,
-			Content: content,
+			GuildID:   guildID,
+			ChannelID: channelID,
+			AuthorID:  m.AuthorID,
+			MessageID: m.MessageID,
+			Content:   m.Content,
 		})
 	}
 
@@ -189,6 +196,89 @@ func (repo *MessagesRepository) DeleteGuildMessage(guildID, content string) erro
 	return nil
 }
 
+// GetGuildMessagesByContent returns every stored copy of a message in a guild,
+// so callers can tell which channels and authors it was trained under.
+func (repo *MessagesRepository) GetGuildMessagesByContent(guildID, content string) ([]Message, error) {
+	var messages []Message
+	if err := repo.DB.Where("guild_id = ? AND content = ?", guildID, content).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetGuildMessagesByMessageIDs returns the stored rows (content and
+// attachments) of the given Discord messages.
+func (repo *MessagesRepository) GetGuildMessagesByMessageIDs(guildID string, messageIDs []string) ([]Message, error) {
+	var messages []Message
+	if len(messageIDs) == 0 {
+		return messages, nil
+	}
+	if err := repo.DB.Where("guild_id = ? AND message_id IN ?", guildID, messageIDs).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteGuildMessagesByMessageIDs removes every row stored for the given
+// Discord messages.
+func (repo *MessagesRepository) DeleteGuildMessagesByMessageIDs(guildID string, messageIDs []string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	if err := repo.DB.Where("guild_id = ? AND message_id IN ?", guildID, messageIDs).Delete(&Message{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// CountGuildMessagesByAuthor counts the stored messages (attachments
+// included) a member posted in a guild.
+func (repo *MessagesRepository) CountGuildMessagesByAuthor(guildID, authorID string) (int64, error) {
+	var count int64
+	if err := repo.DB.Model(&Message{}).Where("guild_id = ? AND author_id = ?", guildID, authorID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ScanGuildMessagesByAuthor streams a member's stored messages in
+// primary-key order. batchSize defaults to 500 if <= 0. fn may delete the
+// rows it is given: the scan resumes after the last ID seen.
+func (repo *MessagesRepository) ScanGuildMessagesByAuthor(guildID, authorID string, batchSize int, fn func(messages []Message) error) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	var lastID uint
+	for {
+		var rows []Message
+		q := repo.DB.Where("guild_id = ? AND author_id = ?", guildID, authorID)
+		if lastID > 0 {
+			q = q.Where("id > ?", lastID)
+		}
+		if err := q.Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		lastID = rows[len(rows)-1].ID
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteMessagesByIDs removes messages by primary key.
+func (repo *MessagesRepository) DeleteMessagesByIDs(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := repo.DB.Delete(&Message{}, ids).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
 // DeleteGuildMessagesContaining removes all messages for a specific guild
 // that contain the given content (substring match).
 func (repo *MessagesRepository) DeleteGuildMessagesContaining(guildID, content string) error {
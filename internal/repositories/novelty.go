@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// The novelty index fingerprints every stored message (whole, and each run of
+// runLength consecutive tokens) so generated text can be checked for verbatim
+// copies without scanning the message store. Fingerprints are 64-bit FNV-1a
+// hashes of the lower-cased tokens, split by the chain's tokenizer; a
+// collision only costs a regeneration.
+
+// noveltyFingerprints returns the whole-text fingerprint followed by one per
+// run of runLength tokens, in token order. Runs are omitted when the text is
+// shorter than runLength.
+func noveltyFingerprints(text string, runLength int, tok Tokenizer) []string {
+	tokens := tok.Tokenize(strings.ToLower(text))
+	if len(tokens) == 0 || runLength <= 0 {
+		return nil
+	}
+	fps := make([]string, 0, 1+max(0, len(tokens)-runLength+1))
+	// Sentence markers keep the whole-text fingerprint apart from a run of
+	// the same tokens.
+	fps = append(fps, fingerprint(tokenBOS+strings.Join(tokens, " ")+tokenEOS))
+	for i := 0; i+runLength <= len(tokens); i++ {
+		fps = append(fps, fingerprint(strings.Join(tokens[i:i+runLength], " ")))
+	}
+	return fps
+}
+
+func fingerprint(s string) string {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// copiedRunStart interprets novelty matches for noveltyFingerprints(text):
+// the token index where the earliest copied run starts, 0 when only the whole
+// text matches a stored message, or -1 when the text is novel.
+func copiedRunStart(matches []bool) int {
+	for i := 1; i < len(matches); i++ {
+		if matches[i] {
+			return i - 1
+		}
+	}
+	if len(matches) > 0 && matches[0] {
+		return 0
+	}
+	return -1
+}
+
+// IndexNovelty adds messages to the guild's novelty index.
+func (r *CacheRepository) IndexNovelty(ctx context.Context, guildID string, messages []string, runLength int, tok Tokenizer) error {
+	return r.noveltyAdd(ctx, guildID, messages, runLength, 1, tok)
+}
+
+// UnindexNovelty removes one copy of a message from the guild's novelty index.
+func (r *CacheRepository) UnindexNovelty(ctx context.Context, guildID, message string, runLength int, tok Tokenizer) error {
+	return r.noveltyAdd(ctx, guildID, []string{message}, runLength, -1, tok)
+}
+
+func (r *CacheRepository) noveltyAdd(ctx context.Context, guildID string, messages []string, runLength, delta int, tok Tokenizer) error {
+	const maxFingerprintsPerCall = 4096
+
+	args := make([]string, 0, 512)
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		argv := append([]string{strconv.Itoa(delta)}, args...)
+		err := r.runWriteFCall(ctx, guildID, "novelty_add", func(c context.Context) error {
+			return r.doFCall(c, "novelty_add", []string{guildID}, argv).Error()
+		})
+		args = args[:0]
+		return err
+	}
+	for _, msg := range messages {
+		args = append(args, noveltyFingerprints(msg, runLength, tok)...)
+		if len(args) >= maxFingerprintsPerCall {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// FindCopiedRun checks generated text against the guild's novelty index.
+// It returns the token index where the earliest run of runLength tokens
+// copied from one stored message starts, 0 when the whole text equals a
+// stored message, or -1 when the text is novel.
+func (r *CacheRepository) FindCopiedRun(ctx context.Context, guildID, text string, runLength int, tok Tokenizer) (int, error) {
+	fps := noveltyFingerprints(text, runLength, tok)
+	if len(fps) == 0 {
+		return -1, nil
+	}
+	var matches []bool
+	err := r.runWithCacheReadRetry(ctx, guildID, "novelty_match", func(c context.Context) error {
+		arr, e := r.doFCall(c, "novelty_match", []string{guildID}, fps).ToArray()
+		if e != nil {
+			return e
+		}
+		matches = make([]bool, len(arr))
+		for i, msg := range arr {
+			v, e := msg.AsInt64()
+			if e != nil {
+				return e
+			}
+			matches[i] = v == 1
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return copiedRunStart(matches), nil
+}
+
+// ClearNovelty drops the guild's novelty index. ClearGuild already covers it.
+func (r *CacheRepository) ClearNovelty(ctx context.Context, guildID string) error {
+	return r.runWriteFCall(ctx, guildID, "novelty_clear", func(c context.Context) error {
+		return r.fcallErr(c, "novelty_clear", []string{guildID})
+	})
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// ImitationOptOut records a member who refused to be imitated in a guild.
+type ImitationOptOut struct {
+	GuildID   string    `gorm:"primaryKey"`
+	UserID    string    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// OptOutsRepository persists /imitate opt-outs in SQLite.
+type OptOutsRepository struct {
+	DB *gorm.DB
+}
+
+func NewOptOutsRepository(dbPath string) (*OptOutsRepository, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&ImitationOptOut{}); err != nil {
+		return nil, err
+	}
+	return &OptOutsRepository{DB: db}, nil
+}
+
+// IsOptedOut reports whether the member refused to be imitated in the guild.
+func (repo *OptOutsRepository) IsOptedOut(guildID, userID string) (bool, error) {
+	var count int64
+	if err := repo.DB.Model(&ImitationOptOut{}).Where("guild_id = ? AND user_id = ?", guildID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// OptedOutAmong returns the subset of userIDs that opted out in the guild.
+func (repo *OptOutsRepository) OptedOutAmong(guildID string, userIDs []string) (map[string]bool, error) {
+	var ids []string
+	if err := repo.DB.Model(&ImitationOptOut{}).
+		Where("guild_id = ? AND user_id IN ?", guildID, userIDs).
+		Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		out[id] = true
+	}
+	return out, nil
+}
+
+// OptOut adds the member to the guild's opt-out list; repeating it is a no-op.
+func (repo *OptOutsRepository) OptOut(guildID, userID string) error {
+	return repo.DB.FirstOrCreate(&ImitationOptOut{}, ImitationOptOut{GuildID: guildID, UserID: userID}).Error
+}
+
+// OptIn removes the member from the guild's opt-out list.
+func (repo *OptOutsRepository) OptIn(guildID, userID string) error {
+	return repo.DB.Delete(&ImitationOptOut{}, "guild_id = ? AND user_id = ?", guildID, userID).Error
+}
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+	"rolando/internal/rhyme"
+)
+
+// The rhyme index maps each rhyme key (see internal/rhyme) to the tokens
+// trained with it and their counts, so generate_rhyme can tell which
+// successors rhyme without computing phonetics in Lua. Keys depend on the
+// chain's language: changing it means rebuilding the index with ReindexRhymes.
+
+// rhymeCounts aggregates token occurrences of messages by rhyme key. Tokens
+// without a rhyme key (no vowel, markers) are skipped.
+func rhymeCounts(messages []string, lang string, tok Tokenizer) map[string]map[string]int64 {
+	counts := make(map[string]map[string]int64)
+	for _, msg := range messages {
+		for _, t := range tok.Tokenize(msg) {
+			addRhyme(counts, t, lang, 1)
+		}
+	}
+	return counts
+}
+
+func addRhyme(counts map[string]map[string]int64, token, lang string, n int64) {
+	if isMarker(token) {
+		return
+	}
+	key := rhyme.Key(token, lang)
+	if key == "" {
+		return
+	}
+	if counts[key] == nil {
+		counts[key] = make(map[string]int64)
+	}
+	counts[key][token] += n
+}
+
+// IndexRhymes adds the tokens of messages to the guild's rhyme index.
+func (r *CacheRepository) IndexRhymes(ctx context.Context, guildID string, messages []string, lang string, tok Tokenizer) error {
+	return r.rhymeAdd(ctx, guildID, rhymeCounts(messages, lang, tok), 1)
+}
+
+// UnindexRhymes removes the tokens of one message from the guild's rhyme index.
+func (r *CacheRepository) UnindexRhymes(ctx context.Context, guildID, message, lang string, tok Tokenizer) error {
+	return r.rhymeAdd(ctx, guildID, rhymeCounts([]string{message}, lang, tok), -1)
+}
+
+func (r *CacheRepository) rhymeAdd(ctx context.Context, guildID string, counts map[string]map[string]int64, sign int64) error {
+	const maxTriplesPerCall = 2048
+
+	args := make([]string, 0, 3*256)
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		err := r.runWriteFCall(ctx, guildID, "rhyme_add", func(c context.Context) error {
+			return r.doFCall(c, "rhyme_add", []string{guildID}, args).Error()
+		})
+		args = args[:0]
+		return err
+	}
+	for key, tokens := range counts {
+		for t, n := range tokens {
+			args = append(args, key, t, strconv.FormatInt(sign*n, 10))
+			if len(args) >= 3*maxTriplesPerCall {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return flush()
+}
+
+// ReindexRhymes rebuilds the guild's rhyme index for lang from the successors
+// of its forward transitions, weighted by their counts.
+func (r *CacheRepository) ReindexRhymes(ctx context.Context, guildID, lang string) error {
+	if err := r.runWriteFCall(ctx, guildID, "rhyme_clear", func(c context.Context) error {
+		return r.fcallErr(c, "rhyme_clear", []string{guildID})
+	}); err != nil {
+		return err
+	}
+
+	const stateBatchSize = 200
+	cursor := "0"
+	for {
+		var raw []valkey.ValkeyMessage
+		err := r.runWithCacheReadRetry(ctx, guildID, "export_states_batch", func(c context.Context) error {
+			var e error
+			raw, e = r.fcallArray(c, "export_states_batch", []string{guildID}, cursor, stateBatchSize)
+			return e
+		})
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		nextCursor, rows, err := parseCursorRows(raw)
+		if err != nil {
+			return fmt.Errorf("export_states_batch: %w", err)
+		}
+		counts := make(map[string]map[string]int64)
+		for _, row := range rows {
+			for i := 1; i+1 < len(row); i += 2 {
+				n, err := strconv.ParseInt(row[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					continue
+				}
+				addRhyme(counts, row[i], lang, n)
+			}
+		}
+		if err := r.rhymeAdd(ctx, guildID, counts, 1); err != nil {
+			return err
+		}
+		cursor = nextCursor
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// rhymeTarget returns the rhyme key of rhymeWord's last token and the token
+// itself lower-cased, which generate_rhyme never offers as its own rhyme.
+func rhymeTarget(rhymeWord, lang string) (key, word string) {
+	fields := strings.Fields(rhymeWord)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	word = strings.ToLower(fields[len(fields)-1])
+	return rhyme.Key(word, lang), word
+}
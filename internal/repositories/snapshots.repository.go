@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// snapshotExt is appended to every snapshot file; the name before it is the
+// UTC creation time, so lexical order is chronological order.
+const (
+	snapshotExt        = ".chain.ndjson"
+	snapshotTimeLayout = "20060102T150405Z"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot describes one chain dump stored on disk.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SnapshotsRepository keeps chain dumps (see ExportChain) in a local
+// directory, one subdirectory per guild, pruned to the newest Retention files.
+type SnapshotsRepository struct {
+	Dir       string
+	Retention int
+}
+
+func NewSnapshotsRepository(dir string, retention int) (*SnapshotsRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &SnapshotsRepository{Dir: dir, Retention: retention}, nil
+}
+
+// guildDir returns the directory holding a guild's snapshots, refusing ids
+// that would escape the snapshot directory.
+func (repo *SnapshotsRepository) guildDir(guildID string) (string, error) {
+	if guildID == "" || guildID != filepath.Base(guildID) || strings.HasPrefix(guildID, ".") {
+		return "", fmt.Errorf("invalid chain id %q", guildID)
+	}
+	return filepath.Join(repo.Dir, guildID), nil
+}
+
+// Create writes a new snapshot with write, then prunes the guild's oldest
+// snapshots beyond the retention count. The dump goes to a temporary file
+// first so a failed or interrupted export never shows up as a snapshot.
+func (repo *SnapshotsRepository) Create(guildID string, write func(w io.Writer) error) (*Snapshot, error) {
+	dir, err := repo.guildDir(guildID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	name := now.Format(snapshotTimeLayout) + snapshotExt
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return nil, err
+	}
+
+	if err := repo.prune(guildID); err != nil {
+		return nil, fmt.Errorf("prune: %w", err)
+	}
+	return &Snapshot{Name: name, Size: info.Size(), CreatedAt: now.Truncate(time.Second)}, nil
+}
+
+// List returns a guild's snapshots, newest first.
+func (repo *SnapshotsRepository) List(guildID string) ([]Snapshot, error) {
+	dir, err := repo.guildDir(guildID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		createdAt, ok := parseSnapshotName(e.Name())
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Name: e.Name(), Size: info.Size(), CreatedAt: createdAt})
+	}
+	slices.SortFunc(snapshots, func(a, b Snapshot) int {
+		return strings.Compare(b.Name, a.Name)
+	})
+	return snapshots, nil
+}
+
+// Open returns a reader over a guild snapshot by name; "latest" picks the
+// newest one.
+func (repo *SnapshotsRepository) Open(guildID, name string) (io.ReadCloser, *Snapshot, error) {
+	snapshots, err := repo.List(guildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx := slices.IndexFunc(snapshots, func(s Snapshot) bool { return s.Name == name })
+	if name == "latest" && len(snapshots) > 0 {
+		idx = 0
+	}
+	if idx < 0 {
+		return nil, nil, ErrSnapshotNotFound
+	}
+	dir, _ := repo.guildDir(guildID)
+	f, err := os.Open(filepath.Join(dir, snapshots[idx].Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, &snapshots[idx], nil
+}
+
+// prune deletes a guild's snapshots beyond the newest Retention ones. A
+// retention of 0 or less keeps everything.
+func (repo *SnapshotsRepository) prune(guildID string) error {
+	if repo.Retention <= 0 {
+		return nil
+	}
+	snapshots, err := repo.List(guildID)
+	if err != nil || len(snapshots) <= repo.Retention {
+		return err
+	}
+	dir, _ := repo.guildDir(guildID)
+	for _, s := range snapshots[repo.Retention:] {
+		if err := os.Remove(filepath.Join(dir, s.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSnapshotName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutSuffix(name, snapshotExt)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(snapshotTimeLayout, stamp)
+	return t, err == nil
+}
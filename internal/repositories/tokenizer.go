@@ -0,0 +1,234 @@
+package repositories
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits messages into chain tokens and joins generated tokens back
+// into text. Tokens never contain whitespace: the cache side stores prefixes
+// as space-joined tokens, so every store method and Lua function keeps working
+// unchanged whichever tokenizer produced them. Stores return generated text
+// space-joined as well; callers detokenize it.
+type Tokenizer interface {
+	Tokenize(text string) []string
+	Detokenize(tokens []string) string
+}
+
+// Tokenizer names, selectable per chain.
+const (
+	// TokenizerWhitespace splits on whitespace only; punctuation stays
+	// glued to words.
+	TokenizerWhitespace = "whitespace"
+	// TokenizerPunct splits punctuation off words and re-attaches it on
+	// output.
+	TokenizerPunct = "punct"
+	// TokenizerCJK is TokenizerPunct plus one token per character (or
+	// combining cluster) in Chinese and Japanese text, where a character
+	// often is a word on its own.
+	TokenizerCJK = "cjk"
+)
+
+// IsTokenizer reports whether name is a known tokenizer.
+func IsTokenizer(name string) bool {
+	switch name {
+	case TokenizerWhitespace, TokenizerPunct, TokenizerCJK:
+		return true
+	}
+	return false
+}
+
+// NewTokenizer returns the named tokenizer, falling back to whitespace
+// splitting for unknown names.
+func NewTokenizer(name string) Tokenizer {
+	switch name {
+	case TokenizerPunct:
+		return punctTokenizer{}
+	case TokenizerCJK:
+		return punctTokenizer{splitScripts: true}
+	default:
+		return whitespaceTokenizer{}
+	}
+}
+
+type whitespaceTokenizer struct{}
+
+func (whitespaceTokenizer) Tokenize(text string) []string { return tokenize(text) }
+
+func (whitespaceTokenizer) Detokenize(tokens []string) string { return strings.Join(tokens, " ") }
+
+// reAtomicToken matches tokens that are never split: URLs (so media keeps
+// working), Discord mentions and custom emoji.
+var reAtomicToken = regexp.MustCompile(`https?://\S+|<a?:\w+:\d+>|<(?:@[!&]?|#)\d+>`)
+
+type punctTokenizer struct {
+	splitScripts bool
+}
+
+func (t punctTokenizer) Tokenize(text string) []string {
+	out := make([]string, 0, 16)
+	for _, field := range strings.Fields(text) {
+		last := 0
+		for _, loc := range reAtomicToken.FindAllStringIndex(field, -1) {
+			// A URL followed by punctuation ("see https://x.com/a.gif,")
+			// does not own it.
+			atom := strings.TrimRight(field[loc[0]:loc[1]], ".,!?;:)]}'\"")
+			out = t.segment(field[last:loc[0]], out)
+			out = append(out, atom)
+			last = loc[0] + len(atom)
+		}
+		out = t.segment(field[last:], out)
+	}
+	return out
+}
+
+// segment splits one whitespace-free run into word, punctuation, symbol and
+// (with splitScripts) per-character tokens.
+func (t punctTokenizer) segment(s string, out []string) []string {
+	const (
+		none = iota
+		word
+		punct
+		symbol
+		script
+	)
+	var (
+		cur  strings.Builder
+		kind = none
+		prev rune
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+		kind = none
+	}
+	start := func(k int, r rune) {
+		flush()
+		kind = k
+		cur.WriteRune(r)
+	}
+
+	for i, r := range s {
+		switch {
+		case unicode.IsControl(r):
+			flush()
+		case unicode.IsMark(r) || r == '‍':
+			// Combining marks, variation selectors and joiners extend
+			// whatever precedes them.
+			if kind == none {
+				start(symbol, r)
+			} else {
+				cur.WriteRune(r)
+			}
+		case t.splitScripts && isUnspacedScript(r):
+			start(script, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if kind != word {
+				flush()
+				kind = word
+			}
+			cur.WriteRune(r)
+		case kind == word && isWordJoiner(r) && followedByWordRune(s[i+utf8.RuneLen(r):]):
+			// Keep don't, e-mail and 3.14 whole.
+			cur.WriteRune(r)
+		case unicode.IsPunct(r):
+			// Runs of the same mark ("...", "!!!") stay one token.
+			if kind != punct || prev != r {
+				flush()
+				kind = punct
+			}
+			cur.WriteRune(r)
+		default:
+			if kind != symbol {
+				flush()
+				kind = symbol
+			}
+			cur.WriteRune(r)
+		}
+		prev = r
+	}
+	flush()
+	return out
+}
+
+func (t punctTokenizer) Detokenize(tokens []string) string {
+	var b strings.Builder
+	quoteOpen := map[string]bool{}
+	glueNext := true // no space before the first token
+	prevScript := false
+	for _, tok := range tokens {
+		r, _ := utf8.DecodeRuneInString(tok)
+		space := !glueNext
+		glueNext = false
+
+		switch {
+		case isQuoteToken(tok):
+			if quoteOpen[tok] {
+				space = false
+			} else {
+				glueNext = true
+			}
+			quoteOpen[tok] = !quoteOpen[tok]
+		case isClosingPunct(r):
+			space = false
+		case isOpeningPunct(r):
+			glueNext = true
+		}
+
+		// Full-width punctuation carries its own spacing.
+		if isFullwidthPunct(r) {
+			space = false
+			glueNext = true
+		}
+		script := t.splitScripts && isUnspacedScript(r)
+		if script && prevScript {
+			space = false
+		}
+		prevScript = script
+
+		if space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok)
+	}
+	return b.String()
+}
+
+// isUnspacedScript reports whether r belongs to a script written without
+// spaces between words and split one character per token. Thai, Lao, Khmer
+// and Myanmar are unspaced too, but alphabetic: one letter per token would
+// make a character-level chain that only produces gibberish, so their runs
+// stay whole like words of any other script.
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+func isFullwidthPunct(r rune) bool {
+	return (r >= 0x3000 && r <= 0x303f) || (r >= 0xff01 && r <= 0xff0f) ||
+		(r >= 0xff1a && r <= 0xff20) || (r >= 0xff3b && r <= 0xff40) || (r >= 0xff5b && r <= 0xff65)
+}
+
+func isWordJoiner(r rune) bool {
+	return r == '\'' || r == '’' || r == '-' || r == '.' || r == '_'
+}
+
+func followedByWordRune(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isQuoteToken(tok string) bool {
+	return tok == `"` || tok == "'"
+}
+
+func isClosingPunct(r rune) bool {
+	return strings.ContainsRune(".,!?;:)]}%…»”’", r)
+}
+
+func isOpeningPunct(r rune) bool {
+	return strings.ContainsRune("([{¿¡«“‘", r)
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenizer string
+		text      string
+		want      []string
+	}{
+		{"whitespace keeps punctuation", TokenizerWhitespace, "hello, world!", []string{"hello,", "world!"}},
+		{"punct splits punctuation", TokenizerPunct, "hello, world!", []string{"hello", ",", "world", "!"}},
+		{"punct keeps contractions", TokenizerPunct, "don't e-mail 3.14", []string{"don't", "e-mail", "3.14"}},
+		{"punct keeps repeated marks", TokenizerPunct, "wait...", []string{"wait", "..."}},
+		{"punct keeps urls", TokenizerPunct, "see https://x.com/a.gif, ok", []string{"see", "https://x.com/a.gif", ",", "ok"}},
+		{"punct keeps mentions", TokenizerPunct, "hi <@123>!", []string{"hi", "<@123>", "!"}},
+		{"cjk splits han", TokenizerCJK, "我喜欢猫", []string{"我", "喜", "欢", "猫"}},
+		{"cjk splits kana", TokenizerCJK, "ネコが好き", []string{"ネ", "コ", "が", "好", "き"}},
+		{"cjk keeps thai whole", TokenizerCJK, "สวัสดี", []string{"สวัสดี"}},
+		{"cjk keeps latin words", TokenizerCJK, "hello 世界", []string{"hello", "世", "界"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewTokenizer(tt.tokenizer).Tokenize(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			for _, tok := range got {
+				if strings.ContainsAny(tok, " \t\n") {
+					t.Errorf("token %q contains whitespace", tok)
+				}
+			}
+		})
+	}
+}
+
+// TestTokenizerRoundTrip checks that detokenizing the tokens of normally
+// spaced text gives the text back.
+func TestTokenizerRoundTrip(t *testing.T) {
+	tests := []struct {
+		tokenizer string
+		text      string
+	}{
+		{TokenizerWhitespace, "hello, world!"},
+		{TokenizerWhitespace, "a  b\tc"},
+		{TokenizerPunct, "hello, world!"},
+		{TokenizerPunct, "well... I don't know (maybe)."},
+		{TokenizerPunct, `she said "hi" and left`},
+		{TokenizerPunct, "¿qué tal? ¡bien!"},
+		{TokenizerPunct, "see https://x.com/a.gif, ok"},
+		{TokenizerCJK, "我喜欢猫。"},
+		{TokenizerCJK, "ネコが好き、です"},
+		{TokenizerCJK, "hello 世界"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tokenizer+"/"+tt.text, func(t *testing.T) {
+			tok := NewTokenizer(tt.tokenizer)
+			want := strings.Join(strings.Fields(tt.text), " ")
+			if got := tok.Detokenize(tok.Tokenize(tt.text)); got != want {
+				t.Errorf("round trip of %q = %q, want %q", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestNewTokenizerFallsBackToWhitespace(t *testing.T) {
+	if IsTokenizer("nope") {
+		t.Fatal(`IsTokenizer("nope") = true`)
+	}
+	got := NewTokenizer("nope").Tokenize("a, b")
+	if want := []string{"a,", "b"}; !slices.Equal(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
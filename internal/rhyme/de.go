@@ -0,0 +1,82 @@
+package rhyme
+
+// German stresses the stem, so the rhyme runs from the last vowel that is not
+// part of an unstressed ending (-e, -en, -er, -el, ...): "sagen" rhymes with
+// "fragen" and "Liebe" with "Triebe". Final consonants are devoiced, so "Rad"
+// rhymes with "Rat".
+
+func init() {
+	register("de", &language{
+		rules: []rule{
+			{graph: "tsch", out: ph(cons("C"))},
+			{graph: "sch", out: ph(cons("S"))},
+			{graph: "chs", out: ph(cons("k"), cons("s"))},
+			{graph: "ieh", out: ph(vow("I"))},
+			{graph: "ig", final: true, out: ph(vow("i"), cons("x"))},
+			{graph: "en", final: true, out: ph(weak("@", "e"), cons("n"))},
+			{graph: "er", final: true, out: ph(weak("6", "ER"))},
+			{graph: "el", final: true, out: ph(weak("@", "e"), cons("l"))},
+			{graph: "em", final: true, out: ph(weak("@", "e"), cons("m"))},
+			{graph: "es", final: true, out: ph(weak("@", "e"), cons("s"))},
+			{graph: "et", final: true, out: ph(weak("@", "e"), cons("t"))},
+			{graph: "e", final: true, out: ph(weak("@", "E"))},
+
+			{graph: "ie", out: ph(vow("I"))},
+			{graph: "ei", out: ph(vow("AI"))},
+			{graph: "ai", out: ph(vow("AI"))},
+			{graph: "ey", out: ph(vow("AI"))},
+			{graph: "ay", out: ph(vow("AI"))},
+			{graph: "eu", out: ph(vow("OY"))},
+			{graph: "äu", out: ph(vow("OY"))},
+			{graph: "au", out: ph(vow("AU"))},
+			{graph: "aa", out: ph(vow("A"))},
+			{graph: "ah", out: ph(vow("A"))},
+			{graph: "ee", out: ph(vow("E"))},
+			{graph: "eh", out: ph(vow("E"))},
+			{graph: "äh", out: ph(vow("E"))},
+			{graph: "ih", out: ph(vow("I"))},
+			{graph: "oo", out: ph(vow("O"))},
+			{graph: "oh", out: ph(vow("O"))},
+			{graph: "öh", out: ph(vow("2"))},
+			{graph: "uh", out: ph(vow("U"))},
+			{graph: "üh", out: ph(vow("Y"))},
+			{graph: "ch", out: ph(cons("x"))},
+			{graph: "ck", out: ph(cons("k"))},
+			{graph: "tz", out: ph(cons("ts"))},
+			{graph: "dt", out: ph(cons("t"))},
+			{graph: "ph", out: ph(cons("f"))},
+			{graph: "th", out: ph(cons("t"))},
+			{graph: "qu", out: ph(cons("k"), cons("v"))},
+			{graph: "ng", out: ph(cons("N"))},
+			{graph: "nk", out: ph(cons("N"), cons("k"))},
+
+			{graph: "a", out: ph(vow("a"))},
+			{graph: "e", out: ph(vow("e"))},
+			{graph: "i", out: ph(vow("i"))},
+			{graph: "o", out: ph(vow("o"))},
+			{graph: "u", out: ph(vow("u"))},
+			{graph: "ä", out: ph(vow("e"))},
+			{graph: "ö", out: ph(vow("2"))},
+			{graph: "ü", out: ph(vow("y"))},
+			{graph: "y", out: ph(vow("y"))},
+			{graph: "ß", out: ph(cons("s"))},
+			{graph: "z", out: ph(cons("ts"))},
+			{graph: "v", out: ph(cons("f"))},
+			{graph: "w", out: ph(cons("v"))},
+			{graph: "x", out: ph(cons("k"), cons("s"))},
+			{graph: "h", out: nil},
+		},
+		stress: germanStress,
+	})
+}
+
+var devoiced = map[string]string{"b": "p", "d": "t", "g": "k", "v": "f"}
+
+func germanStress(w string, phones []phone) int {
+	if n := len(phones); n > 0 {
+		if d, ok := devoiced[phones[n-1].sym]; ok && !phones[n-1].vowel {
+			phones[n-1].sym = d
+		}
+	}
+	return lastStrongVowel(w, phones)
+}
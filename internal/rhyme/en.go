@@ -0,0 +1,145 @@
+package rhyme
+
+import "regexp"
+
+// English spelling is too irregular for rules alone: common words whose
+// endings defy them are listed outright, and a silent final e lengthens the
+// vowel before it ("make", "rhyme", "cute").
+
+var reMagicE = regexp.MustCompile(`(^|[^aeiouy])([aeiouy])(th|ch|[bcdfgklmnpstvz])e([sd]?)$`)
+
+var magicVowels = map[string]string{"a": "A", "e": "E", "i": "I", "o": "O", "u": "U", "y": "I"}
+
+func prepareEnglish(w string) string {
+	return reMagicE.ReplaceAllStringFunc(w, func(m string) string {
+		sub := reMagicE.FindStringSubmatch(m)
+		consonant := sub[3]
+		switch consonant {
+		case "c":
+			consonant = "s"
+		case "g":
+			consonant = "j"
+		}
+		return sub[1] + magicVowels[sub[2]] + consonant + sub[4]
+	})
+}
+
+func init() {
+	register("en", &language{
+		exceptions: map[string]string{
+			"you": "U", "do": "U", "to": "U", "two": "U", "too": "U", "who": "U", "shoe": "U", "through": "U",
+			"though": "O", "although": "O", "dough": "O",
+			"rough": "uf", "tough": "uf", "enough": "uf", "cough": "of", "trough": "of",
+			"bough": "AW", "plough": "AW", "how": "AW", "now": "AW", "cow": "AW", "wow": "AW",
+			"allow": "AW", "vow": "AW", "brow": "AW",
+			"own": "On", "known": "On", "shown": "On", "grown": "On", "blown": "On", "flown": "On",
+			"one": "un", "done": "un", "none": "un", "won": "un",
+			"come": "um", "some": "um", "love": "uv", "above": "uv", "glove": "uv",
+			"have": "av", "give": "iv", "live": "iv", "gone": "on",
+			"are": "AR", "heart": "ARt",
+			"were": "ER", "where": "ER", "there": "ER", "their": "ER", "theyre": "ER",
+			"bear": "ER", "wear": "ER", "pear": "ER", "swear": "ER",
+			"word": "ERd", "work": "ERk", "world": "ERld", "worse": "ERs", "worth": "ERT",
+			"our": "AWR", "hour": "AWR", "flour": "AWR", "sour": "AWR",
+			"they": "A", "hey": "A", "eye": "I", "buy": "I", "guy": "I", "bye": "I", "hi": "I",
+			"said": "ed", "says": "es", "again": "en",
+		},
+		prepare: prepareEnglish,
+		rules: []rule{
+			// Long vowels left by prepareEnglish.
+			{graph: "A", out: ph(vow("A"))},
+			{graph: "E", out: ph(vow("E"))},
+			{graph: "I", out: ph(vow("I"))},
+			{graph: "O", out: ph(vow("O"))},
+			{graph: "U", out: ph(vow("U"))},
+
+			{graph: "eigh", out: ph(vow("A"))},
+			{graph: "augh", out: ph(vow("O"))},
+			{graph: "ough", out: ph(vow("O"))},
+			{graph: "tion", out: ph(cons("S"), weak("@", ""), cons("n"))},
+			{graph: "sion", out: ph(cons("S"), weak("@", ""), cons("n"))},
+			{graph: "cian", out: ph(cons("S"), weak("@", ""), cons("n"))},
+			{graph: "ness", final: true, out: ph(cons("n"), weak("@", "e"), cons("s"))},
+			{graph: "less", final: true, out: ph(cons("l"), weak("@", "e"), cons("s"))},
+			{graph: "ment", final: true, out: ph(cons("m"), weak("@", "e"), cons("n"), cons("t"))},
+			{graph: "igh", out: ph(vow("I"))},
+			{graph: "ing", final: true, out: ph(weak("i", ""), cons("N"))},
+			{graph: "ful", final: true, out: ph(cons("f"), weak("@", "u"), cons("l"))},
+			{graph: "ous", final: true, out: ph(weak("@", "U"), cons("s"))},
+			{graph: "ear", out: ph(vow("IR"))},
+			{graph: "eer", out: ph(vow("IR"))},
+			{graph: "ere", final: true, out: ph(vow("IR"))},
+			{graph: "air", out: ph(vow("ER"))},
+			{graph: "are", final: true, out: ph(vow("ER"))},
+			{graph: "ire", final: true, out: ph(vow("I"), cons("R"))},
+			{graph: "ore", final: true, out: ph(vow("OR"))},
+			{graph: "oor", out: ph(vow("OR"))},
+			{graph: "our", out: ph(vow("OR"))},
+			{graph: "tch", out: ph(cons("C"))},
+			{graph: "dge", out: ph(cons("j"))},
+
+			{graph: "ee", out: ph(vow("E"))},
+			{graph: "ea", out: ph(vow("E"))},
+			{graph: "ie", final: true, out: ph(vow("I"))},
+			{graph: "ie", out: ph(vow("E"))},
+			{graph: "ei", out: ph(vow("E"))},
+			{graph: "ey", final: true, out: ph(weak("E", ""))},
+			{graph: "ai", out: ph(vow("A"))},
+			{graph: "ay", out: ph(vow("A"))},
+			{graph: "oa", out: ph(vow("O"))},
+			{graph: "oe", out: ph(vow("O"))},
+			{graph: "ow", final: true, out: ph(vow("O"))},
+			{graph: "ow", out: ph(vow("AW"))},
+			{graph: "ou", out: ph(vow("AW"))},
+			{graph: "oo", out: ph(vow("U"))},
+			{graph: "ew", out: ph(vow("U"))},
+			{graph: "ue", out: ph(vow("U"))},
+			{graph: "ui", out: ph(vow("U"))},
+			{graph: "au", out: ph(vow("O"))},
+			{graph: "aw", out: ph(vow("O"))},
+			{graph: "oi", out: ph(vow("OY"))},
+			{graph: "oy", out: ph(vow("OY"))},
+			{graph: "ar", out: ph(vow("AR"))},
+			{graph: "or", out: ph(vow("OR"))},
+			{graph: "er", final: true, out: ph(weak("ER", ""))},
+			{graph: "er", out: ph(vow("ER"))},
+			{graph: "ir", out: ph(vow("ER"))},
+			{graph: "ur", out: ph(vow("ER"))},
+			{graph: "le", final: true, out: ph(weak("@", ""), cons("l"))},
+			{graph: "ly", final: true, out: ph(cons("l"), weak("E", "I"))},
+			{graph: "ic", final: true, out: ph(weak("i", ""), cons("k"))},
+			{graph: "ch", out: ph(cons("C"))},
+			{graph: "sh", out: ph(cons("S"))},
+			{graph: "th", out: ph(cons("T"))},
+			{graph: "ph", out: ph(cons("f"))},
+			{graph: "wh", out: ph(cons("w"))},
+			{graph: "ck", out: ph(cons("k"))},
+			{graph: "qu", out: ph(cons("k"), cons("w"))},
+			{graph: "ng", out: ph(cons("N"))},
+			{graph: "nk", out: ph(cons("N"), cons("k"))},
+			{graph: "mb", final: true, out: ph(cons("m"))},
+			{graph: "gh", out: nil},
+			{graph: "kn", out: ph(cons("n"))},
+			{graph: "wr", out: ph(cons("r"))},
+
+			{graph: "a", final: true, out: ph(weak("@", "A"))},
+			{graph: "a", out: ph(vow("a"))},
+			{graph: "e", final: true, out: ph(weak("", "E"))},
+			{graph: "e", out: ph(vow("e"))},
+			{graph: "i", final: true, out: ph(weak("E", "I"))},
+			{graph: "i", out: ph(vow("i"))},
+			{graph: "o", final: true, out: ph(vow("O"))},
+			{graph: "o", out: ph(vow("o"))},
+			{graph: "u", out: ph(vow("u"))},
+			{graph: "y", before: "aeiou", out: ph(cons("y"))},
+			{graph: "y", final: true, out: ph(weak("E", "I"))},
+			{graph: "y", out: ph(vow("i"))},
+			{graph: "c", before: "eiy", out: ph(cons("s"))},
+			{graph: "c", out: ph(cons("k"))},
+			{graph: "g", before: "eiy", out: ph(cons("j"))},
+			{graph: "x", out: ph(cons("k"), cons("s"))},
+			{graph: "z", out: ph(cons("s"))},
+		},
+		stress: lastStrongVowel,
+	})
+}
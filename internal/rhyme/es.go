@@ -0,0 +1,61 @@
+package rhyme
+
+import "strings"
+
+// Spanish follows its written stress rules: an accent marks the stressed
+// vowel, otherwise words ending in a vowel, n or s stress the penultimate
+// vowel and all others the last. c/z and ll/y are merged as in most of the
+// Spanish-speaking world.
+
+func init() {
+	register("es", &language{
+		rules: []rule{
+			{graph: "gü", out: ph(cons("g"), cons("w"))},
+			{graph: "gu", before: "eiéí", out: ph(cons("g"))},
+			{graph: "qu", out: ph(cons("k"))},
+			{graph: "ch", out: ph(cons("C"))},
+			{graph: "ll", out: ph(cons("y"))},
+			{graph: "rr", out: ph(cons("R"))},
+			{graph: "c", before: "eiéí", out: ph(cons("s"))},
+			{graph: "c", out: ph(cons("k"))},
+			{graph: "g", before: "eiéí", out: ph(cons("x"))},
+			{graph: "j", out: ph(cons("x"))},
+			{graph: "z", out: ph(cons("s"))},
+			{graph: "h", out: nil},
+			{graph: "v", out: ph(cons("b"))},
+			{graph: "ñ", out: ph(cons("N"))},
+			{graph: "x", out: ph(cons("k"), cons("s"))},
+			{graph: "w", out: ph(cons("w"))},
+			{graph: "y", final: true, out: ph(vow("i"))},
+			{graph: "y", out: ph(cons("y"))},
+
+			{graph: "a", out: ph(vow("a"))},
+			{graph: "e", out: ph(vow("e"))},
+			{graph: "i", out: ph(vow("i"))},
+			{graph: "o", out: ph(vow("o"))},
+			{graph: "u", out: ph(vow("u"))},
+			{graph: "ü", out: ph(vow("u"))},
+			{graph: "á", out: ph(accented("a"))},
+			{graph: "é", out: ph(accented("e"))},
+			{graph: "í", out: ph(accented("i"))},
+			{graph: "ó", out: ph(accented("o"))},
+			{graph: "ú", out: ph(accented("u"))},
+		},
+		glides: true,
+		stress: spanishStress,
+	})
+}
+
+func spanishStress(w string, phones []phone) int {
+	if i := markedVowel(phones); i >= 0 {
+		return i
+	}
+	vowels := vowelIndexes(phones)
+	if len(vowels) == 0 {
+		return -1
+	}
+	if len(vowels) > 1 && strings.ContainsAny(w[len(w)-1:], "aeiouns") {
+		return vowels[len(vowels)-2]
+	}
+	return vowels[len(vowels)-1]
+}
@@ -0,0 +1,68 @@
+package rhyme
+
+// Italian spelling is close to phonetic. Stress falls on the penultimate
+// vowel unless an accent marks the final one ("città", "perché"); the glide
+// rule keeps "cuore" and "amore" on the same stressed o. Double consonants
+// are kept: "fatto" does not rhyme with "fato".
+
+func init() {
+	register("it", &language{
+		rules: []rule{
+			{graph: "sci", before: "aou", out: ph(cons("S"))},
+			{graph: "gli", before: "aeou", out: ph(cons("L"))},
+			{graph: "sc", before: "eiéèì", out: ph(cons("S"))},
+			{graph: "gl", before: "i", out: ph(cons("L"))},
+			{graph: "gn", out: ph(cons("N"))},
+			{graph: "ch", out: ph(cons("k"))},
+			{graph: "gh", out: ph(cons("g"))},
+			{graph: "ci", before: "aou", out: ph(cons("C"))},
+			{graph: "gi", before: "aou", out: ph(cons("J"))},
+			{graph: "qu", out: ph(cons("k"), cons("w"))},
+			{graph: "c", before: "eiéèì", out: ph(cons("C"))},
+			{graph: "c", out: ph(cons("k"))},
+			{graph: "g", before: "eiéèì", out: ph(cons("J"))},
+			{graph: "h", out: nil},
+			{graph: "z", out: ph(cons("ts"))},
+			{graph: "x", out: ph(cons("k"), cons("s"))},
+			{graph: "j", out: ph(cons("j"))},
+			{graph: "y", out: ph(vow("i"))},
+			{graph: "w", out: ph(cons("v"))},
+			{graph: "k", out: ph(cons("k"))},
+
+			{graph: "a", out: ph(vow("a"))},
+			{graph: "e", out: ph(vow("e"))},
+			{graph: "i", out: ph(vow("i"))},
+			{graph: "o", out: ph(vow("o"))},
+			{graph: "u", out: ph(vow("u"))},
+			{graph: "à", out: ph(accented("a"))},
+			{graph: "è", out: ph(accented("e"))},
+			{graph: "é", out: ph(accented("e"))},
+			{graph: "ì", out: ph(accented("i"))},
+			{graph: "í", out: ph(accented("i"))},
+			{graph: "ò", out: ph(accented("o"))},
+			{graph: "ó", out: ph(accented("o"))},
+			{graph: "ù", out: ph(accented("u"))},
+			{graph: "ú", out: ph(accented("u"))},
+		},
+		glides:      true,
+		keepDoubles: true,
+		stress:      penultimateUnlessMarked,
+	})
+}
+
+// penultimateUnlessMarked stresses the accented vowel, else the penultimate
+// vowel of the word.
+func penultimateUnlessMarked(_ string, phones []phone) int {
+	if i := markedVowel(phones); i >= 0 {
+		return i
+	}
+	vowels := vowelIndexes(phones)
+	switch len(vowels) {
+	case 0:
+		return -1
+	case 1:
+		return vowels[0]
+	default:
+		return vowels[len(vowels)-2]
+	}
+}
@@ -0,0 +1,218 @@
+// Package rhyme computes phonetic rhyme keys for the languages in data.Langs.
+//
+// A word is transcribed into a rough phone sequence with per-language spelling
+// rules, its stressed vowel is located, and everything from that vowel to the
+// end of the word becomes the key. Two words rhyme when their keys are equal,
+// so "blue" and "through" match while "though" and "rough" do not.
+package rhyme
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Key returns the rhyme key of word in lang, or "" when word has no vowel to
+// rhyme on. Unknown languages use the English rules. Keys never contain
+// whitespace or ':', so they are safe to embed in cache key names.
+func Key(word, lang string) string {
+	l, ok := languages[lang]
+	if !ok {
+		l = languages["en"]
+	}
+	w := normalize(word)
+	if w == "" {
+		return ""
+	}
+	if k, ok := l.exceptions[w]; ok {
+		return k
+	}
+	if l.prepare != nil {
+		w = l.prepare(w)
+	}
+	phones := transcribe(w, l)
+	stressed := l.stress(w, phones)
+	if stressed < 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, p := range phones[stressed:] {
+		if i == 0 && p.alt != "" {
+			b.WriteString(p.alt)
+		} else {
+			b.WriteString(p.sym)
+		}
+	}
+	return b.String()
+}
+
+// phone is one transcribed sound.
+type phone struct {
+	sym   string
+	vowel bool
+	// weak marks unstressed ending vowels (English -y, German -e); stress
+	// skips them whenever the word has another vowel.
+	weak bool
+	// marked is a vowel carrying a written stress accent.
+	marked bool
+	// alt replaces sym when the phone ends up stressed anyway ("" = sym).
+	alt string
+}
+
+func cons(sym string) phone      { return phone{sym: sym} }
+func vow(sym string) phone       { return phone{sym: sym, vowel: true} }
+func weak(sym, alt string) phone { return phone{sym: sym, vowel: true, weak: true, alt: alt} }
+func accented(sym string) phone  { return phone{sym: sym, vowel: true, marked: true} }
+func ph(phones ...phone) []phone { return phones }
+
+// rule rewrites a spelling into phones. Rules are tried longest spelling
+// first; among equal lengths, table order wins, so conditional variants go
+// before the unconditional one.
+type rule struct {
+	graph string
+	// before, if set, lists the letters that must follow the spelling.
+	before string
+	// final restricts the rule to the end of the word.
+	final bool
+	out   []phone
+}
+
+type language struct {
+	exceptions map[string]string
+	rules      []rule
+	// prepare rewrites the normalized word before transcription.
+	prepare func(w string) string
+	// glides turns unstressed i/u next to another vowel into consonants.
+	glides bool
+	// keepDoubles keeps double consonants, which change the rhyme in
+	// Italian but are only spelling elsewhere.
+	keepDoubles bool
+	// stress returns the index in phones of the stressed vowel, or -1.
+	stress func(w string, phones []phone) int
+}
+
+var languages = map[string]*language{}
+
+func register(code string, l *language) {
+	sort.SliceStable(l.rules, func(i, j int) bool {
+		return utf8.RuneCountInString(l.rules[i].graph) > utf8.RuneCountInString(l.rules[j].graph)
+	})
+	languages[code] = l
+}
+
+// normalize lower-cases word and keeps only its letters, so punctuation left
+// on tokens by the whitespace tokenizer does not change the key.
+func normalize(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(word) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func transcribe(w string, l *language) []phone {
+	runes := []rune(w)
+	out := make([]phone, 0, len(runes))
+	for pos := 0; pos < len(runes); {
+		matched := false
+		for _, r := range l.rules {
+			g := []rune(r.graph)
+			end := pos + len(g)
+			if end > len(runes) || string(runes[pos:end]) != r.graph {
+				continue
+			}
+			if r.final && end != len(runes) {
+				continue
+			}
+			if r.before != "" && (end == len(runes) || !strings.ContainsRune(r.before, runes[end])) {
+				continue
+			}
+			out = append(out, r.out...)
+			pos = end
+			matched = true
+			break
+		}
+		if !matched {
+			// Letters without a rule stand for themselves.
+			out = append(out, cons(string(runes[pos])))
+			pos++
+		}
+	}
+	if l.glides {
+		out = applyGlides(out)
+	}
+	if !l.keepDoubles {
+		out = collapseDoubles(out)
+	}
+	return out
+}
+
+// applyGlides demotes an unaccented i or u to a glide when it sits next to
+// another vowel, leaving that vowel as the syllable nucleus.
+func applyGlides(phones []phone) []phone {
+	isVowel := func(i int) bool { return i >= 0 && i < len(phones) && phones[i].vowel }
+	for i := range phones {
+		p := phones[i]
+		if !p.vowel || p.marked || (p.sym != "i" && p.sym != "u") {
+			continue
+		}
+		if isVowel(i+1) || isVowel(i-1) {
+			glide := "j"
+			if p.sym == "u" {
+				glide = "w"
+			}
+			phones[i] = cons(glide)
+		}
+	}
+	return phones
+}
+
+func collapseDoubles(phones []phone) []phone {
+	out := phones[:0]
+	for _, p := range phones {
+		if n := len(out); n > 0 && !p.vowel && !out[n-1].vowel && out[n-1].sym == p.sym {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// vowelIndexes lists the positions of the vowels in phones.
+func vowelIndexes(phones []phone) []int {
+	idx := make([]int, 0, 4)
+	for i, p := range phones {
+		if p.vowel {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// lastStrongVowel stresses the last vowel that is not a weak ending, falling
+// back to the last vowel of all-weak words.
+func lastStrongVowel(_ string, phones []phone) int {
+	vowels := vowelIndexes(phones)
+	if len(vowels) == 0 {
+		return -1
+	}
+	for i := len(vowels) - 1; i >= 0; i-- {
+		if !phones[vowels[i]].weak {
+			return vowels[i]
+		}
+	}
+	return vowels[len(vowels)-1]
+}
+
+// markedVowel returns the vowel carrying a written accent, or -1.
+func markedVowel(phones []phone) int {
+	for i, p := range phones {
+		if p.marked {
+			return i
+		}
+	}
+	return -1
+}